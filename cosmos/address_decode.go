@@ -97,7 +97,7 @@ func (dec *AddressDecoderV2) WIFToPrivateKey(wif string, isTestnet bool) ([]byte
 
 //RedeemScriptToAddress 多重签名赎回脚本转地址
 func (dec *AddressDecoderV2) RedeemScriptToAddress(pubs [][]byte, required uint64, isTestnet bool) (string, error) {
-	return "", fmt.Errorf("RedeemScriptToAddress not implement")
+	return NewMultisigAddress(pubs, int(required))
 }
 
 // CustomCreateAddress 创建账户地址
@@ -0,0 +1,345 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package cosmos
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/tidwall/gjson"
+)
+
+// 扫块模式，通过配置scanMode指定
+const (
+	ScanModeMessage = "message" //按交易的消息类型解析转账，只支持转账和已知的消息
+	ScanModeEvents  = "events"  //按区块执行结果的coin_received和transfer事件解析转账，覆盖任意消息产生的转账
+)
+
+//isValidScanMode 是否支持的扫块模式，空为默认的message
+func isValidScanMode(mode string) bool {
+	return mode == "" || mode == ScanModeMessage || mode == ScanModeEvents
+}
+
+//eventAttribute 解码后的事件属性
+type eventAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+//messageEvent 解码后的事件
+type messageEvent struct {
+	Type       string           `json:"type"`
+	Attributes []eventAttribute `json:"attributes"`
+}
+
+//messageLog 一个消息产生的事件，格式与交易执行日志相同
+type messageLog struct {
+	MsgIndex int            `json:"msg_index"`
+	Events   []messageEvent `json:"events"`
+}
+
+//decodeEventAttribute 解码事件属性，tendermint v0.34的block_results中属性的key和value为base64编码
+func decodeEventAttribute(attr gjson.Result) eventAttribute {
+	key := attr.Get("key").String()
+	value := attr.Get("value").String()
+	decodedKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || !isPrintable(decodedKey) {
+		return eventAttribute{Key: key, Value: value}
+	}
+	decodedValue, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return eventAttribute{Key: key, Value: value}
+	}
+	return eventAttribute{Key: string(decodedKey), Value: string(decodedValue)}
+}
+
+//isPrintable 是否可打印的ASCII字符，用于判断属性是否经过base64编码
+func isPrintable(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if b < 0x20 || b > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+//getMessageLogs 将交易执行结果的事件按消息分组。v0.45的log为每个消息的执行日志；
+//之后的版本log为空，事件带有msg_index属性，没有msg_index的事件（如扣除手续费）不属于任何消息
+func getMessageLogs(txResult *gjson.Result) []gjson.Result {
+	logs := gjson.Parse(txResult.Get("log").String())
+	if logs.IsArray() {
+		return logs.Array()
+	}
+
+	grouped := make(map[int]*messageLog)
+	for _, e := range txResult.Get("events").Array() {
+		event, msgIndex := decodeEvent(e)
+		if msgIndex < 0 {
+			continue
+		}
+		if grouped[msgIndex] == nil {
+			grouped[msgIndex] = &messageLog{MsgIndex: msgIndex}
+		}
+		grouped[msgIndex].Events = append(grouped[msgIndex].Events, event)
+	}
+
+	indexes := make([]int, 0, len(grouped))
+	for index := range grouped {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	msgLogs := make([]gjson.Result, 0, len(indexes))
+	for _, index := range indexes {
+		data, _ := json.Marshal(grouped[index])
+		msgLogs = append(msgLogs, gjson.ParseBytes(data))
+	}
+	return msgLogs
+}
+
+//decodeEvent 解码事件的属性，返回事件所属消息的msg_index，没有该属性时为-1
+func decodeEvent(e gjson.Result) (messageEvent, int) {
+	event := messageEvent{Type: e.Get("type").String()}
+	msgIndex := -1
+	for _, a := range e.Get("attributes").Array() {
+		attr := decodeEventAttribute(a)
+		if attr.Key == "msg_index" {
+			if index, err := strconv.Atoi(attr.Value); err == nil {
+				msgIndex = index
+			}
+			continue
+		}
+		event.Attributes = append(event.Attributes, attr)
+	}
+	return event, msgIndex
+}
+
+//getFeeTransferValues v0.45执行失败的交易没有事件，从交易的auth_info获取手续费和支付方（未指定时为首个签名者），
+//将手续费记为失败的转账，提取时只收取手续费。交易无法解码时按扣除手续费的事件解析
+func getFeeTransferValues(txResult *gjson.Result, txBytes []byte) []TxValue {
+	failed := &TxResult{
+		Code:      uint32(txResult.Get("code").Uint()),
+		Codespace: txResult.Get("codespace").String(),
+		RawLog:    txResult.Get("log").String(),
+	}
+
+	values := make([]TxValue, 0)
+	tx, err := newEncodingConfig().TxConfig.TxDecoder()(txBytes)
+	if feeTx, ok := tx.(types.FeeTx); err == nil && ok {
+		for _, coin := range feeTx.GetFee() {
+			values = append(values, TxValue{
+				From:   feeTx.FeePayer().String(),
+				Amount: coin.Amount.BigInt(),
+				Status: "false",
+				Reason: failed.FailedReason(),
+				Denom:  coin.Denom,
+			})
+		}
+		return values
+	}
+
+	feeLog := messageLog{}
+	for _, e := range txResult.Get("events").Array() {
+		event, _ := decodeEvent(e)
+		feeLog.Events = append(feeLog.Events, event)
+	}
+	data, _ := json.Marshal(feeLog)
+	msgLog := gjson.ParseBytes(data)
+	for _, transfer := range getTransferEvents(&msgLog) {
+		for _, coin := range getCoins(transfer.Amount, "") {
+			values = append(values, TxValue{
+				From:   transfer.Sender,
+				To:     transfer.Recipient,
+				Amount: coin.Amount.BigInt(),
+				Status: "false",
+				Reason: failed.FailedReason(),
+				Denom:  coin.Denom,
+			})
+		}
+	}
+	return values
+}
+
+//getCoinReceivedEvents 获取日志中的coin_received事件，每个到账由receiver、amount两个属性组成
+func getCoinReceivedEvents(msgLog *gjson.Result) []TransferEvent {
+	received := make([]TransferEvent, 0)
+	for _, event := range msgLog.Get("events").Array() {
+		if event.Get("type").String() != "coin_received" {
+			continue
+		}
+		var r *TransferEvent
+		for _, attr := range event.Get("attributes").Array() {
+			switch attr.Get("key").String() {
+			case "receiver":
+				if r != nil {
+					received = append(received, *r)
+				}
+				r = &TransferEvent{Recipient: attr.Get("value").String()}
+			case "amount":
+				if r != nil {
+					r.Amount = attr.Get("value").String()
+				}
+			}
+		}
+		if r != nil {
+			received = append(received, *r)
+		}
+	}
+	return received
+}
+
+//NewEventTxValues 按交易执行结果中每个消息的transfer和coin_received事件解析转账，执行失败的交易只有手续费，从交易的原始数据获取。
+//transfer事件记录发送方，没有对应transfer事件的coin_received（如铸币到账）发送方为空
+func NewEventTxValues(txResult *gjson.Result, txBytes []byte) []TxValue {
+	if txResult.Get("code").Uint() != 0 {
+		return getFeeTransferValues(txResult, txBytes)
+	}
+
+	values := make([]TxValue, 0)
+	for _, msgLog := range getMessageLogs(txResult) {
+		transfers := getTransferEvents(&msgLog)
+		matched := make([]bool, len(transfers))
+		for _, transfer := range transfers {
+			for _, coin := range getCoins(transfer.Amount, "") {
+				values = append(values, TxValue{
+					From:   transfer.Sender,
+					To:     transfer.Recipient,
+					Amount: coin.Amount.BigInt(),
+					Status: "true",
+					Denom:  coin.Denom,
+				})
+			}
+		}
+		for _, r := range getCoinReceivedEvents(&msgLog) {
+			found := false
+			for i, transfer := range transfers {
+				if !matched[i] && transfer.Recipient == r.Recipient && transfer.Amount == r.Amount {
+					matched[i] = true
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			for _, coin := range getCoins(r.Amount, "") {
+				values = append(values, TxValue{
+					To:     r.Recipient,
+					Amount: coin.Amount.BigInt(),
+					Status: "true",
+					Denom:  coin.Denom,
+				})
+			}
+		}
+	}
+	return values
+}
+
+//NewEventTransaction 从区块中交易的原始数据解析手续费、手续费支付方、授权方和备注，转账为按事件解析的结果，不需要再查询节点
+func NewEventTransaction(block *Block, index int, txResult *gjson.Result) (*Transaction, error) {
+	txBytes := block.TxBytes[index]
+	var raw txtypes.TxRaw
+	if err := raw.Unmarshal(txBytes); err != nil {
+		return nil, fmt.Errorf("decode transaction: %s failed: %v", block.Transactions[index], err)
+	}
+	var body txtypes.TxBody
+	if err := body.Unmarshal(raw.BodyBytes); err != nil {
+		return nil, fmt.Errorf("decode body of transaction: %s failed: %v", block.Transactions[index], err)
+	}
+	var authInfo txtypes.AuthInfo
+	if err := authInfo.Unmarshal(raw.AuthInfoBytes); err != nil {
+		return nil, fmt.Errorf("decode auth_info of transaction: %s failed: %v", block.Transactions[index], err)
+	}
+
+	obj := &Transaction{}
+	obj.TxType = "cosmos-sdk/StdTx"
+	obj.TxID = block.Transactions[index]
+	obj.BlockHeight = block.Height
+	obj.BlockHash = block.Hash
+	obj.TimeStamp = block.Timestamp
+	obj.Gas = txResult.Get("gas_used").Uint()
+	obj.Memo = body.Memo
+	if authInfo.Fee != nil {
+		if len(authInfo.Fee.Amount) > 0 {
+			obj.Fee = []FeeValue{{authInfo.Fee.Amount[0].Amount.BigInt(), authInfo.Fee.Amount[0].Denom}}
+		}
+		obj.FeePayer = authInfo.Fee.Payer
+		obj.FeeGranter = authInfo.Fee.Granter
+	}
+	obj.TxValue = NewEventTxValues(txResult, txBytes)
+	return obj, nil
+}
+
+//getBlockEventTransactions 按区块的执行结果解析区块中的每个交易，交易的原始数据取自已获取的区块
+func (bs *ATOMBlockScanner) getBlockEventTransactions(block *Block) (map[string]*Transaction, error) {
+	txResults, err := bs.wm.NodeClient.getBlockResults(block.Height)
+	if err != nil {
+		return nil, err
+	}
+	if len(txResults) != len(block.Transactions) {
+		return nil, fmt.Errorf("block height: %d has %d transactions but %d results", block.Height, len(block.Transactions), len(txResults))
+	}
+
+	trxs := make(map[string]*Transaction, len(block.Transactions))
+	for i, txid := range block.Transactions {
+		trx, err := NewEventTransaction(block, i, &txResults[i])
+		if err != nil {
+			return nil, err
+		}
+		trxs[txid] = trx
+	}
+	return trxs, nil
+}
+
+//extractTransactionByEvents 按事件解析的交易提取交易单，不涉及钱包地址的交易跳过
+func (bs *ATOMBlockScanner) extractTransactionByEvents(trx *Transaction, scanAddressFunc openwallet.BlockScanTargetFuncV2) ExtractResult {
+	result := ExtractResult{
+		BlockHeight: trx.BlockHeight,
+		TxID:        trx.TxID,
+		extractData: make(map[string][]*openwallet.TxExtractData),
+		Success:     true,
+	}
+
+	relevant := false
+	for _, v := range trx.TxValue {
+		for _, address := range []string{v.From, v.To} {
+			if address == "" {
+				continue
+			}
+			if scanAddressFunc(openwallet.ScanTargetParam{
+				ScanTarget:     address,
+				Symbol:         bs.wm.Symbol(),
+				ScanTargetType: openwallet.ScanTargetTypeAccountAddress,
+			}).Exist {
+				relevant = true
+			}
+		}
+	}
+	if !relevant {
+		return result
+	}
+
+	bs.extractTransaction(trx, &result, scanAddressFunc)
+	return result
+}
@@ -0,0 +1,271 @@
+package cosmos
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blocktree/go-owcdrivers/addressEncoder"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+)
+
+func Test_NewEventTxValues(t *testing.T) {
+	usdc := "ibc/CDC4587874B85BEA4FCEC3CEA5A1195139799A1FEE711A07D972537E18FDA39D"
+	txResults := loadTestTransaction(t, "block_results.json").Get("result.txs_results").Array()
+
+	//v0.45按消息的执行日志解析，不包括扣除手续费的事件
+	values := NewEventTxValues(&txResults[0], nil)
+	if len(values) != 1 {
+		t.Fatalf("expected 1 transfer, got %+v", values)
+	}
+	if v := values[0]; v.From != "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n" || v.To != "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9" ||
+		v.Amount.Int64() != 1000000 || v.Denom != "uatom" || v.Status != "true" {
+		t.Errorf("unexpected transfer: %+v", v)
+	}
+
+	//v0.45执行失败的交易没有事件，手续费和支付方从交易的auth_info获取，记为失败
+	from, txBytes := testFailedTxBytes(t, nil)
+	values = NewEventTxValues(&txResults[1], txBytes)
+	if len(values) != 1 {
+		t.Fatalf("expected 1 fee transfer, got %+v", values)
+	}
+	if v := values[0]; v.From != from || v.Amount.Int64() != 2500 || v.Denom != "uatom" || v.Status != "false" ||
+		v.Reason != "codespace: sdk, code: 5, failed to execute message; message index: 0: 100uatom is smaller than 500000uatom: insufficient funds" {
+		t.Errorf("unexpected fee transfer: %+v", v)
+	}
+
+	//指定了手续费支付方时由支付方支付
+	payer, txBytes := testFailedTxBytes(t, func(cosmosTx *CosmosTx) {
+		payerKey, _ := hex.DecodeString("2234567812345678123456781234567812345678123456781234567812345678")
+		payerPub := (&secp256k1.PrivKey{Key: payerKey}).PubKey()
+		cosmosTx.FeePayer = addressEncoder.AddressEncode(payerPub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress)
+		cosmosTx.FeePayerPublicKey = hex.EncodeToString(payerPub.Bytes())
+	})
+	values = NewEventTxValues(&txResults[1], txBytes)
+	if len(values) != 1 || values[0].From != payer || values[0].From == from {
+		t.Errorf("unexpected fee payer: %+v", values)
+	}
+
+	//按msg_index属性分组，铸币到模块账户没有对应的transfer事件
+	values = NewEventTxValues(&txResults[2], nil)
+	if len(values) != 2 {
+		t.Fatalf("expected 2 transfers, got %+v", values)
+	}
+	if v := values[0]; v.From != "cosmos1yl6hdjhmkf37639730gffanpzndzdpmhwlkfhr" || v.To != "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9" ||
+		v.Amount.Int64() != 5000000 || v.Denom != usdc {
+		t.Errorf("unexpected transfer: %+v", v)
+	}
+	if v := values[1]; v.From != "" || v.To != "cosmos1yl6hdjhmkf37639730gffanpzndzdpmhwlkfhr" || v.Amount.Int64() != 5000000 {
+		t.Errorf("unexpected mint: %+v", v)
+	}
+}
+
+//testFailedTxBytes 生成执行失败的交易的原始数据，返回支付手续费的地址
+func testFailedTxBytes(t *testing.T, option func(*CosmosTx)) (string, []byte) {
+	key, _ := hex.DecodeString("1234567812345678123456781234567812345678123456781234567812345678")
+	pub := (&secp256k1.PrivKey{Key: key}).PubKey()
+	cosmosTx := CosmosTx{
+		From:      addressEncoder.AddressEncode(pub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress),
+		To:        "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:     "uatom",
+		FeeDenom:  "uatom",
+		ChainID:   "cosmoshub-4",
+		PublicKey: hex.EncodeToString(pub.Bytes()),
+		Amount:    big.NewInt(500000),
+		Fee:       2500,
+		AccSeq:    5,
+		GasLimit:  200000,
+	}
+	if option != nil {
+		option(&cosmosTx)
+	}
+	//模拟交易的数据不需要签名，只用于解析手续费
+	txBytes, err := cosmosTx.getSimulateTxBytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if cosmosTx.hasFeePayer() {
+		return cosmosTx.FeePayer, txBytes
+	}
+	return cosmosTx.From, txBytes
+}
+
+//testEventBlock 生成包含交易原始数据的区块
+func testEventBlock(txBytes ...[]byte) *Block {
+	block := &Block{Hash: "BLOCKHASH", Height: 8102345, Timestamp: 1650000000}
+	for _, b := range txBytes {
+		block.Transactions = append(block.Transactions, hex.EncodeToString(owcrypt.Hash(b, 0, owcrypt.HASH_ALG_SHA256)))
+		block.TxBytes = append(block.TxBytes, b)
+	}
+	return block
+}
+
+func Test_extractTransactionByEvents(t *testing.T) {
+	//交易内容从区块中的原始数据解析，不查询节点
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.RestClient = NewClient(server.URL, false)
+	bs := wm.Blockscanner
+	scanAddress := func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"}
+	}
+	txResults := loadTestTransaction(t, "block_results.json").Get("result.txs_results").Array()
+
+	//MsgExec转入的ATOM，备注和手续费从交易的原始数据获取
+	_, txBytes := testFailedTxBytes(t, func(cosmosTx *CosmosTx) {
+		cosmosTx.Memo = "10086"
+	})
+	block := testEventBlock(txBytes)
+	trx, err := NewEventTransaction(block, 0, &txResults[0])
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if trx.Memo != "10086" || len(trx.Fee) != 1 || trx.Fee[0].Amount.Int64() != 2500 || trx.FeePayer != "" || trx.FeeGranter != "" {
+		t.Errorf("unexpected transaction header: %+v", trx)
+	}
+	result := bs.extractTransactionByEvents(trx, scanAddress)
+	list := result.extractData["account"]
+	if !result.Success || len(list) != 1 {
+		t.Fatalf("unexpected extract result: %+v", result)
+	}
+	ed := list[0]
+	if len(ed.TxInputs) != 0 || len(ed.TxOutputs) != 1 || ed.TxOutputs[0].Amount != "1" || ed.TxOutputs[0].Memo != "10086" {
+		t.Errorf("unexpected outputs: %+v", ed.TxOutputs)
+	}
+	if ed.Transaction.TxID != block.Transactions[0] || ed.Transaction.BlockHeight != 8102345 || ed.Transaction.BlockHash != "BLOCKHASH" ||
+		ed.Transaction.ConfirmTime != 1650000000 {
+		t.Errorf("unexpected transaction: %+v", ed.Transaction)
+	}
+
+	//不涉及钱包地址的交易跳过
+	scanAddress = func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{}
+	}
+	result = bs.extractTransactionByEvents(trx, scanAddress)
+	if !result.Success || len(result.extractData) != 0 {
+		t.Errorf("irrelevant transaction should be skipped: %+v", result)
+	}
+
+	//执行失败的交易只向支付方收取手续费
+	payer, txBytes := testFailedTxBytes(t, nil)
+	scanAddress = func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == payer}
+	}
+	trx, err = NewEventTransaction(testEventBlock(txBytes), 0, &txResults[1])
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	result = bs.extractTransactionByEvents(trx, scanAddress)
+	list = result.extractData["account"]
+	if !result.Success || len(list) != 1 {
+		t.Fatalf("unexpected extract result: %+v", result)
+	}
+	ed = list[0]
+	if len(ed.TxInputs) != 1 || len(ed.TxOutputs) != 0 || ed.TxInputs[0].Address != payer || ed.TxInputs[0].Amount != "0.0025" ||
+		ed.Transaction.Status != "0" || ed.Transaction.Fees != "0.0025" {
+		t.Errorf("unexpected fee of failed transaction: %+v, %+v", ed.TxInputs, ed.Transaction)
+	}
+
+	//由授权方支付手续费时不向交易中的地址收取
+	_, txBytes = testFailedTxBytes(t, func(cosmosTx *CosmosTx) {
+		cosmosTx.FeeGranter = "cosmos1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u0tvx7u"
+	})
+	trx, err = NewEventTransaction(testEventBlock(txBytes), 0, &txResults[1])
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if trx.FeeGranter != "cosmos1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u0tvx7u" {
+		t.Errorf("unexpected fee granter: %+v", trx)
+	}
+	result = bs.extractTransactionByEvents(trx, scanAddress)
+	if !result.Success || len(result.extractData["account"]) != 0 {
+		t.Errorf("granted fee should not be charged: %+v", result.extractData["account"])
+	}
+
+	//无法解码的交易数据
+	if _, err = NewEventTransaction(testEventBlock([]byte{0xff, 0xff}), 0, &txResults[0]); err == nil {
+		t.Errorf("invalid transaction bytes should fail")
+	}
+}
+
+func Test_extractTransactions_events(t *testing.T) {
+	_, txBytes := testFailedTxBytes(t, func(cosmosTx *CosmosTx) {
+		cosmosTx.Memo = "10086"
+	})
+	_, failedBytes := testFailedTxBytes(t, nil)
+	_, mintBytes := testFailedTxBytes(t, func(cosmosTx *CosmosTx) {
+		cosmosTx.Memo = "mint"
+	})
+	block := testEventBlock(txBytes, failedBytes, mintBytes)
+	blockResults := loadTestTransaction(t, "block_results.json")
+	blockCalls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block_results", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(blockResults.Raw))
+	})
+	mux.HandleFunc("/blocks/", func(w http.ResponseWriter, r *http.Request) {
+		blockCalls++
+		fmt.Fprintf(w, `{"block_id":{"hash":"BLOCKHASH"},"block":{"header":{"height":"8102345"},"data":{"txs":["%s","%s","%s"]}}}`,
+			base64.StdEncoding.EncodeToString(txBytes), base64.StdEncoding.EncodeToString(failedBytes), base64.StdEncoding.EncodeToString(mintBytes))
+	})
+	//ibc凭证的精度从denom元数据获取
+	mux.HandleFunc("/ibc/apps/transfer/v1/denom_traces/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"denom_trace":{"path":"transfer/channel-750","base_denom":"uusdc"}}`)
+	})
+	mux.HandleFunc("/cosmos/bank/v1beta1/denoms_metadata/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"metadata":{"base":"uusdc","display":"usdc","symbol":"USDC","denom_units":[{"denom":"uusdc","exponent":0},{"denom":"usdc","exponent":6}]}}`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.Config.ScanMode = ScanModeEvents
+	wm.RestClient = NewClient(server.URL, false)
+	wm.NodeClient = NewClient(server.URL, false)
+	bs := wm.Blockscanner
+	bs.ScanTargetFuncV2 = func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"}
+	}
+
+	//扫块时使用已获取的区块，不再重复获取
+	results, err := bs.extractTransactions(block.Height, block.Hash, block.Transactions, block, false)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if blockCalls != 0 || len(results) != 3 {
+		t.Fatalf("unexpected results: %+v, block calls: %d", results, blockCalls)
+	}
+	if list := results[0].extractData["account"]; !results[0].Success || len(list) != 1 || list[0].TxOutputs[0].Memo != "10086" {
+		t.Errorf("unexpected extract result: %+v", results[0])
+	}
+	if list := results[2].extractData["account"]; !results[2].Success || len(list) != 1 || list[0].TxOutputs[0].Memo != "mint" ||
+		list[0].TxOutputs[0].Amount != "5" {
+		t.Errorf("unexpected extract result: %+v", results[2])
+	}
+
+	//重扫部分交易时没有区块，获取一次区块
+	results, err = bs.extractTransactions(block.Height, "", block.Transactions[2:], nil, false)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if blockCalls != 1 || len(results) != 1 || !results[0].Success || results[0].TxID != block.Transactions[2] {
+		t.Errorf("unexpected results: %+v, block calls: %d", results, blockCalls)
+	}
+}
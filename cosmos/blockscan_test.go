@@ -16,14 +16,26 @@
 package cosmos
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	//"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	//"github.com/asdine/storm"
+	"github.com/asdine/storm"
 	//"github.com/blocktree/openwallet/log"
-	//"github.com/blocktree/openwallet/openwallet"
+	owcrypt "github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
 	"github.com/pborman/uuid"
+	"github.com/tidwall/gjson"
 )
 
 func TestGetBTCBlockHeight(t *testing.T) {
@@ -199,6 +211,618 @@ func TestONTBlockScanner_ExtractTransaction(t *testing.T) {
 
 }
 
+func Test_extractTransaction_multiDenom(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_id":{"hash":"BLOCKHASH"}}`)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.RestClient = NewClient(server.URL, false)
+	bs := wm.Blockscanner
+	usdc := "ibc/CDC4587874B85BEA4FCEC3CEA5A1195139799A1FEE711A07D972537E18FDA39D"
+	osmo := ibctransfertypes.ParseDenomTrace("transfer/channel-141/uosmo").IBCDenom()
+
+	//代币没有denom元数据，按钱包登记的精度换算
+	registered := true
+	scanAddress := func(address string) openwallet.BlockScanTargetFuncV2 {
+		return func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+			if target.ScanTargetType == openwallet.ScanTargetTypeContractAddress {
+				return openwallet.ScanTargetResult{Exist: registered, TargetInfo: &openwallet.SmartContract{Address: target.ScanTarget, Decimals: 6}}
+			}
+			return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == address}
+		}
+	}
+
+	//无法确定代币的精度时不提取交易
+	trx := NewTransaction(loadTestTransaction(t, "tx_multi_denom.json"), "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "")
+	registered = false
+	result := &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress("cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"))
+	if result.Success || len(result.extractData) != 0 {
+		t.Errorf("denom with unknown decimals should not be extracted: %+v", result)
+	}
+	registered = true
+
+	//收到多个denom时每个denom一条交易记录，主币以外的denom为合约资产
+	result = &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress("cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"))
+	list := result.extractData["account"]
+	if !result.Success || len(list) != 3 {
+		t.Fatalf("expected 3 extract data, got %d", len(list))
+	}
+	received := map[string]string{usdc: "25", "uatom": "1", osmo: "5"}
+	for _, ed := range list {
+		denom := "uatom"
+		if ed.Transaction.Coin.IsContract {
+			denom = ed.Transaction.Coin.Contract.Address
+			if ed.Transaction.Coin.ContractID != openwallet.GenContractID(wm.Symbol(), denom) {
+				t.Errorf("unexpected contract id of denom %s: %s", denom, ed.Transaction.Coin.ContractID)
+			}
+		}
+		if len(ed.TxInputs) != 0 || len(ed.TxOutputs) != 1 || ed.TxOutputs[0].Amount != received[denom] {
+			t.Errorf("unexpected extract data of denom %s: %+v", denom, ed.TxOutputs)
+			continue
+		}
+		if ed.TxOutputs[0].Coin.ContractID != ed.Transaction.Coin.ContractID || ed.Transaction.BlockHash != "BLOCKHASH" {
+			t.Errorf("unexpected output coin of denom %s", denom)
+		}
+	}
+
+	//只转出代币时，手续费作为主币单独记录
+	trx = &Transaction{
+		TxID:        "5A2E8C0B1D4F6A3E9C7B2D5F8A1E4C6B3D9F2A7E5C8B1D4F6A3E9C7B2D5F8A1E",
+		BlockHeight: 8102340,
+		TxValue: []TxValue{
+			{From: "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n", To: "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9", Amount: big.NewInt(25000000), Status: "true", Denom: usdc},
+		},
+		Fee: []FeeValue{{Amount: big.NewInt(2500), Denom: "uatom"}},
+	}
+	result = &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress("cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"))
+	list = result.extractData["account"]
+	if len(list) != 2 {
+		t.Fatalf("expected 2 extract data, got %d", len(list))
+	}
+	for _, ed := range list {
+		if ed.Transaction.Coin.IsContract {
+			if len(ed.TxInputs) != 1 || ed.TxInputs[0].Amount != "25" || ed.Transaction.Fees != "0" {
+				t.Errorf("unexpected token inputs: %+v", ed.TxInputs)
+			}
+			continue
+		}
+		if len(ed.TxInputs) != 1 || ed.TxInputs[0].Amount != "0.0025" || ed.TxInputs[0].Coin.IsContract || ed.Transaction.Fees != "0.0025" {
+			t.Errorf("unexpected fee inputs: %+v", ed.TxInputs)
+		}
+	}
+
+	//超过uint64的数量
+	amount, _ := new(big.Int).SetString("1500000000000000000000", 10)
+	trx = &Transaction{
+		TxID:        "5A2E8C0B1D4F6A3E9C7B2D5F8A1E4C6B3D9F2A7E5C8B1D4F6A3E9C7B2D5F8A1E",
+		BlockHeight: 8102340,
+		TxValue: []TxValue{
+			{From: "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n", To: "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9", Amount: amount, Status: "true", Denom: usdc},
+		},
+	}
+	result = &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress("cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"))
+	list = result.extractData["account"]
+	if len(list) != 1 || len(list[0].TxOutputs) != 1 || list[0].TxOutputs[0].Amount != "1500000000000000" || list[0].Transaction.Amount != "1500000000000000" {
+		t.Errorf("unexpected extract data of large amount: %+v", list)
+	}
+}
+
+func Test_extractTransaction_failed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_id":{"hash":"BLOCKHASH"}}`)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.RestClient = NewClient(server.URL, false)
+	bs := wm.Blockscanner
+	scanAddress := func(address string) openwallet.BlockScanTargetFuncV2 {
+		return func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+			return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == address}
+		}
+	}
+
+	cases := []struct {
+		name string
+		fee  string
+	}{
+		{"tx_failed_send.json", "0.0025"},
+		{"tx_failed_ibc.json", "0.003"},
+	}
+	for _, c := range cases {
+		trx := NewTransaction(loadTestTransaction(t, c.name), "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "")
+
+		//执行失败的交易只扣除发送地址的手续费，不记录转账
+		result := &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+		bs.extractTransaction(trx, result, scanAddress("cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"))
+		list := result.extractData["account"]
+		if !result.Success || len(list) != 1 {
+			t.Fatalf("%s: expected 1 extract data, got %d", c.name, len(list))
+		}
+		ed := list[0]
+		if len(ed.TxInputs) != 1 || len(ed.TxOutputs) != 0 || ed.TxInputs[0].Amount != c.fee || ed.TxInputs[0].Coin.IsContract {
+			t.Errorf("%s: unexpected fee inputs: %+v", c.name, ed.TxInputs)
+		}
+		if ed.Transaction.Status != "0" || ed.Transaction.Reason != trx.TxValue[0].Reason || ed.Transaction.Fees != c.fee || ed.Transaction.Amount != "0" {
+			t.Errorf("%s: unexpected transaction: %+v", c.name, ed.Transaction)
+		}
+
+		//接收地址没有入账
+		result = &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+		bs.extractTransaction(trx, result, scanAddress("cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"))
+		if len(result.extractData) != 0 {
+			t.Errorf("%s: failed transaction should not be credited: %+v", c.name, result.extractData)
+		}
+	}
+}
+
+func Test_extractTransaction_feePayer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_id":{"hash":"BLOCKHASH"}}`)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.RestClient = NewClient(server.URL, false)
+	bs := wm.Blockscanner
+	sender := "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+	payer := "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"
+	scanAddress := func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{SourceKey: target.ScanTarget, Exist: target.ScanTarget == sender || target.ScanTarget == payer}
+	}
+	newTx := func(fee string) *Transaction {
+		json := gjson.Parse(`{"tx":{"body":{"messages":[{"@type":"/cosmos.bank.v1beta1.MsgSend","from_address":"` + sender + `",` +
+			`"to_address":"cosmos1yl6hdjhmkf37639730gffanpzndzdpmhwlkfhr","amount":[{"denom":"uatom","amount":"1000000"}]}]},` +
+			`"auth_info":{"fee":{"amount":[{"denom":"uatom","amount":"2500"}],` + fee + `}}},` +
+			`"tx_response":{"txhash":"AA","height":"8102340"}}`)
+		return NewTransaction(&json, "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "")
+	}
+
+	//指定了支付方时，发送地址不支付手续费，由支付方支付
+	trx := newTx(`"payer":"` + payer + `","granter":""`)
+	if trx.FeePayer != payer || trx.FeeGranter != "" {
+		t.Fatalf("unexpected fee payer: %+v", trx)
+	}
+	result := &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress)
+	if list := result.extractData[sender]; len(list) != 1 || len(list[0].TxInputs) != 1 || list[0].TxInputs[0].Amount != "1" {
+		t.Errorf("sender should not pay the fee: %+v", list)
+	}
+	if list := result.extractData[payer]; len(list) != 1 || len(list[0].TxInputs) != 1 || list[0].TxInputs[0].Address != payer ||
+		list[0].TxInputs[0].Amount != "0.0025" || list[0].Transaction.Fees != "0.0025" {
+		t.Errorf("payer should pay the fee: %+v", list)
+	}
+
+	//由授权方的额度支付时，交易中的地址都不支付手续费
+	trx = newTx(`"payer":"","granter":"` + payer + `"`)
+	if trx.FeeGranter != payer {
+		t.Fatalf("unexpected fee granter: %+v", trx)
+	}
+	result = &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress)
+	if list := result.extractData[sender]; len(list) != 1 || len(list[0].TxInputs) != 1 || list[0].TxInputs[0].Amount != "1" || list[0].Transaction.Fees != "0" {
+		t.Errorf("sender should not pay the granted fee: %+v", list)
+	}
+	if list := result.extractData[payer]; len(list) != 0 {
+		t.Errorf("granter fee should not be recorded: %+v", list)
+	}
+
+	//没有指定时由发送地址支付
+	trx = newTx(`"payer":"","granter":""`)
+	result = &ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.extractTransaction(trx, result, scanAddress)
+	if list := result.extractData[sender]; len(list) != 1 || len(list[0].TxInputs) != 2 || list[0].Transaction.Fees != "0.0025" {
+		t.Errorf("sender should pay the fee: %+v", list)
+	}
+}
+
+//memoryBlockchainDAI 内存中的区块数据，记录保存区块的顺序
+type memoryBlockchainDAI struct {
+	openwallet.BlockchainDAIBase
+	mu      sync.Mutex
+	current *openwallet.BlockHeader
+	blocks  map[uint64]*openwallet.BlockHeader
+	saved   []uint64
+	unscan  []*openwallet.UnscanRecord
+}
+
+func newMemoryBlockchainDAI(height uint64, hash string) *memoryBlockchainDAI {
+	return &memoryBlockchainDAI{
+		current: &openwallet.BlockHeader{Height: height, Hash: hash},
+		blocks:  make(map[uint64]*openwallet.BlockHeader),
+	}
+}
+
+func (dai *memoryBlockchainDAI) SaveCurrentBlockHead(header *openwallet.BlockHeader) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	dai.current = header
+	return nil
+}
+
+func (dai *memoryBlockchainDAI) GetCurrentBlockHead(symbol string) (*openwallet.BlockHeader, error) {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	return dai.current, nil
+}
+
+func (dai *memoryBlockchainDAI) SaveLocalBlockHead(header *openwallet.BlockHeader) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	dai.blocks[header.Height] = header
+	dai.saved = append(dai.saved, header.Height)
+	return nil
+}
+
+func (dai *memoryBlockchainDAI) GetLocalBlockHeadByHeight(height uint64, symbol string) (*openwallet.BlockHeader, error) {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	header, ok := dai.blocks[height]
+	if !ok {
+		return nil, storm.ErrNotFound
+	}
+	return header, nil
+}
+
+func (dai *memoryBlockchainDAI) SaveUnscanRecord(record *openwallet.UnscanRecord) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	dai.unscan = append(dai.unscan, record)
+	return nil
+}
+
+func (dai *memoryBlockchainDAI) DeleteUnscanRecordByHeight(height uint64, symbol string) error {
+	return nil
+}
+
+func (dai *memoryBlockchainDAI) DeleteUnscanRecordByID(id string, symbol string) error {
+	return nil
+}
+
+func (dai *memoryBlockchainDAI) GetUnscanRecords(symbol string) ([]*openwallet.UnscanRecord, error) {
+	return nil, nil
+}
+
+//extractObserver 记录提取结果通知的区块高度和分叉区块
+type extractObserver struct {
+	mu      sync.Mutex
+	heights []uint64
+	forks   []*openwallet.BlockHeader
+}
+
+func (o *extractObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if header.Fork {
+		o.forks = append(o.forks, header)
+	}
+	return nil
+}
+
+//waitForks 等待异步通知的分叉区块
+func (o *extractObserver) waitForks(count int) []*openwallet.BlockHeader {
+	for i := 0; i < 100; i++ {
+		o.mu.Lock()
+		forks := o.forks
+		o.mu.Unlock()
+		if len(forks) >= count {
+			return forks
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return o.forks
+}
+
+func (o *extractObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.heights = append(o.heights, data.Transaction.BlockHeight)
+	return nil
+}
+
+func (o *extractObserver) BlockExtractSmartContractDataNotify(sourceKey string, data *openwallet.SmartContractReceipt) error {
+	return nil
+}
+
+//testChain 模拟节点的区块和交易，每个区块一笔转入，区块hash为H{高度}，高度越低响应越慢
+type testChain struct {
+	mu       sync.Mutex
+	latest   uint64
+	hashes   map[uint64]string
+	inflight int
+	maxBlock int
+	noSearch bool //不支持按高度搜索交易
+	txCalls  int  //按哈希查询交易的次数
+}
+
+func (c *testChain) hash(height uint64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hash, ok := c.hashes[height]; ok {
+		return hash
+	}
+	return fmt.Sprintf("H%d", height)
+}
+
+func (c *testChain) txid(height uint64) (string, string) {
+	raw := []byte(fmt.Sprintf("tx-%d", height))
+	return base64.StdEncoding.EncodeToString(raw), strings.ToUpper(hex.EncodeToString(owcrypt.Hash(raw, 0, owcrypt.HASH_ALG_SHA256)))
+}
+
+func (c *testChain) txJSON(height uint64) (string, string) {
+	_, txid := c.txid(height)
+	tx := fmt.Sprintf(`{"body":{"messages":[{"@type":"/cosmos.bank.v1beta1.MsgSend","from_address":"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",`+
+		`"to_address":"cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9","amount":[{"denom":"uatom","amount":"%d"}]}]},"auth_info":{"fee":{"amount":[]}}}`, height*1000000)
+	txResponse := fmt.Sprintf(`{"height":"%d","txhash":"%s","code":0}`, height, txid)
+	return tx, txResponse
+}
+
+func (c *testChain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/blocks/latest":
+		fmt.Fprintf(w, `{"block":{"header":{"height":"%d"}}}`, c.latest)
+	case strings.HasPrefix(r.URL.Path, "/blocks/"):
+		height, _ := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/blocks/"), 10, 64)
+		c.mu.Lock()
+		c.inflight++
+		if c.inflight > c.maxBlock {
+			c.maxBlock = c.inflight
+		}
+		c.mu.Unlock()
+		if height <= c.latest {
+			time.Sleep(time.Duration(c.latest-height) * 5 * time.Millisecond)
+		}
+		c.mu.Lock()
+		c.inflight--
+		c.mu.Unlock()
+		tx, _ := c.txid(height)
+		fmt.Fprintf(w, `{"block_id":{"hash":"%s"},"block":{"header":{"height":"%d","last_block_id":{"hash":"%s"}},"data":{"txs":["%s"]}}}`,
+			c.hash(height), height, c.hash(height-1), tx)
+	case r.URL.Path == "/cosmos/tx/v1beta1/txs" && !c.noSearch:
+		height, _ := strconv.ParseUint(strings.TrimPrefix(r.URL.Query().Get("events"), "tx.height="), 10, 64)
+		tx, txResponse := c.txJSON(height)
+		fmt.Fprintf(w, `{"txs":[%s],"tx_responses":[%s],"pagination":{"next_key":null,"total":"1"}}`, tx, txResponse)
+	case strings.HasPrefix(r.URL.Path, "/cosmos/tx/v1beta1/txs/"):
+		c.mu.Lock()
+		c.txCalls++
+		c.mu.Unlock()
+		txid := strings.TrimPrefix(r.URL.Path, "/cosmos/tx/v1beta1/txs/")
+		for height := uint64(1); height <= c.latest; height++ {
+			if _, id := c.txid(height); strings.EqualFold(id, txid) {
+				tx, txResponse := c.txJSON(height)
+				fmt.Fprintf(w, `{"tx":%s,"tx_response":%s}`, tx, txResponse)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestChainScanner(t *testing.T, chain *testChain, dai *memoryBlockchainDAI) (*ATOMBlockScanner, *extractObserver) {
+	server := httptest.NewServer(chain)
+	t.Cleanup(server.Close)
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.Config.TxType = "cosmos-sdk/StdTx"
+	wm.Config.MsgType = "/cosmos.bank.v1beta1.MsgSend"
+	wm.RestClient = NewClient(server.URL, false)
+	bs := wm.Blockscanner
+	bs.SetBlockchainDAI(dai)
+	bs.SetBlockScanTargetFuncV2(func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"}
+	})
+	observer := &extractObserver{}
+	bs.AddObserver(observer)
+	bs.Scanning = true
+	return bs, observer
+}
+
+func Test_ScanBlockTask_prefetch(t *testing.T) {
+	chain := &testChain{latest: 12, hashes: make(map[uint64]string)}
+	dai := newMemoryBlockchainDAI(1, "H1")
+	bs, observer := newTestChainScanner(t, chain, dai)
+	bs.wm.Config.PrefetchBlocks = 4
+
+	bs.ScanBlockTask()
+
+	//区块并发预取，高度越低响应越慢，仍按高度顺序提交和通知
+	if chain.maxBlock < 2 {
+		t.Errorf("blocks should be fetched concurrently, max in flight: %d", chain.maxBlock)
+	}
+	if dai.current.Height != 12 || dai.current.Hash != "H12" {
+		t.Errorf("unexpected scanned block: %+v", dai.current)
+	}
+	if len(dai.saved) != 11 {
+		t.Fatalf("expected 11 saved blocks, got %v", dai.saved)
+	}
+	for i, height := range dai.saved {
+		if height != uint64(i+2) {
+			t.Fatalf("blocks should be saved in height order: %v", dai.saved)
+		}
+	}
+	//最后重扫上一个区块
+	if len(observer.heights) != 12 || observer.heights[11] != 11 {
+		t.Fatalf("unexpected extract notifications: %v", observer.heights)
+	}
+	for i, height := range observer.heights[:11] {
+		if height != uint64(i+2) {
+			t.Fatalf("extract data should be notified in height order: %v", observer.heights)
+		}
+	}
+	if len(dai.unscan) != 0 {
+		t.Errorf("unexpected unscan records: %+v", dai.unscan)
+	}
+	//区块的交易通过按高度搜索获取，不逐个查询
+	if chain.txCalls != 0 {
+		t.Errorf("transactions should be fetched by block search, single calls: %d", chain.txCalls)
+	}
+}
+
+func Test_ScanBlockTask_scanWorkers(t *testing.T) {
+	chain := &testChain{latest: 4, hashes: make(map[uint64]string)}
+	dai := newMemoryBlockchainDAI(1, "H1")
+	bs, _ := newTestChainScanner(t, chain, dai)
+	//创建扫描器之后加载的配置决定扫描工作令牌的数量
+	bs.wm.Config.ScanWorkers = 3
+
+	bs.ScanBlockTask()
+
+	if dai.current.Height != 4 {
+		t.Errorf("unexpected scanned block: %+v", dai.current)
+	}
+	if tokens := bs.getExtractingCH(); cap(tokens) != 3 || len(tokens) != 0 {
+		t.Errorf("unexpected extracting tokens: %d, in use: %d", cap(tokens), len(tokens))
+	}
+}
+
+func Test_ScanBlockTask_noSearch(t *testing.T) {
+	chain := &testChain{latest: 5, hashes: make(map[uint64]string), noSearch: true}
+	dai := newMemoryBlockchainDAI(1, "H1")
+	bs, observer := newTestChainScanner(t, chain, dai)
+
+	bs.ScanBlockTask()
+
+	//节点不支持搜索时逐个查询交易
+	if dai.current.Height != 5 || len(observer.heights) != 5 || chain.txCalls != 5 {
+		t.Errorf("unexpected scan result: %+v, notifications: %v, single calls: %d", dai.current, observer.heights, chain.txCalls)
+	}
+}
+
+func Test_ScanBlockTask_fork(t *testing.T) {
+	//本地已扫描到高度10，链上从高度8开始被替换
+	chain := &testChain{latest: 12, hashes: make(map[uint64]string)}
+	for height := uint64(8); height <= 12; height++ {
+		chain.hashes[height] = fmt.Sprintf("F%d", height)
+	}
+	dai := newMemoryBlockchainDAI(10, "H10")
+	for height := uint64(1); height <= 10; height++ {
+		dai.SaveLocalBlockHead(&openwallet.BlockHeader{Height: height, Hash: fmt.Sprintf("H%d", height),
+			Previousblockhash: fmt.Sprintf("H%d", height-1), Time: 1600000000 + height})
+	}
+	dai.saved = nil
+	bs, observer := newTestChainScanner(t, chain, dai)
+	bs.wm.Config.PrefetchBlocks = 3
+
+	bs.ScanBlockTask()
+
+	//回退到共同祖先7，分叉的8至10都按本地保存的区块通知
+	forks := observer.waitForks(3)
+	if len(forks) != 3 {
+		t.Fatalf("expected 3 fork notifications, got %d", len(forks))
+	}
+	for i, fork := range forks {
+		height := uint64(10 - i)
+		if fork.Height != height || fork.Hash != fmt.Sprintf("H%d", height) || !fork.Fork ||
+			fork.Previousblockhash != fmt.Sprintf("H%d", height-1) || fork.Time != 1600000000+height {
+			t.Errorf("unexpected fork block: %+v", fork)
+		}
+	}
+	if dai.current.Height != 12 || dai.current.Hash != "F12" {
+		t.Errorf("unexpected scanned block: %+v", dai.current)
+	}
+	for height := uint64(8); height <= 12; height++ {
+		if dai.blocks[height].Hash != fmt.Sprintf("F%d", height) {
+			t.Errorf("block on height %d should be rescanned: %+v", height, dai.blocks[height])
+		}
+	}
+}
+
+func Test_ScanBlockTask_forkMissingLocalBlock(t *testing.T) {
+	chain := &testChain{latest: 12, hashes: make(map[uint64]string)}
+	for height := uint64(8); height <= 12; height++ {
+		chain.hashes[height] = fmt.Sprintf("F%d", height)
+	}
+	//本地缺少高度9的区块
+	dai := newMemoryBlockchainDAI(10, "H10")
+	for height := uint64(1); height <= 10; height++ {
+		if height != 9 {
+			dai.SaveLocalBlockHead(&openwallet.BlockHeader{Height: height, Hash: fmt.Sprintf("H%d", height)})
+		}
+	}
+	dai.saved = nil
+	bs, observer := newTestChainScanner(t, chain, dai)
+
+	bs.ScanBlockTask()
+
+	//无法继续比较时以链上的区块9作为扫描起点，只通知本地保存的区块10
+	forks := observer.waitForks(1)
+	if len(forks) != 1 || forks[0].Height != 10 || forks[0].Hash != "H10" {
+		t.Fatalf("unexpected fork notifications: %+v", forks)
+	}
+	if dai.current.Height != 12 || dai.current.Hash != "F12" || dai.blocks[10].Hash != "F10" {
+		t.Errorf("unexpected scanned block: %+v", dai.current)
+	}
+}
+
+func Test_ScanBlockTask_forkTooDeep(t *testing.T) {
+	chain := &testChain{latest: 12, hashes: make(map[uint64]string)}
+	for height := uint64(5); height <= 12; height++ {
+		chain.hashes[height] = fmt.Sprintf("F%d", height)
+	}
+	dai := newMemoryBlockchainDAI(10, "H10")
+	for height := uint64(1); height <= 10; height++ {
+		dai.SaveLocalBlockHead(&openwallet.BlockHeader{Height: height, Hash: fmt.Sprintf("H%d", height)})
+	}
+	dai.saved = nil
+	bs, observer := newTestChainScanner(t, chain, dai)
+	bs.wm.Config.MaxRewindDepth = 3
+
+	bs.ScanBlockTask()
+
+	//超过最大回退深度时停止扫描，不修改扫描起点
+	if dai.current.Height != 10 || dai.current.Hash != "H10" || len(dai.saved) != 0 {
+		t.Errorf("scanner should stop on deep fork: %+v, saved: %v", dai.current, dai.saved)
+	}
+	if forks := observer.waitForks(0); len(forks) != 0 {
+		t.Errorf("unexpected fork notifications: %d", len(forks))
+	}
+}
+
+func Test_getBlockTransactions(t *testing.T) {
+	pages := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		if r.URL.Query().Get("events") != "tx.height=1024" {
+			t.Errorf("unexpected events: %s", r.URL.Query().Get("events"))
+		}
+		//每页最多2个，共3个交易
+		switch r.URL.Query().Get("pagination.offset") {
+		case "0":
+			fmt.Fprint(w, `{"txs":[{"body":{"memo":"a"}},{"body":{"memo":"b"}}],"tx_responses":[{"txhash":"AA","height":"1024"},{"txhash":"BB","height":"1024"}],"pagination":{"next_key":null,"total":"3"}}`)
+		case "2":
+			fmt.Fprint(w, `{"txs":[{"body":{"memo":"c"}}],"tx_responses":[{"txhash":"CC","height":"1024"}],"pagination":{"next_key":null,"total":"3"}}`)
+		default:
+			t.Errorf("unexpected offset: %s", r.URL.Query().Get("pagination.offset"))
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	txs, err := NewClient(server.URL, false).getBlockTransactions(1024)
+	if err != nil || len(txs) != 3 || pages != 2 {
+		t.Fatalf("unexpected block transactions: %v, %v, pages: %d", txs, err, pages)
+	}
+	for txid, memo := range map[string]string{"AA": "a", "BB": "b", "CC": "c"} {
+		trans, ok := txs[txid]
+		if !ok || trans.Get("tx.body.memo").String() != memo || trans.Get("tx_response.txhash").String() != txid {
+			t.Errorf("unexpected transaction %s: %v", txid, trans)
+		}
+	}
+}
+
 //func TestWallet_GetRecharges(t *testing.T) {
 //	accountID := "WFvvr5q83WxWp1neUMiTaNuH7ZbaxJFpWu"
 //	wallet, err := tw.GetWalletInfo(accountID)
@@ -20,9 +20,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/asdine/storm"
@@ -32,10 +34,13 @@ import (
 	gosocketio "github.com/graarh/golang-socketio"
 	"github.com/graarh/golang-socketio/transport"
 	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
 )
 
 const (
-	maxExtractingSize = 20 //并发的扫描线程数
+	defaultScanWorkers    = 20 //默认并发的扫描线程数
+	defaultPrefetchBlocks = 10 //默认预取的区块数
+	defaultMaxRewindDepth = 100 //默认分叉时最多回退的区块数
 )
 
 //ATOMBlockScanner atom的区块链扫描器
@@ -43,7 +48,8 @@ type ATOMBlockScanner struct {
 	*openwallet.BlockScannerBase
 
 	CurrentBlockHeight   uint64             //当前区块高度
-	extractingCH         chan struct{}      //扫描工作令牌
+	extractingCH         chan struct{}      //扫描工作令牌，首次提取交易时按配置的scanWorkers创建
+	extractingMu         sync.Mutex         //保护扫描工作令牌的创建
 	wm                   *WalletManager     //钱包管理者
 	IsScanMemPool        bool               //是否扫描交易池
 	RescanLastBlockCount uint64             //重扫上N个区块数量
@@ -53,7 +59,7 @@ type ATOMBlockScanner struct {
 
 //ExtractResult 扫描完成的提取结果
 type ExtractResult struct {
-	extractData map[string]*openwallet.TxExtractData
+	extractData map[string][]*openwallet.TxExtractData
 	TxID        string
 	BlockHeight uint64
 	Success     bool
@@ -66,13 +72,22 @@ type SaveResult struct {
 	Success     bool
 }
 
+//prefetchedBlock 预取的区块和其中交易的提取结果，按高度提交时才通知和保存
+type prefetchedBlock struct {
+	height     uint64
+	block      *Block
+	results    []ExtractResult
+	err        error //获取区块失败
+	extractErr error //提取区块中的交易失败
+	done       chan struct{}
+}
+
 //NewATOMBlockScanner 创建区块链扫描器
 func NewATOMBlockScanner(wm *WalletManager) *ATOMBlockScanner {
 	bs := ATOMBlockScanner{
 		BlockScannerBase: openwallet.NewBlockScannerBase(),
 	}
 
-	bs.extractingCH = make(chan struct{}, maxExtractingSize)
 	bs.wm = wm
 	bs.IsScanMemPool = bs.wm.Config.IsScanMemPool
 	bs.RescanLastBlockCount = 1
@@ -112,7 +127,16 @@ func (bs *ATOMBlockScanner) ScanBlockTask() {
 
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
-	var previousHeight uint64 = 0
+	window := bs.wm.Config.PrefetchBlocks
+	if window == 0 {
+		window = 1
+	}
+
+	var (
+		queue      = make([]*prefetchedBlock, 0, window) //预取队列，按高度顺序提交
+		nextHeight = currentHeight + 1                   //下一个预取的高度
+		maxHeight  uint64
+	)
 
 	for {
 
@@ -121,117 +145,176 @@ func (bs *ATOMBlockScanner) ScanBlockTask() {
 			return
 		}
 
-		//获取最大高度
-		maxHeight, err := bs.wm.GetBlockHeight()
-		if err != nil {
-			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
-			break
+		//预取的区块都已提交时，重新获取最大高度
+		if len(queue) == 0 {
+			maxHeight, err = bs.wm.GetBlockHeight()
+			if err != nil {
+				//下一个高度找不到会报异常
+				bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
+				break
+			}
+
+			//是否已到最新高度
+			if currentHeight >= maxHeight {
+				bs.wm.Log.Std.Info("block scanner has scanned full chain data. Current height: %d", maxHeight)
+				break
+			}
 		}
 
-		//是否已到最新高度
-		if currentHeight >= maxHeight {
-			bs.wm.Log.Std.Info("block scanner has scanned full chain data. Current height: %d", maxHeight)
-			break
+		//补满预取窗口，区块和交易并发获取
+		for uint64(len(queue)) < window && nextHeight <= maxHeight {
+			queue = append(queue, bs.prefetchBlock(nextHeight))
+			nextHeight++
 		}
 
 		//继续扫描下一个区块
-		currentHeight = currentHeight + 1
-		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
+		pb := queue[0]
+		queue = queue[1:]
+		<-pb.done
+		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", pb.height)
 
-		localBlock, err := bs.wm.RestClient.getBlockByHeight(currentHeight)
-		if err != nil {
-			bs.wm.Log.Std.Info("getBlockByHeight failed; unexpected error: %v", err)
+		if pb.err != nil {
+			bs.wm.Log.Std.Info("getBlockByHeight failed; unexpected error: %v", pb.err)
 			break
 		}
-
-		isFork := false
+		localBlock := pb.block
 
 		//判断hash是否上一区块的hash
 		if currentHash != localBlock.PrevBlockHash {
-			previousHeight = currentHeight - 1
-			bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
-			bs.wm.Log.Std.Info("block height: %d local hash = %s ", previousHeight, currentHash)
-			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", previousHeight, localBlock.PrevBlockHash)
-
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", previousHeight)
-
-			//删除上一区块链的所有充值记录
-			//bs.DeleteRechargesByHeight(currentHeight - 1)
-			forkBlock, _ := bs.GetLocalBlock(uint32(previousHeight))
-			//删除上一区块链的未扫记录
-			bs.wm.Blockscanner.DeleteUnscanRecord(uint32(previousHeight))
-			currentHeight = previousHeight - 1 //倒退2个区块重新扫描
-			if currentHeight <= 0 {
-				currentHeight = 1
+			currentHeight, currentHash, err = bs.rewindForkedBlock(pb.height, currentHash, localBlock)
+			if err != nil {
+				break
 			}
+			//丢弃分叉后预取的区块，从新的起点重新预取
+			queue = queue[:0]
+			nextHeight = currentHeight + 1
+			continue
+		}
 
-			localBlock, err = bs.GetLocalBlock(uint32(currentHeight))
-			if err != nil && err != storm.ErrNotFound {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
-				break
-			} else if err == storm.ErrNotFound {
-				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+		err = bs.saveExtractResults(localBlock.Height, pb.results, pb.extractErr)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+		}
 
-				localBlock, err = bs.wm.RestClient.getBlockByHeight(currentHeight)
-				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
-				}
+		//重置当前区块的hash
+		currentHeight = pb.height
+		currentHash = localBlock.Hash
 
-			}
+		//保存本地新高度
+		bs.wm.Blockscanner.SaveLocalNewBlock(currentHeight, currentHash)
+		bs.SaveLocalBlock(localBlock)
 
-			//重置当前区块的hash
-			currentHash = localBlock.Hash
+		//通知新区块给观测者，异步处理
+		bs.newBlockNotify(localBlock, false)
+	}
 
-			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
+	//重扫前N个块，为保证记录找到
+	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
+		bs.scanBlock(i)
+	}
 
-			//重新记录一个新扫描起点
-			bs.wm.Blockscanner.SaveLocalNewBlock(localBlock.Height, localBlock.Hash)
+	if bs.IsScanMemPool {
+		//扫描交易内存池
+		bs.ScanTxMemPool()
+	}
 
-			isFork = true
+	//重扫失败区块
+	bs.RescanFailedRecord()
 
-			if forkBlock != nil {
-				//通知分叉区块给观测者，异步处理
-				bs.newBlockNotify(forkBlock, isFork)
-			}
+}
 
-		} else {
+//prefetchBlock 异步获取区块并提取其中的交易，提取结果在按高度提交时才通知和保存
+func (bs *ATOMBlockScanner) prefetchBlock(height uint64) *prefetchedBlock {
+	pb := &prefetchedBlock{height: height, done: make(chan struct{})}
+	go func() {
+		defer close(pb.done)
+		pb.block, pb.err = bs.wm.RestClient.getBlockByHeight(height)
+		if pb.err != nil {
+			return
+		}
+		pb.results, pb.extractErr = bs.extractTransactions(pb.block.Height, pb.block.Hash, pb.block.Transactions, pb.block, false)
+	}()
+	return pb
+}
 
-			err = bs.BatchExtractTransaction(localBlock.Height, localBlock.Hash, localBlock.Transactions, false)
-			if err != nil {
-				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
-			}
+//rewindForkedBlock 区块的上一区块hash与本地不一致时，沿本地保存的区块向前查找与链上hash一致的共同祖先，
+//回退深度不超过maxRewindDepth。共同祖先之后的本地区块都作为分叉区块通知，返回共同祖先作为新的扫描起点
+func (bs *ATOMBlockScanner) rewindForkedBlock(currentHeight uint64, currentHash string, block *Block) (uint64, string, error) {
+	bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
+	bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
+	bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.PrevBlockHash)
 
-			//重置当前区块的hash
-			currentHash = localBlock.Hash
+	maxDepth := bs.wm.Config.MaxRewindDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxRewindDepth
+	}
 
-			//保存本地新高度
-			bs.wm.Blockscanner.SaveLocalNewBlock(currentHeight, currentHash)
-			bs.SaveLocalBlock(localBlock)
+	var (
+		orphans   = make([]*Block, 0)
+		height    = currentHeight - 1
+		chainHash = block.PrevBlockHash //链上的区块hash
+	)
 
-			isFork = false
+	//本地记录的区块，通知时带上保存的区块数据
+	localBlock, err := bs.GetLocalBlock(uint32(height))
+	if err != nil && err != storm.ErrNotFound {
+		bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+		return 0, "", err
+	} else if err == storm.ErrNotFound || localBlock == nil {
+		bs.wm.Log.Std.Warning("block scanner has no local block on height: %d, recharge records on this block are not checked", height)
+		localBlock = &Block{Hash: currentHash, Height: height}
+	}
 
-			//通知新区块给观测者，异步处理
-			bs.newBlockNotify(localBlock, isFork)
+	for localBlock.Hash != chainHash {
+		//本地区块已被链上的区块替换
+		orphans = append(orphans, localBlock)
+		if uint64(len(orphans)) > maxDepth {
+			err := fmt.Errorf("block fork on height: %d is deeper than max rewind depth: %d", currentHeight, maxDepth)
+			bs.wm.Log.Std.Error("block scanner can not find common ancestor; unexpected error: %v", err)
+			return 0, "", err
 		}
+		if height <= 1 {
+			err := fmt.Errorf("block fork on height: %d has no common ancestor", currentHeight)
+			bs.wm.Log.Std.Error("block scanner can not find common ancestor; unexpected error: %v", err)
+			return 0, "", err
+		}
+		height--
 
+		prevBlock, err := bs.wm.RestClient.getBlockByHeight(height)
+		if err != nil {
+			bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
+			return 0, "", err
+		}
+		chainHash = prevBlock.Hash
+
+		localBlock, err = bs.GetLocalBlock(uint32(height))
+		if err != nil && err != storm.ErrNotFound {
+			bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+			return 0, "", err
+		} else if err == storm.ErrNotFound || localBlock == nil {
+			//本地没有保存更早的区块，无法继续比较，以链上的区块作为扫描起点
+			bs.wm.Log.Std.Warning("block scanner has no local block on height: %d, recharge records on this block are not checked, rescan from mainnet block", height)
+			break
+		}
 	}
 
-	//重扫前N个块，为保证记录找到
-	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
-		bs.scanBlock(i)
-	}
+	bs.wm.Log.Std.Info("block fork common ancestor height: %d, hash: %s, rewind %d blocks.", height, chainHash, len(orphans))
 
-	if bs.IsScanMemPool {
-		//扫描交易内存池
-		bs.ScanTxMemPool()
-	}
+	//重新记录一个新扫描起点
+	bs.wm.Blockscanner.SaveLocalNewBlock(height, chainHash)
 
-	//重扫失败区块
-	bs.RescanFailedRecord()
+	for _, orphan := range orphans {
+		bs.wm.Log.Std.Info("delete recharge records on block height: %d, orphaned hash: %s.", orphan.Height, orphan.Hash)
+
+		//删除分叉区块的未扫记录
+		bs.wm.Blockscanner.DeleteUnscanRecord(uint32(orphan.Height))
 
+		//通知分叉区块给观测者，异步处理
+		bs.newBlockNotify(orphan, true)
+	}
+
+	bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", height+1, chainHash)
+	return height, chainHash, nil
 }
 
 //ScanBlock 扫描指定高度区块
@@ -261,7 +344,8 @@ func (bs *ATOMBlockScanner) scanBlock(height uint64) (*Block, error) {
 
 	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Height)
 
-	err = bs.BatchExtractTransaction(block.Height, block.Hash, block.Transactions, false)
+	results, err := bs.extractTransactions(block.Height, block.Hash, block.Transactions, block, false)
+	err = bs.saveExtractResults(block.Height, results, err)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
@@ -323,13 +407,14 @@ func (bs *ATOMBlockScanner) RescanFailedRecord() {
 	for height, txs := range blockMap {
 
 		var hash string
+		var block *Block
 
 		if height != 0 {
 			bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", height)
 
 			if len(txs) == 0 {
 
-				block, err := bs.wm.RestClient.getBlockByHeight(height)
+				block, err = bs.wm.RestClient.getBlockByHeight(height)
 				if err != nil {
 					bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 					continue
@@ -338,7 +423,8 @@ func (bs *ATOMBlockScanner) RescanFailedRecord() {
 				txs = block.Transactions
 			}
 
-			err = bs.BatchExtractTransaction(height, hash, txs, false)
+			results, extractErr := bs.extractTransactions(height, hash, txs, block, false)
+			err = bs.saveExtractResults(height, results, extractErr)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 				continue
@@ -362,121 +448,122 @@ func (bs *ATOMBlockScanner) newBlockNotify(block *Block, isFork bool) {
 //BatchExtractTransaction 批量提取交易单
 //bitcoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
 func (bs *ATOMBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string, txs []string, memPool bool) error {
+	results, err := bs.extractTransactions(blockHeight, blockHash, txs, nil, memPool)
+	return bs.saveExtractResults(blockHeight, results, err)
+}
 
-	var (
-		quit       = make(chan struct{})
-		done       = 0 //完成标记
-		failed     = 0
-		shouldDone = len(txs) //需要完成的总数
-	)
+//extractTransactions 多线程提取交易单，并发数由扫描工作令牌限制，结果按交易在区块中的顺序返回。
+//block为已获取的区块，按事件扫块时从中解析交易，为nil时（如重扫部分交易）重新获取区块
+func (bs *ATOMBlockScanner) extractTransactions(blockHeight uint64, blockHash string, txs []string, block *Block, memPool bool) ([]ExtractResult, error) {
 
 	if len(txs) == 0 {
-		return nil
-		// return errors.New("BatchExtractTransaction block is nil.")
+		return nil, nil
 	}
 
-	//生产通道
-	producer := make(chan ExtractResult)
-	defer close(producer)
-
-	//消费通道
-	worker := make(chan ExtractResult)
-	defer close(worker)
-
-	//保存工作
-	saveWork := func(height uint64, result chan ExtractResult) {
-		//回收创建的地址
-		for gets := range result {
-
-			if gets.Success {
-
-				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
-				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
-				if notifyErr != nil {
-					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
-				}
-			} else {
-				//记录未扫区块
-				unscanRecord := openwallet.NewUnscanRecord(height, "", "", bs.wm.Symbol())
-				bs.SaveUnscanRecord(unscanRecord)
-				bs.wm.Log.Std.Info("block height: %d extract failed.", height)
-				failed++ //标记保存失败数
-			}
-			//累计完成的线程数
-			done++
-			if done == shouldDone {
-				//bs.wm.Log.Std.Info("done = %d, shouldDone = %d ", done, len(txs))
-				close(quit) //关闭通道，等于给通道传入nil
+	//按事件扫块时，先解析区块中的每个交易
+	var eventTxs map[string]*Transaction
+	if bs.wm.Config.ScanMode == ScanModeEvents && !memPool && blockHeight > 0 {
+		var err error
+		if block == nil {
+			block, err = bs.wm.RestClient.getBlockByHeight(blockHeight)
+			if err != nil {
+				return nil, err
 			}
 		}
+		eventTxs, err = bs.getBlockEventTransactions(block)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	//提取工作
-	extractWork := func(eblockHeight uint64, eBlockHash string, mTxs []string, eProducer chan ExtractResult) {
-		for _, txid := range mTxs {
-			bs.extractingCH <- struct{}{}
-			//shouldDone++
-			go func(mBlockHeight uint64, mTxid string, end chan struct{}, mProducer chan<- ExtractResult) {
-
-				//导出提出的交易
-				mProducer <- bs.ExtractTransaction(mBlockHeight, eBlockHash, mTxid, bs.ScanTargetFunc, memPool)
-				//释放
-				<-end
-
-			}(eblockHeight, txid, bs.extractingCH, eProducer)
+	//按消息扫块时，一次搜索区块的全部交易，搜索失败或缺少的交易再逐个获取
+	var blockTxs map[string]*gjson.Result
+	if eventTxs == nil && !memPool && blockHeight > 0 {
+		var err error
+		blockTxs, err = bs.wm.RestClient.getBlockTransactions(blockHeight)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not search transactions of block height: %d; unexpected error: %v", blockHeight, err)
 		}
 	}
 
-	/*	开启导出的线程	*/
-
-	//独立线程运行消费
-	go saveWork(blockHeight, worker)
-
-	//独立线程运行生产
-	go extractWork(blockHeight, blockHash, txs, producer)
-
-	//以下使用生产消费模式
-	bs.extractRuntime(producer, worker, quit)
-
-	if failed > 0 {
-		return fmt.Errorf("block scanner saveWork failed")
-	} else {
-		return nil
+	var (
+		results = make([]ExtractResult, len(txs))
+		tokens  = bs.getExtractingCH()
+		wg      sync.WaitGroup
+	)
+	for i, txid := range txs {
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func(index int, mTxid string) {
+			defer func() {
+				//释放
+				<-tokens
+				wg.Done()
+			}()
+
+			//导出提出的交易
+			if eventTxs != nil {
+				if trx, ok := eventTxs[strings.ToLower(mTxid)]; ok {
+					results[index] = bs.extractTransactionByEvents(trx, bs.ScanTargetFuncV2)
+				} else {
+					bs.wm.Log.Std.Info("block scanner can not find transaction: %s in block height: %d", mTxid, blockHeight)
+					results[index] = ExtractResult{BlockHeight: blockHeight, TxID: mTxid, Success: false}
+				}
+			} else if trans, ok := blockTxs[strings.ToUpper(mTxid)]; ok {
+				results[index] = bs.extractBlockTransaction(blockHeight, blockHash, mTxid, trans)
+			} else {
+				results[index] = bs.ExtractTransaction(blockHeight, blockHash, mTxid, bs.ScanTargetFunc, memPool)
+			}
+		}(i, txid)
 	}
+	wg.Wait()
+	return results, nil
+}
 
-	//return nil
+//getExtractingCH 获取扫描工作令牌，加载配置后首次提取交易时按scanWorkers创建，之后多个预取的区块共用
+func (bs *ATOMBlockScanner) getExtractingCH() chan struct{} {
+	bs.extractingMu.Lock()
+	defer bs.extractingMu.Unlock()
+	if bs.extractingCH == nil {
+		workers := bs.wm.Config.ScanWorkers
+		if workers <= 0 {
+			workers = defaultScanWorkers
+		}
+		bs.extractingCH = make(chan struct{}, workers)
+	}
+	return bs.extractingCH
 }
 
-//extractRuntime 提取运行时
-func (bs *ATOMBlockScanner) extractRuntime(producer chan ExtractResult, worker chan ExtractResult, quit chan struct{}) {
+//saveExtractResults 通知提取结果，提取失败时记录未扫区块
+func (bs *ATOMBlockScanner) saveExtractResults(blockHeight uint64, results []ExtractResult, extractErr error) error {
 
-	var (
-		values = make([]ExtractResult, 0)
-	)
+	if extractErr != nil {
+		unscanRecord := openwallet.NewUnscanRecord(blockHeight, "", extractErr.Error(), bs.wm.Symbol())
+		bs.SaveUnscanRecord(unscanRecord)
+		return extractErr
+	}
 
-	for {
-		var activeWorker chan<- ExtractResult
-		var activeValue ExtractResult
-		//当数据队列有数据时，释放顶部，传输给消费者
-		if len(values) > 0 {
-			activeWorker = worker
-			activeValue = values[0]
-		}
-		select {
-		//生成者不断生成数据，插入到数据队列尾部
-		case pa := <-producer:
-			values = append(values, pa)
-		case <-quit:
-			//退出
-			//bs.wm.Log.Std.Info("block scanner have been scanned!")
-			return
-		case activeWorker <- activeValue:
-			values = values[1:]
+	failed := 0
+	for _, gets := range results {
+		if gets.Success {
+			notifyErr := bs.newExtractDataNotify(blockHeight, gets.extractData)
+			if notifyErr != nil {
+				failed++ //标记保存失败数
+				bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+			}
+		} else {
+			//记录未扫区块
+			unscanRecord := openwallet.NewUnscanRecord(blockHeight, "", "", bs.wm.Symbol())
+			bs.SaveUnscanRecord(unscanRecord)
+			bs.wm.Log.Std.Info("block height: %d extract failed.", blockHeight)
+			failed++ //标记保存失败数
 		}
 	}
-	//return
 
+	if failed > 0 {
+		return fmt.Errorf("block scanner saveWork failed")
+	}
+	return nil
 }
 
 //ExtractTransaction 提取交易单
@@ -486,7 +573,7 @@ func (bs *ATOMBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 		result = ExtractResult{
 			BlockHeight: blockHeight,
 			TxID:        txid,
-			extractData: make(map[string]*openwallet.TxExtractData),
+			extractData: make(map[string][]*openwallet.TxExtractData),
 			Success:     true,
 		}
 	)
@@ -514,10 +601,12 @@ func (bs *ATOMBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 		}
 	}
 
-	//优先使用传入的高度
+	//优先使用传入的高度和区块hash
 	if blockHeight > 0 && trx.BlockHeight == 0 {
 		trx.BlockHeight = blockHeight
-		///		trx.BlockHash = blockHash
+	}
+	if blockHeight > 0 && trx.BlockHeight == blockHeight {
+		trx.BlockHash = blockHash
 	}
 
 	bs.extractTransaction(trx, &result, bs.ScanTargetFuncV2)
@@ -526,6 +615,27 @@ func (bs *ATOMBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 
 }
 
+//extractBlockTransaction 提取搜索区块得到的交易单，不再查询交易内容
+func (bs *ATOMBlockScanner) extractBlockTransaction(blockHeight uint64, blockHash string, txid string, trans *gjson.Result) ExtractResult {
+	result := ExtractResult{
+		BlockHeight: blockHeight,
+		TxID:        txid,
+		extractData: make(map[string][]*openwallet.TxExtractData),
+		Success:     true,
+	}
+
+	trx := NewTransaction(trans, bs.wm.Config.TxType, bs.wm.Config.MsgType, "")
+	if trx.BlockHeight == 0 {
+		trx.BlockHeight = blockHeight
+	}
+	if trx.BlockHeight == blockHeight {
+		trx.BlockHash = blockHash
+	}
+
+	bs.extractTransaction(trx, &result, bs.ScanTargetFuncV2)
+	return result
+}
+
 // 从最小单位的 amount 转为带小数点的表示
 func convertToAmount(amount uint64) string {
 	amountStr := fmt.Sprintf("%d", amount)
@@ -544,209 +654,341 @@ func convertFromAmount(amountStr string) uint64 {
 	return uint64(r)
 }
 
-//ExtractTransactionData 提取交易单
+//ExtractTransactionData 提取交易单，每个denom生成一条交易记录，主币以外的denom作为合约资产
 func (bs *ATOMBlockScanner) extractTransaction(trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanTargetFuncV2) {
 	var (
-		success    = true
-		multiindex = uint64(0)
+		success = true
 	)
-	createAt := time.Now().Unix()
 	if trx == nil {
 		//记录哪个区块哪个交易单没有完成扫描
 		success = false
 	} else {
 
 		if success && trx.TxValue != nil {
-			isReceived := false
-			inputindex := 0
-			blockhash, _ := bs.wm.RestClient.getBlockHash(trx.BlockHeight)
-			from := ""
-			to := ""
-			fromArray := []string{}
-			toArray := []string{}
-			amountCount := uint64(0)
-			fee := "0"
-
-			status := "1"
-			reason := ""
-
-			for i, tx := range trx.TxValue {
-				//	if tx.Status == "true" {
-
-				if tx.Status != "true" {
-					status = "0"
-					reason = tx.Reason
+			//扫块时已知区块hash，不再重复查询
+			blockhash := trx.BlockHash
+			if blockhash == "" {
+				blockhash, _ = bs.wm.RestClient.getBlockHash(trx.BlockHeight)
+			}
+
+			//手续费记在手续费denom的交易记录中，由指定的支付方或首个属于钱包的发送地址支付，
+			//由授权方的额度支付时交易中的地址都不支付手续费
+			feeDenom := bs.wm.Config.Denom
+			feeAmount := big.NewInt(0)
+			if trx.FeeGranter == "" && trx.Fee != nil && trx.Fee[0].Amount != nil && trx.Fee[0].Amount.Sign() != 0 {
+				feeAmount = trx.Fee[0].Amount
+				if trx.Fee[0].Denom != "" {
+					feeDenom = trx.Fee[0].Denom
 				}
+			}
 
-				from = tx.From
-				targetResult := scanAddressFunc(openwallet.ScanTargetParam {
-					ScanTarget:     from,
-					Symbol:         bs.wm.Symbol(),
-					ScanTargetType: openwallet.ScanTargetTypeAccountAddress,
-				})
-
-				if targetResult.Exist {
-					input := openwallet.TxInput{}
-					input.TxID = trx.TxID
-					input.Address = from
-					input.Amount = convertToAmount(tx.Amount)
-					amountCount += tx.Amount
-					fromArray = append(fromArray, from+":"+input.Amount)
-					toArray = append(toArray, tx.To+":"+input.Amount)
-					input.Coin = openwallet.Coin{
-						Symbol:     bs.wm.Symbol(),
-						IsContract: false,
-					}
-					input.Index = uint64(inputindex)
-					inputindex++
-					input.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), "", input.Index)
-					input.CreateAt = createAt
-					input.BlockHeight = trx.BlockHeight
-					input.BlockHash = blockhash
-					input.IsMemo = true
-					input.Memo = trx.Memo
-					ed := result.extractData[targetResult.SourceKey]
-					if ed == nil {
-						ed = openwallet.NewBlockExtractData()
-						result.extractData[targetResult.SourceKey] = ed
-					}
-					ed.TxInputs = append(ed.TxInputs, &input)
-
-					if trx.Fee != nil && trx.Fee[0].Amount != 0 {
-						tmp := *&input
-						feeCharge := &tmp
-						feeCharge.Amount = convertToAmount(trx.Fee[i].Amount)
-						fee = feeCharge.Amount
-						fee = feeCharge.Amount
-						feeCharge.Index = uint64(inputindex)
-						inputindex++
-						feeCharge.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), "", feeCharge.Index)
-						ed.TxInputs = append(ed.TxInputs, feeCharge)
-					}
+			//执行失败的转账不记录，不需要其denom
+			denoms := make([]string, 0)
+			for _, tx := range trx.TxValue {
+				if tx.Status == "true" && !containsString(denoms, tx.Denom) {
+					denoms = append(denoms, tx.Denom)
 				}
+			}
+			//只转出其他denom时，手续费单独记一条交易
+			if feeAmount.Sign() > 0 && !containsString(denoms, feeDenom) {
+				denoms = append(denoms, feeDenom)
+			}
 
-				to = tx.To
-				targetResult = scanAddressFunc(openwallet.ScanTargetParam {
-					ScanTarget:     to,
-					Symbol:         bs.wm.Symbol(),
-					ScanTargetType: openwallet.ScanTargetTypeAccountAddress,
-				})
-
-
-				if targetResult.Exist {
-					isReceived = true
-					output := openwallet.TxOutPut{}
-					output.Received = true
-					output.TxID = trx.TxID
-					output.Address = to
-					output.Amount = convertToAmount(tx.Amount)
-					output.IsMemo = true
-					output.Memo = trx.Memo
-
-					notified := false
-
-					for _, v := range fromArray {
-						if v == tx.From+":"+output.Amount {
-							notified = true
-						}
-					}
-					if !notified {
-						fromArray = append(fromArray, tx.From+":"+output.Amount)
-					}
-					notified = false
-					for _, v := range toArray {
-						if v == to+":"+output.Amount {
-							notified = true
-						}
-					}
-					if !notified {
-						toArray = append(toArray, to+":"+output.Amount)
-					}
+			//先确定每个denom的精度，无法确定时不提取交易，记录为未扫交易
+			coins := make([]openwallet.Coin, 0, len(denoms))
+			for _, denom := range denoms {
+				coin, err := bs.wm.getDenomCoin(denom, bs.getRegisteredContract(denom, scanAddressFunc))
+				if err != nil {
+					bs.wm.Log.Std.Error("block scanner can not get coin of denom: %s; unexpected error: %v", denom, err)
+					result.Success = false
+					return
+				}
+				coins = append(coins, coin)
+			}
 
-					amountCount += tx.Amount
-					output.Coin = openwallet.Coin{
-						Symbol:     bs.wm.Symbol(),
-						IsContract: false,
-					}
-					if tx.From == "multiaddress" {
-						output.Index = multiindex
-						multiindex++
-					} else {
-						output.Index = uint64(i)
-					}
+			for i, denom := range denoms {
+				fee := big.NewInt(0)
+				if denom == feeDenom {
+					fee = feeAmount
+				}
+				bs.extractDenomTransaction(trx, denom, coins[i], fee, blockhash, result, scanAddressFunc)
+			}
+		}
 
-					output.Sid = openwallet.GenTxOutPutSID(trx.TxID, bs.wm.Symbol(), "", output.Index)
-					output.CreateAt = createAt
-					output.BlockHeight = trx.BlockHeight
-					output.BlockHash = blockhash
-					ed := result.extractData[targetResult.SourceKey]
-					if ed == nil {
-						ed = openwallet.NewBlockExtractData()
-						result.extractData[targetResult.SourceKey] = ed
-					}
+		success = true
 
-					ed.TxOutputs = append(ed.TxOutputs, &output)
-				}
-				//	}
+	}
+	result.Success = success
+}
+
+//getRegisteredContract 查询钱包登记的denom合约，未登记时返回nil
+func (bs *ATOMBlockScanner) getRegisteredContract(denom string, scanAddressFunc openwallet.BlockScanTargetFuncV2) *openwallet.SmartContract {
+	if bs.wm.isMainDenom(denom) {
+		return nil
+	}
+	targetResult := scanAddressFunc(openwallet.ScanTargetParam{
+		ScanTarget:     denom,
+		Symbol:         bs.wm.Symbol(),
+		ScanTargetType: openwallet.ScanTargetTypeContractAddress,
+	})
+	if !targetResult.Exist {
+		return nil
+	}
+	switch contract := targetResult.TargetInfo.(type) {
+	case *openwallet.SmartContract:
+		return contract
+	case openwallet.SmartContract:
+		return &contract
+	}
+	return nil
+}
+
+//extractDenomTransaction 提取交易中一个denom的输入输出，fee大于0时向指定的支付方或首个属于钱包的发送地址收取手续费
+func (bs *ATOMBlockScanner) extractDenomTransaction(trx *Transaction, denom string, coin openwallet.Coin, feeAmount *big.Int, blockhash string, result *ExtractResult, scanAddressFunc openwallet.BlockScanTargetFuncV2) {
+	var (
+		multiindex = uint64(0)
+	)
+	createAt := time.Now().Unix()
+	decimals := uint64(defaultDenomDecimals)
+	if coin.IsContract {
+		decimals = coin.Contract.Decimals
+	}
+	toAmount := func(amount *big.Int) string {
+		return convertToDenomAmount(amount, decimals)
+	}
+
+	isReceived := false
+	inputindex := 0
+	from := ""
+	to := ""
+	fromArray := []string{}
+	toArray := []string{}
+	amountCount := big.NewInt(0)
+	fee := "0"
+	feeCharged := false
+
+	status := "1"
+	reason := ""
+
+	extractData := make(map[string]*openwallet.TxExtractData)
+	getExtractData := func(sourceKey string) *openwallet.TxExtractData {
+		ed := extractData[sourceKey]
+		if ed == nil {
+			ed = openwallet.NewBlockExtractData()
+			extractData[sourceKey] = ed
+		}
+		return ed
+	}
+	chargeFee := func(input *openwallet.TxInput, ed *openwallet.TxExtractData) {
+		//一笔交易只收取一次手续费，批量转账时不重复记录
+		if feeAmount.Sign() == 0 || feeCharged {
+			return
+		}
+		feeCharged = true
+		tmp := *input
+		feeCharge := &tmp
+		feeCharge.Amount = toAmount(feeAmount)
+		fee = feeCharge.Amount
+		feeCharge.Index = uint64(inputindex)
+		inputindex++
+		feeCharge.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), coin.ContractID, feeCharge.Index)
+		ed.TxInputs = append(ed.TxInputs, feeCharge)
+	}
+
+	//交易整体执行失败时，手续费仍然扣除，但不记录转账
+	for _, tx := range trx.TxValue {
+		if tx.Status != "true" {
+			status = "0"
+			reason = tx.Reason
+			break
+		}
+	}
+
+	for i, tx := range trx.TxValue {
+		if tx.Denom != denom {
+			continue
+		}
+		//	if tx.Status == "true" {
+
+		if tx.Status != "true" {
+			continue
+		}
+
+		from = tx.From
+		targetResult := scanAddressFunc(openwallet.ScanTargetParam{
+			ScanTarget:     from,
+			Symbol:         bs.wm.Symbol(),
+			ScanTargetType: openwallet.ScanTargetTypeAccountAddress,
+		})
+
+		if targetResult.Exist {
+			input := openwallet.TxInput{}
+			input.TxID = trx.TxID
+			input.Address = from
+			input.Amount = toAmount(tx.Amount)
+			amountCount.Add(amountCount, tx.Amount)
+			fromArray = append(fromArray, from+":"+input.Amount)
+			toArray = append(toArray, tx.To+":"+input.Amount)
+			input.Coin = coin
+			input.Index = uint64(inputindex)
+			inputindex++
+			input.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), coin.ContractID, input.Index)
+			input.CreateAt = createAt
+			input.BlockHeight = trx.BlockHeight
+			input.BlockHash = blockhash
+			input.IsMemo = true
+			input.Memo = trx.Memo
+			ed := getExtractData(targetResult.SourceKey)
+			ed.TxInputs = append(ed.TxInputs, &input)
+
+			if trx.FeePayer == "" {
+				chargeFee(&input, ed)
 			}
+		}
+
+		to = tx.To
+		targetResult = scanAddressFunc(openwallet.ScanTargetParam{
+			ScanTarget:     to,
+			Symbol:         bs.wm.Symbol(),
+			ScanTargetType: openwallet.ScanTargetTypeAccountAddress,
+		})
 
-			for _, extractData := range result.extractData {
-				// status := "1"
-				// reason := ""
-
-				tx := &openwallet.Transaction{
-					From:   fromArray,
-					To:     toArray,
-					Amount: convertToAmount(amountCount),
-					Fees:   fee,
-					Coin: openwallet.Coin{
-						Symbol:     bs.wm.Symbol(),
-						IsContract: false,
-					},
-					BlockHash:   blockhash,
-					BlockHeight: trx.BlockHeight,
-					TxID:        trx.TxID,
-					Decimal:     6,
-					Status:      status,
-					Reason:      reason,
-					SubmitTime:  int64(trx.TimeStamp),
-					ConfirmTime: int64(trx.TimeStamp),
-					IsMemo:      true,
-					Memo:        trx.Memo,
-					Received:    isReceived,
-					TxType:      0,
+		if targetResult.Exist {
+			isReceived = true
+			output := openwallet.TxOutPut{}
+			output.Received = true
+			output.TxID = trx.TxID
+			output.Address = to
+			output.Amount = toAmount(tx.Amount)
+			output.IsMemo = true
+			output.Memo = trx.Memo
+
+			notified := false
+
+			for _, v := range fromArray {
+				if v == tx.From+":"+output.Amount {
+					notified = true
 				}
-				if trx.Memo != "" {
-					tx.SetExtParam("memo", trx.Memo)
+			}
+			if !notified {
+				fromArray = append(fromArray, tx.From+":"+output.Amount)
+			}
+			notified = false
+			for _, v := range toArray {
+				if v == to+":"+output.Amount {
+					notified = true
 				}
-				wxID := openwallet.GenTransactionWxID(tx)
-				tx.WxID = wxID
-				extractData.Transaction = tx
+			}
+			if !notified {
+				toArray = append(toArray, to+":"+output.Amount)
 			}
 
+			amountCount.Add(amountCount, tx.Amount)
+			output.Coin = coin
+			if tx.From == "multiaddress" {
+				output.Index = multiindex
+				multiindex++
+			} else {
+				output.Index = uint64(i)
+			}
+
+			output.Sid = openwallet.GenTxOutPutSID(trx.TxID, bs.wm.Symbol(), coin.ContractID, output.Index)
+			output.CreateAt = createAt
+			output.BlockHeight = trx.BlockHeight
+			output.BlockHash = blockhash
+			ed := getExtractData(targetResult.SourceKey)
+			ed.TxOutputs = append(ed.TxOutputs, &output)
 		}
+		//	}
+	}
 
-		success = true
+	//指定了支付方时由支付方支付，否则该denom没有属于钱包的发送地址，手续费由其他denom中属于钱包的发送地址支付
+	if feeAmount.Sign() > 0 && !feeCharged {
+		payers := make([]string, 0, len(trx.TxValue))
+		if trx.FeePayer != "" {
+			payers = append(payers, trx.FeePayer)
+		} else {
+			for _, tx := range trx.TxValue {
+				payers = append(payers, tx.From)
+			}
+		}
+		for _, payer := range payers {
+			targetResult := scanAddressFunc(openwallet.ScanTargetParam{
+				ScanTarget:     payer,
+				Symbol:         bs.wm.Symbol(),
+				ScanTargetType: openwallet.ScanTargetTypeAccountAddress,
+			})
+			if !targetResult.Exist {
+				continue
+			}
+			input := &openwallet.TxInput{}
+			input.TxID = trx.TxID
+			input.Address = payer
+			input.Coin = coin
+			input.CreateAt = createAt
+			input.BlockHeight = trx.BlockHeight
+			input.BlockHash = blockhash
+			input.IsMemo = true
+			input.Memo = trx.Memo
+			fromArray = append(fromArray, payer+":0")
+			chargeFee(input, getExtractData(targetResult.SourceKey))
+			break
+		}
+	}
 
+	for sourceKey, ed := range extractData {
+		// status := "1"
+		// reason := ""
+
+		tx := &openwallet.Transaction{
+			From:        fromArray,
+			To:          toArray,
+			Amount:      toAmount(amountCount),
+			Fees:        fee,
+			Coin:        coin,
+			BlockHash:   blockhash,
+			BlockHeight: trx.BlockHeight,
+			TxID:        trx.TxID,
+			Decimal:     int32(decimals),
+			Status:      status,
+			Reason:      reason,
+			SubmitTime:  int64(trx.TimeStamp),
+			ConfirmTime: int64(trx.TimeStamp),
+			IsMemo:      true,
+			Memo:        trx.Memo,
+			Received:    isReceived,
+			TxType:      0,
+		}
+		if trx.Memo != "" {
+			tx.SetExtParam("memo", trx.Memo)
+		}
+		if coin.IsContract {
+			tx.SetExtParam("denom", denom)
+		}
+		wxID := openwallet.GenTransactionWxID(tx)
+		tx.WxID = wxID
+		ed.Transaction = tx
+		result.extractData[sourceKey] = append(result.extractData[sourceKey], ed)
 	}
-	result.Success = success
 }
 
 //newExtractDataNotify 发送通知
-func (bs *ATOMBlockScanner) newExtractDataNotify(height uint64, extractData map[string]*openwallet.TxExtractData) error {
+func (bs *ATOMBlockScanner) newExtractDataNotify(height uint64, extractData map[string][]*openwallet.TxExtractData) error {
 
 	for o, _ := range bs.Observers {
-		for key, data := range extractData {
-			err := o.BlockExtractDataNotify(key, data)
-			if err != nil {
-				bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
-				//记录未扫区块
-				unscanRecord := openwallet.NewUnscanRecord(height, "", "ExtractData Notify failed.", bs.wm.Symbol())
-				err = bs.SaveUnscanRecord(unscanRecord)
+		for key, array := range extractData {
+			for _, data := range array {
+				err := o.BlockExtractDataNotify(key, data)
 				if err != nil {
-					bs.wm.Log.Std.Error("block height: %d, save unscan record failed. unexpected error: %v", height, err.Error())
-				}
+					bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
+					//记录未扫区块
+					unscanRecord := openwallet.NewUnscanRecord(height, "", "ExtractData Notify failed.", bs.wm.Symbol())
+					err = bs.SaveUnscanRecord(unscanRecord)
+					if err != nil {
+						bs.wm.Log.Std.Error("block height: %d, save unscan record failed. unexpected error: %v", height, err.Error())
+					}
 
+				}
 			}
 		}
 	}
@@ -803,11 +1045,12 @@ func (bs *ATOMBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, er
 
 	var (
 		blockHeight uint64 = 0
+		localHash   string
 		block       *Block
 		err         error
 	)
 
-	blockHeight, _, err = bs.wm.Blockscanner.GetLocalNewBlock()
+	blockHeight, localHash, err = bs.wm.Blockscanner.GetLocalNewBlock()
 	if err != nil {
 		bs.wm.Log.Errorf("get local new block failed, err=%v", err)
 		return nil, err
@@ -831,7 +1074,12 @@ func (bs *ATOMBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, er
 		return nil, err
 	}
 
-	return block.BlockHeader(), nil
+	//使用本地记录的hash，链上的区块被替换时扫描下一区块可以发现分叉
+	header := block.BlockHeader()
+	if localHash != "" {
+		header.Hash = localHash
+	}
+	return header, nil
 }
 
 //GetScannedBlockHeight 获取已扫区块高度
@@ -854,16 +1102,7 @@ func (bs *ATOMBlockScanner) ExtractTransactionData(txid string, scanTargetFunc o
 	if !result.Success {
 		return nil, fmt.Errorf("extract transaction failed")
 	}
-	extData := make(map[string][]*openwallet.TxExtractData)
-	for key, data := range result.extractData {
-		txs := extData[key]
-		if txs == nil {
-			txs = make([]*openwallet.TxExtractData, 0)
-		}
-		txs = append(txs, data)
-		extData[key] = txs
-	}
-	return extData, nil
+	return result.extractData, nil
 }
 
 //GetSourceKeyByAddress 获取地址对应的数据源标识
@@ -946,7 +1185,7 @@ func (wm *WalletManager) GetTransactionInMemPool(txid string) (*Transaction, err
 	if err != nil {
 		return nil, err
 	}
-	return NewTransaction(trans, wm.Config.TxType, wm.Config.MsgType, wm.Config.Denom), nil
+	return NewTransaction(trans, wm.Config.TxType, wm.Config.MsgType, ""), nil
 }
 
 //GetTransaction 获取交易单
@@ -959,7 +1198,8 @@ func (wm *WalletManager) GetTransaction(txid string) (*Transaction, error) {
 		return nil, err
 	}
 
-	ret := NewTransaction(trans, wm.Config.TxType, wm.Config.MsgType, wm.Config.Denom)
+	//提取全部denom的转账，主币以外的denom作为合约资产
+	ret := NewTransaction(trans, wm.Config.TxType, wm.Config.MsgType, "")
 	return ret, nil
 }
 
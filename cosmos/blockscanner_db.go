@@ -84,8 +84,10 @@ func (bs *ATOMBlockScanner) GetLocalBlock(height uint32) (*Block, error) {
 	}
 
 	block := &Block{
-		Hash:   header.Hash,
-		Height: header.Height,
+		Hash:          header.Hash,
+		PrevBlockHash: header.Previousblockhash,
+		Height:        header.Height,
+		Timestamp:     header.Time,
 	}
 
 	return block, nil
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package cosmos
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+// 常见的ABCI错误码，codespace为sdk
+const (
+	ABCICodeInsufficientFunds = 5
+	ABCICodeOutOfGas          = 11
+	ABCICodeInsufficientFee   = 13
+	ABCICodeTxInMempoolCache  = 19
+	ABCICodeMempoolIsFull     = 20
+	ABCICodeWrongSequence     = 32
+)
+
+var expectedSequenceRegexp = regexp.MustCompile(`expected (\d+)`)
+
+//BroadcastError 节点拒绝交易时返回的错误
+type BroadcastError struct {
+	Code      uint32
+	Codespace string
+	RawLog    string
+}
+
+func (e *BroadcastError) Error() string {
+	return fmt.Sprintf("broadcast failed, codespace: %s, code: %d, %s", e.Codespace, e.Code, e.RawLog)
+}
+
+//is 是否sdk的指定错误码
+func (e *BroadcastError) is(code uint32) bool {
+	return e.Code == code && (e.Codespace == "" || e.Codespace == "sdk")
+}
+
+//IsSequenceMismatch 序号不匹配
+func (e *BroadcastError) IsSequenceMismatch() bool {
+	return e.is(ABCICodeWrongSequence) || strings.Contains(e.RawLog, "account sequence mismatch")
+}
+
+//IsTxInMempool 交易已经在交易池中
+func (e *BroadcastError) IsTxInMempool() bool {
+	return e.is(ABCICodeTxInMempoolCache)
+}
+
+//ExpectedSequence 序号不匹配时节点期望的序号
+func (e *BroadcastError) ExpectedSequence() (uint64, bool) {
+	if !e.IsSequenceMismatch() {
+		return 0, false
+	}
+	match := expectedSequenceRegexp.FindStringSubmatch(e.RawLog)
+	if len(match) != 2 {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+//toBroadcastError 转为广播错误，不是节点拒绝交易的错误时返回nil
+func toBroadcastError(err error) *BroadcastError {
+	if bErr, ok := err.(*BroadcastError); ok {
+		return bErr
+	}
+	return nil
+}
+
+//convertBroadcastError 广播错误转为openwallet的错误类型
+func convertBroadcastError(err error) error {
+	bErr := toBroadcastError(err)
+	if bErr == nil {
+		if err == nil {
+			return nil
+		}
+		return openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "%v", err)
+	}
+	switch {
+	case bErr.IsSequenceMismatch():
+		return openwallet.Errorf(openwallet.ErrNonceInvaild, "account sequence mismatch: %s", bErr.RawLog)
+	case bErr.is(ABCICodeInsufficientFee):
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "insufficient fee: %s", bErr.RawLog)
+	case bErr.is(ABCICodeOutOfGas):
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "out of gas: %s", bErr.RawLog)
+	case bErr.is(ABCICodeInsufficientFunds):
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "insufficient funds: %s", bErr.RawLog)
+	case bErr.is(ABCICodeTxInMempoolCache):
+		return openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "tx already in mempool: %s", bErr.RawLog)
+	case bErr.is(ABCICodeMempoolIsFull):
+		return openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "mempool is full: %s", bErr.RawLog)
+	}
+	return openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "%s", bErr.Error())
+}
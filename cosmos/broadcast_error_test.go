@@ -0,0 +1,100 @@
+package cosmos
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+	xauthsigning "github.com/cosmos/cosmos-sdk/x/auth/signing"
+)
+
+func Test_convertBroadcastError(t *testing.T) {
+	cases := []struct {
+		code    uint32
+		rawLog  string
+		errCode uint64
+	}{
+		{ABCICodeWrongSequence, "account sequence mismatch, expected 8, got 6: incorrect account sequence", openwallet.ErrNonceInvaild},
+		{ABCICodeInsufficientFee, "insufficient fees; got: 1uatom required: 2500uatom: insufficient fee", openwallet.ErrInsufficientFees},
+		{ABCICodeOutOfGas, "out of gas in location: ReadFlat; gasWanted: 200000, gasUsed: 200512: out of gas", openwallet.ErrInsufficientFees},
+		{ABCICodeInsufficientFunds, "100uatom is smaller than 500000uatom: insufficient funds", openwallet.ErrInsufficientBalanceOfAddress},
+		{ABCICodeTxInMempoolCache, "tx already in mempool", openwallet.ErrSubmitRawTransactionFailed},
+		{ABCICodeMempoolIsFull, "mempool is full", openwallet.ErrSubmitRawTransactionFailed},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"tx_response":{"code":%d,"codespace":"sdk","raw_log":"%s","txhash":""}}`, c.code, c.rawLog)
+		}))
+		client := NewClient(server.URL, false)
+		_, err := client.sendTransaction("0a00:cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9@6", BroadcastModeSync)
+		server.Close()
+
+		bErr := toBroadcastError(err)
+		if bErr == nil || bErr.Code != c.code || bErr.RawLog != c.rawLog {
+			t.Errorf("unexpected broadcast error: %v", err)
+			continue
+		}
+		owErr, ok := convertBroadcastError(err).(*openwallet.Error)
+		if !ok || owErr.Code() != c.errCode {
+			t.Errorf("code %d converted to unexpected error: %v", c.code, owErr)
+		}
+	}
+
+	bErr := &BroadcastError{Code: ABCICodeWrongSequence, Codespace: "sdk", RawLog: "account sequence mismatch, expected 8, got 6: incorrect account sequence"}
+	if seq, ok := bErr.ExpectedSequence(); !ok || seq != 8 {
+		t.Errorf("unexpected expected sequence: %d %v", seq, ok)
+	}
+	//其他模块的相同错误码不是序号不匹配
+	bErr = &BroadcastError{Code: ABCICodeWrongSequence, Codespace: "wasm", RawLog: "query failed"}
+	if bErr.IsSequenceMismatch() {
+		t.Errorf("code of other codespace should not be sequence mismatch")
+	}
+}
+
+func Test_resignBroadcastTx(t *testing.T) {
+	decoder := &TransactionDecoder{}
+	prikey := "1234567812345678123456781234567812345678123456781234567812345678"
+	key, _ := hex.DecodeString(prikey)
+
+	rawTx, _ := testSignedRawTransaction(t, prikey)
+	err := decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	signedTrans, message, signature, err := resignBroadcastTx(rawTx.RawHex, "cosmoshub-4", 173110, 8, key)
+	if err != nil {
+		t.Fatalf("re-sign failed: %v", err)
+	}
+	if !strings.HasSuffix(signedTrans, "@8") {
+		t.Errorf("unexpected broadcast data: %s", signedTrans)
+	}
+
+	encCfg := newEncodingConfig()
+	txBytes, _ := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	tx, err := encCfg.TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	sigTx := tx.(xauthsigning.SigVerifiableTx)
+	sigs, _ := sigTx.GetSignaturesV2()
+	if len(sigs) != 1 || sigs[0].Sequence != 8 {
+		t.Fatalf("unexpected signatures: %+v", sigs)
+	}
+	signerData := xauthsigning.SignerData{ChainID: "cosmoshub-4", AccountNumber: 173110, Sequence: 8}
+	signBytes, _ := encCfg.TxConfig.SignModeHandler().GetSignBytes(signing.SignMode_SIGN_MODE_DIRECT, signerData, tx)
+	if hex.EncodeToString(owcrypt.Hash(signBytes, 0, owcrypt.HASH_ALG_SHA256)) != message {
+		t.Errorf("re-signed message does not match the sign bytes")
+	}
+	sig, _ := hex.DecodeString(signature)
+	if !sigs[0].PubKey.VerifySignature(signBytes, sig) {
+		t.Errorf("re-signed signature verify failed")
+	}
+}
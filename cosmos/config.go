@@ -105,6 +105,40 @@ type WalletConfig struct {
 	MinFee uint64
 	// gas standed
 	StdGas uint64
+	// simulate transaction to estimate gas or not
+	IsSimulate bool
+	// gas adjustment multiplied by the simulated gas
+	GasAdjustment decimal.Decimal
+	// gas price in minimum denom
+	GasPrice decimal.Decimal
+	// default sign mode: direct or amino_json
+	SignMode string
+	// times to re-sign and re-broadcast when the node reports account sequence mismatch, 0 = disabled
+	SequenceRetry int
+	// broadcast mode: sync, async or confirm
+	BroadcastMode string
+	// how long to wait for block inclusion in confirm mode
+	ConfirmTimeout time.Duration
+	// interval of polling the transaction result in confirm mode
+	ConfirmInterval time.Duration
+	// interval of polling the ibc packet status after an ibc transfer is submitted
+	IBCPacketInterval time.Duration
+	// how long to keep polling the ibc packet status until it is acknowledged or timed out
+	IBCPacketTimeout time.Duration
+	// default fee granter address, fees are deducted from its x/feegrant allowance
+	FeeGranter string
+	// default fee payer address, must be an address of the wallet
+	FeePayer string
+	// default transaction timeout in blocks after the current height, 0 = never expires
+	TimeoutBlocks uint64
+	// scan mode: message or events (coin_received and transfer events of block_results)
+	ScanMode string
+	// concurrent workers extracting transactions of the scanned blocks
+	ScanWorkers int
+	// blocks fetched and extracted ahead of the scanned height, 1 = one block at a time
+	PrefetchBlocks uint64
+	// max blocks to walk back looking for the common ancestor when the chain forks
+	MaxRewindDepth uint64
 	// scan mem pool or not
 	IsScanMemPool bool
 	// data directory
@@ -166,6 +200,19 @@ func NewConfig(symbol string, masterKey string) *WalletConfig {
 	c.CoinDecimal = decimal.NewFromFloat(100000000)
 	//核心钱包密码，配置有值用于自动解锁钱包
 	c.WalletPassword = ""
+	//模拟交易gas的调整系数
+	c.GasAdjustment = decimal.NewFromFloat(1.3)
+	//等待交易上链的超时时间和查询间隔
+	c.ConfirmTimeout = time.Minute
+	c.ConfirmInterval = time.Second * 2
+	//IBC转账后等待数据包确认或超时的时间和查询间隔
+	c.IBCPacketInterval = time.Second * 6
+	c.IBCPacketTimeout = time.Minute * 30
+	//扫块提取交易的并发数和预取的区块数
+	c.ScanWorkers = defaultScanWorkers
+	c.PrefetchBlocks = defaultPrefetchBlocks
+	//分叉时最多回退的区块数
+	c.MaxRewindDepth = defaultMaxRewindDepth
 
 	//默认配置内容
 	c.DefaultConfig = `
@@ -2,6 +2,7 @@ package cosmos
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
 	"strconv"
 
@@ -15,6 +16,8 @@ type AddrBalance struct {
 	PublicKey string
 	Balance *big.Int
 	index   int
+	// 支付手续费的主币余额，转出主币时与Balance相同
+	feeBalance *big.Int
 }
 
 func convertFlostStringToBigInt(amount string) (*big.Int, error) {
@@ -77,55 +80,47 @@ func NewContractDecoder(wm *WalletManager) *ContractDecoder {
 	return &decoder
 }
 
+//GetTokenBalanceByAddress 查询地址bank模块denom的余额，合约地址为denom，按GetDenomContract确定的精度换算
 func (decoder *ContractDecoder) GetTokenBalanceByAddress(contract openwallet.SmartContract, address ...string) ([]*openwallet.TokenBalance, error) {
 
-	// var tokenBalanceList []*openwallet.TokenBalance
-
-	// for i := 0; i < len(address); i++ {
-	// 	tokenBalance := openwallet.TokenBalance{
-	// 		Contract: &contract,
-	// 	}
-	// 	if contract.ContractID == ontologyTransaction.ONTContractAddress {
-	// 		balance, err := decoder.wm.RPCClient.getONTBalance(address[i])
-	// 		if err != nil {
-	// 			log.Error("Get ONT balance of address [%v] failed with error : [%v]", address[i], err)
-	// 			return nil, err
-	// 		}
-	// 		tokenBalance.Balance = &openwallet.Balance{
-	// 			Address:          address[i],
-	// 			Symbol:           contract.Symbol,
-	// 			Balance:          balance.ONTBalance.String(),
-	// 			ConfirmBalance:   balance.ONTBalance.String(),
-	// 			UnconfirmBalance: "0",
-	// 		}
-	// 	} else if contract.ContractID == ontologyTransaction.ONGContractAddress {
-	// 		balance, err := decoder.wm.RPCClient.getONGBalance(address[i])
-	// 		if err != nil {
-	// 			log.Error("Get ONG balance of address [%v] failed with error : [%v]", address[i], err)
-	// 			return nil, err
-	// 		}
-	// 		ong, err := convertBigIntToFloatDecimal(balance.ONGBalance.String())
-	// 		if err != nil {
-	// 			log.Error("Get ONG balance of address [%v] failed with error : [%v]", address[i], err)
-	// 		}
-	// 		ongUnbound, err := convertBigIntToFloatDecimal(balance.ONGUnbound.String())
-	// 		if err != nil {
-	// 			log.Error("Get ONG balance of address [%v] failed with error : [%v]", address[i], err)
-	// 		}
-
-	// 		tokenBalance.Balance = &openwallet.Balance{
-	// 			Address:          address[i],
-	// 			Symbol:           contract.Symbol,
-	// 			Balance:          "0",
-	// 			ConfirmBalance:   ong.String(),
-	// 			UnconfirmBalance: ongUnbound.String(),
-	// 		}
-	// 	} else {
-	// 		// other contract
-	// 	}
-	// 	tokenBalanceList = append(tokenBalanceList, &tokenBalance)
-	// }
-
-	// return tokenBalanceList, nil
-	return nil, nil
+	denom := contract.Address
+	if denom == "" {
+		return nil, fmt.Errorf("contract address is empty")
+	}
+	//精度取自denom元数据，没有元数据时使用传入的登记合约的精度，都没有时返回错误，不按猜测的精度返回余额
+	resolved, err := decoder.wm.GetDenomContract(denom, &contract)
+	if err != nil {
+		log.Errorf("get decimals of denom [%v] failed with error : [%v]", denom, err)
+		return nil, err
+	}
+	decimals := resolved.Decimals
+	contract.Decimals = decimals
+
+	tokenBalanceList := make([]*openwallet.TokenBalance, 0, len(address))
+
+	for _, addr := range address {
+		balances, err := decoder.wm.RestClient.getAllBalances(addr)
+		if err != nil {
+			log.Errorf("get balances of address [%v] failed with error : [%v]", addr, err)
+			return nil, err
+		}
+		amount, ok := balances[denom]
+		if !ok {
+			amount = big.NewInt(0)
+		}
+		balance := decimal.NewFromBigInt(amount, -int32(decimals)).String()
+
+		tokenBalanceList = append(tokenBalanceList, &openwallet.TokenBalance{
+			Contract: &contract,
+			Balance: &openwallet.Balance{
+				Address:          addr,
+				Symbol:           contract.Symbol,
+				Balance:          balance,
+				ConfirmBalance:   balance,
+				UnconfirmBalance: "0",
+			},
+		})
+	}
+
+	return tokenBalanceList, nil
 }
@@ -1,36 +1,166 @@
 package cosmos
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
 )
 
 func Test_GetTokenBalanceByAddress(t *testing.T) {
-	// tm := NewWalletManager()
-	// rpc := NewRpcClient("http://192.168.27.124:20336")
-	// tm.RPCClient = rpc
-
-	// contract := openwallet.SmartContract{
-	// 	Symbol:     "ONT",
-	// 	ContractID: ontologyTransaction.ONTContractAddress,
-	// }
-
-	// address1 := "AYmuoVvtCojm1F3ATMf2fNww3wBNvAxbi5"
-	// address2 := "AaCe8nVkMRABnp5YgEjYZ9E5KYCxks2uce"
-
-	// ret, err := tm.ContractDecoder.GetTokenBalanceByAddress(contract, address1, address2)
-
-	// if err != nil {
-	// 	t.Error(err)
-	// } else {
-	// 	fmt.Println(ret)
-	// }
-
-	// contract.ContractID = ontologyTransaction.ONGContractAddress
-	// ret, err = tm.ContractDecoder.GetTokenBalanceByAddress(contract, address1, address2)
-
-	// if err != nil {
-	// 	t.Error(err)
-	// } else {
-	// 	fmt.Println(ret)
-	// }
+	osmo := ibctransfertypes.ParseDenomTrace("transfer/channel-141/uosmo").IBCDenom()
+	weth := ibctransfertypes.ParseDenomTrace("transfer/channel-2/weth-wei").IBCDenom()
+	address1 := "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+	address2 := "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/bank/v1beta1/balances/"+address1, func(w http.ResponseWriter, r *http.Request) {
+		//分页返回
+		if r.URL.Query().Get("pagination.key") == "" {
+			fmt.Fprintf(w, `{"balances":[{"denom":"%s","amount":"12345000"}],"pagination":{"next_key":"AQ==","total":"2"}}`, osmo)
+			return
+		}
+		fmt.Fprintf(w, `{"balances":[{"denom":"%s","amount":"1500000000000000000000"},{"denom":"uatom","amount":"1000"}],"pagination":{"next_key":null,"total":"0"}}`, weth)
+	})
+	mux.HandleFunc("/cosmos/bank/v1beta1/balances/"+address2, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"balances":[],"pagination":{"next_key":null,"total":"0"}}`)
+	})
+	mux.HandleFunc("/ibc/apps/transfer/v1/denom_traces/", func(w http.ResponseWriter, r *http.Request) {
+		switch "ibc/" + r.URL.Path[len("/ibc/apps/transfer/v1/denom_traces/"):] {
+		case osmo:
+			fmt.Fprint(w, `{"denom_trace":{"path":"transfer/channel-141","base_denom":"uosmo"}}`)
+		case weth:
+			fmt.Fprint(w, `{"denom_trace":{"path":"transfer/channel-2","base_denom":"weth-wei"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":5,"message":"denomination trace not found"}`)
+		}
+	})
+	mux.HandleFunc("/cosmos/bank/v1beta1/denoms_metadata/", func(w http.ResponseWriter, r *http.Request) {
+		//含有路径的denom需要转义，否则节点匹配不到路由
+		denom := strings.TrimPrefix(r.URL.EscapedPath(), "/cosmos/bank/v1beta1/denoms_metadata/")
+		if strings.Contains(denom, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":5,"message":"Not Found","details":[]}`)
+			return
+		}
+		denom, _ = url.PathUnescape(denom)
+		if denom != weth {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"code":5,"message":"client metadata for denom %s"}`, denom)
+			return
+		}
+		fmt.Fprintf(w, `{"metadata":{"base":"%s","display":"weth","name":"Wrapped Ether","symbol":"WETH",`+
+			`"denom_units":[{"denom":"%s","exponent":0},{"denom":"gwei","exponent":9},{"denom":"weth","exponent":18}]}}`, weth, weth)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.RestClient = NewClient(server.URL, false)
+
+	//ibc凭证解析原始denom，没有元数据时使用登记的精度，都没有时无法确定精度
+	if contract, err := wm.GetDenomContract(osmo, nil); err == nil {
+		t.Errorf("decimals of denom without metadata should be unknown: %+v", contract)
+	}
+	contract, err := wm.GetDenomContract(osmo, &openwallet.SmartContract{Decimals: 6})
+	if err != nil || contract.Address != osmo || contract.Token != "uosmo" || contract.Name != "transfer/channel-141/uosmo" || contract.Decimals != 6 {
+		t.Errorf("unexpected contract: %+v %v", contract, err)
+	}
+	//元数据的精度优先于登记的精度
+	contract, err = wm.GetDenomContract(weth, &openwallet.SmartContract{Decimals: 6})
+	if err != nil || contract.Token != "WETH" || contract.Name != "Wrapped Ether" || contract.Decimals != 18 {
+		t.Errorf("unexpected contract: %+v %v", contract, err)
+	}
+
+	cases := []struct {
+		denom    string
+		decimals uint64
+		balances []string
+	}{
+		{osmo, 6, []string{"12.345", "0"}},
+		{weth, 0, []string{"1500", "0"}},
+	}
+	for _, c := range cases {
+		contract := openwallet.SmartContract{
+			ContractID: openwallet.GenContractID(wm.Symbol(), c.denom),
+			Symbol:     wm.Symbol(),
+			Address:    c.denom,
+			Decimals:   c.decimals,
+		}
+		ret, err := wm.ContractDecoder.GetTokenBalanceByAddress(contract, address1, address2)
+		if err != nil || len(ret) != 2 {
+			t.Fatalf("get token balance failed: %v", err)
+		}
+		for i, b := range ret {
+			if b.Balance.Balance != c.balances[i] || b.Balance.ConfirmBalance != c.balances[i] || b.Contract.Address != c.denom || b.Contract.Decimals == 0 {
+				t.Errorf("unexpected balance of denom %s: %+v", c.denom, b.Balance)
+			}
+		}
+	}
+
+	//没有denom元数据时按登记的精度换算，未登记精度时不返回余额
+	contract = &openwallet.SmartContract{Symbol: wm.Symbol(), Address: osmo, Decimals: 3}
+	ret, err := wm.ContractDecoder.GetTokenBalanceByAddress(*contract, address1)
+	if err != nil || len(ret) != 1 || ret[0].Balance.Balance != "12345" {
+		t.Errorf("unexpected balance of registered decimals: %+v %v", ret, err)
+	}
+	contract.Decimals = 0
+	if ret, err = wm.ContractDecoder.GetTokenBalanceByAddress(*contract, address1); err == nil {
+		t.Errorf("balance of unknown decimals should not be returned: %+v", ret[0].Balance)
+	}
+}
+
+func Test_getDenomMetadata(t *testing.T) {
+	weth := "weth-wei"
+	listFailed := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/bank/v1beta1/denoms_metadata/", func(w http.ResponseWriter, r *http.Request) {
+		//节点不支持按denom查询的路由
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprint(w, `{"code":12,"message":"Method Not Allowed"}`)
+	})
+	mux.HandleFunc("/cosmos/bank/v1beta1/denoms_metadata", func(w http.ResponseWriter, r *http.Request) {
+		if listFailed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"code":14,"message":"unavailable"}`)
+			return
+		}
+		//分页返回
+		if r.URL.Query().Get("pagination.key") == "" {
+			fmt.Fprint(w, `{"metadatas":[{"base":"uatom","display":"atom","denom_units":[{"denom":"uatom","exponent":0},{"denom":"atom","exponent":6}]}],"pagination":{"next_key":"AQ==","total":"2"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"metadatas":[{"base":"%s","display":"weth","symbol":"WETH",`+
+			`"denom_units":[{"denom":"%s","exponent":0},{"denom":"weth","exponent":18}]}],"pagination":{"next_key":null,"total":"0"}}`, weth, weth)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.Denom = "uatom"
+	wm.RestClient = NewClient(server.URL, false)
+
+	//查询失败时返回错误，不缓存
+	listFailed = true
+	if contract, err := wm.GetDenomContract(weth, &openwallet.SmartContract{Decimals: 6}); err == nil {
+		t.Errorf("query failure should not fall back to registered decimals: %+v", contract)
+	}
+
+	//节点不支持按denom查询时，分页查询全部元数据
+	listFailed = false
+	contract, err := wm.GetDenomContract(weth, nil)
+	if err != nil || contract.Decimals != 18 || contract.Token != "WETH" {
+		t.Errorf("unexpected contract: %+v %v", contract, err)
+	}
+	metadata, err := wm.RestClient.getDenomMetadata("uosmo")
+	if err != nil || metadata != nil {
+		t.Errorf("unexpected metadata of denom without metadata: %+v %v", metadata, err)
+	}
 }
@@ -18,10 +18,12 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/shopspring/decimal"
 )
 
 //初始化配置流程
@@ -651,6 +653,62 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.MinFee = uint64(minFee)
 	stdGas, _ := c.Int("stdGas")
 	wm.Config.StdGas = uint64(stdGas)
+	wm.Config.IsSimulate, _ = c.Bool("isSimulate")
+	gasAdjustment, err := decimal.NewFromString(c.String("gasAdjustment"))
+	if err == nil && gasAdjustment.GreaterThan(decimal.Zero) {
+		wm.Config.GasAdjustment = gasAdjustment
+	}
+	gasPrice, err := decimal.NewFromString(c.String("gasPrice"))
+	if err == nil {
+		wm.Config.GasPrice = gasPrice
+	}
+	wm.Config.SignMode = c.String("signMode")
+	if !isValidSignMode(wm.Config.SignMode) {
+		return fmt.Errorf("unsupported sign mode: %s", wm.Config.SignMode)
+	}
+	wm.Config.SequenceRetry, _ = c.Int("sequenceRetry")
+	wm.Config.BroadcastMode = c.String("broadcastMode")
+	if !isValidBroadcastMode(wm.Config.BroadcastMode) {
+		return fmt.Errorf("unsupported broadcast mode: %s", wm.Config.BroadcastMode)
+	}
+	confirmTimeout, _ := c.Int64("confirmTimeout")
+	if confirmTimeout > 0 {
+		wm.Config.ConfirmTimeout = time.Duration(confirmTimeout) * time.Second
+	}
+	confirmInterval, _ := c.Int64("confirmInterval")
+	if confirmInterval > 0 {
+		wm.Config.ConfirmInterval = time.Duration(confirmInterval) * time.Second
+	}
+	ibcPacketInterval, _ := c.Int64("ibcPacketInterval")
+	if ibcPacketInterval > 0 {
+		wm.Config.IBCPacketInterval = time.Duration(ibcPacketInterval) * time.Second
+	}
+	ibcPacketTimeout, _ := c.Int64("ibcPacketTimeout")
+	if ibcPacketTimeout > 0 {
+		wm.Config.IBCPacketTimeout = time.Duration(ibcPacketTimeout) * time.Second
+	}
+	wm.Config.FeeGranter = c.String("feeGranter")
+	wm.Config.FeePayer = c.String("feePayer")
+	timeoutBlocks, _ := c.Int64("timeoutBlocks")
+	if timeoutBlocks > 0 {
+		wm.Config.TimeoutBlocks = uint64(timeoutBlocks)
+	}
+	wm.Config.ScanMode = c.String("scanMode")
+	if !isValidScanMode(wm.Config.ScanMode) {
+		return fmt.Errorf("unsupported scan mode: %s", wm.Config.ScanMode)
+	}
+	scanWorkers, _ := c.Int("scanWorkers")
+	if scanWorkers > 0 {
+		wm.Config.ScanWorkers = scanWorkers
+	}
+	prefetchBlocks, _ := c.Int64("prefetchBlocks")
+	if prefetchBlocks > 0 {
+		wm.Config.PrefetchBlocks = uint64(prefetchBlocks)
+	}
+	maxRewindDepth, _ := c.Int64("maxRewindDepth")
+	if maxRewindDepth > 0 {
+		wm.Config.MaxRewindDepth = uint64(maxRewindDepth)
+	}
 	wm.Config.IsScanMemPool, _ = c.Bool("isScanMemPool")
 	wm.Config.DataDir = c.String("dataDir")
 
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package cosmos
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	"github.com/shopspring/decimal"
+)
+
+// 主币的精度
+const defaultDenomDecimals = 6
+
+// bank模块资产的合约协议
+const DenomProtocol = "bank"
+
+//denomContract 节点查询到的denom合约，未登记元数据时精度未知
+type denomContract struct {
+	contract    openwallet.SmartContract
+	hasMetadata bool
+}
+
+//isMainDenom 是否主币的denom
+func (wm *WalletManager) isMainDenom(denom string) bool {
+	return denom == "" || denom == wm.Config.Denom
+}
+
+//GetDenomContract 将bank模块的denom作为openwallet的合约资产，合约地址为denom，包括ibc/...凭证和其他原生代币。
+//ibc凭证按denom路径解析原始denom。精度取自denom元数据，未登记元数据时使用钱包登记的合约registered的精度，
+//都无法确定时返回错误。构建交易、扫块和查询余额都从这里获取精度，保证转出和转入按相同的精度换算
+func (wm *WalletManager) GetDenomContract(denom string, registered *openwallet.SmartContract) (*openwallet.SmartContract, error) {
+	wm.denomMu.Lock()
+	cached, ok := wm.denomContracts[denom]
+	wm.denomMu.Unlock()
+	if !ok {
+		//节点查询成功的结果才缓存，查询失败时下次重新查询
+		resolved, err := wm.resolveDenomContract(denom)
+		if err != nil {
+			return nil, err
+		}
+		wm.denomMu.Lock()
+		if wm.denomContracts == nil {
+			wm.denomContracts = make(map[string]*denomContract)
+		}
+		wm.denomContracts[denom] = resolved
+		wm.denomMu.Unlock()
+		cached = resolved
+	}
+
+	contract := cached.contract
+	if cached.hasMetadata {
+		if registered != nil && registered.Decimals != 0 && registered.Decimals != contract.Decimals {
+			wm.Log.Warningf("denom %s is registered with decimals %d, use decimals %d of denom metadata", denom, registered.Decimals, contract.Decimals)
+		}
+		return &contract, nil
+	}
+	if registered == nil || registered.Decimals == 0 {
+		return nil, fmt.Errorf("decimals of denom %s is unknown, it has no denom metadata and no registered decimals", denom)
+	}
+	contract.Decimals = registered.Decimals
+	return &contract, nil
+}
+
+//resolveDenomContract 从节点查询denom的路径和元数据
+func (wm *WalletManager) resolveDenomContract(denom string) (*denomContract, error) {
+	if wm.RestClient == nil {
+		return nil, fmt.Errorf("rest client is not setup")
+	}
+	resolved := &denomContract{
+		contract: openwallet.SmartContract{
+			ContractID: openwallet.GenContractID(wm.Symbol(), denom),
+			Symbol:     wm.Symbol(),
+			Address:    denom,
+			Token:      denom,
+			Protocol:   DenomProtocol,
+			Name:       denom,
+		},
+	}
+	contract := &resolved.contract
+
+	if strings.HasPrefix(denom, ibctransfertypes.DenomPrefix+"/") {
+		trace, err := wm.RestClient.getDenomTrace(strings.TrimPrefix(denom, ibctransfertypes.DenomPrefix+"/"))
+		if err != nil {
+			wm.Log.Warningf("get denom trace of %s failed, unexpected error: %v", denom, err)
+			return nil, err
+		}
+		if trace != nil {
+			contract.Token = trace.BaseDenom
+			contract.Name = trace.FullPath()
+		}
+	}
+
+	metadata, err := wm.RestClient.getDenomMetadata(denom)
+	if err != nil {
+		wm.Log.Warningf("get denom metadata of %s failed, unexpected error: %v", denom, err)
+		return nil, err
+	}
+	if metadata != nil {
+		resolved.hasMetadata = true
+		contract.Decimals = metadata.Decimals
+		if metadata.Symbol != "" {
+			contract.Token = metadata.Symbol
+		} else if metadata.Display != "" {
+			contract.Token = strings.ToUpper(metadata.Display)
+		}
+		if metadata.Name != "" {
+			contract.Name = metadata.Name
+		}
+	}
+	return resolved, nil
+}
+
+//getDenomCoin 获取denom对应的币种，主币的denom不是合约，registered为钱包登记的合约
+func (wm *WalletManager) getDenomCoin(denom string, registered *openwallet.SmartContract) (openwallet.Coin, error) {
+	if wm.isMainDenom(denom) {
+		return openwallet.Coin{
+			Symbol:     wm.Symbol(),
+			IsContract: false,
+		}, nil
+	}
+	contract, err := wm.GetDenomContract(denom, registered)
+	if err != nil {
+		return openwallet.Coin{}, err
+	}
+	return openwallet.Coin{
+		Symbol:     wm.Symbol(),
+		IsContract: true,
+		ContractID: contract.ContractID,
+		Contract:   *contract,
+	}, nil
+}
+
+//getCoinDenom 获取币种对应的denom和精度，合约地址为denom，精度按GetDenomContract确定
+func (wm *WalletManager) getCoinDenom(coin openwallet.Coin) (string, uint64, error) {
+	if !coin.IsContract || len(coin.Contract.Address) == 0 || wm.isMainDenom(coin.Contract.Address) {
+		return wm.Config.Denom, defaultDenomDecimals, nil
+	}
+	contract, err := wm.GetDenomContract(coin.Contract.Address, &coin.Contract)
+	if err != nil {
+		return "", 0, err
+	}
+	return contract.Address, contract.Decimals, nil
+}
+
+// 按精度从最小单位的 amount 转为带小数点的表示，18位精度的数量可能超过uint64
+func convertToDenomAmount(amount *big.Int, decimals uint64) string {
+	if amount == nil {
+		return "0"
+	}
+	return decimal.NewFromBigInt(amount, -int32(decimals)).String()
+}
+
+// 按精度将 amount 字符串转为最小单位的表示，不足最小单位的部分舍去
+func convertFromDenomAmount(amountStr string, decimals uint64) *big.Int {
+	d, _ := decimal.NewFromString(amountStr)
+	amount, ok := new(big.Int).SetString(d.Shift(int32(decimals)).Truncate(0).String(), 10)
+	if !ok {
+		return big.NewInt(0)
+	}
+	return amount
+}
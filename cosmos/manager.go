@@ -19,6 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
@@ -39,6 +42,13 @@ type WalletManager struct {
 	TxDecoder       openwallet.TransactionDecoder //交易单编码器
 	Log             *log.OWLogger                 //日志工具
 	ContractDecoder *ContractDecoder              //智能合约解析器
+	SequenceManager *SequenceManager              //地址序号管理器
+
+	denomMu        sync.Mutex
+	denomContracts map[string]*denomContract //已解析的denom合约
+
+	ibcPacketMu      sync.Mutex
+	ibcPacketHandler func(packet *IBCPacket) //IBC数据包状态的回调
 }
 
 func NewWalletManager() *WalletManager {
@@ -54,6 +64,7 @@ func NewWalletManager() *WalletManager {
 	wm.TxDecoder = NewTransactionDecoder(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
 	wm.ContractDecoder = NewContractDecoder(&wm)
+	wm.SequenceManager = NewSequenceManager(&wm)
 
 	//	wm.RPCClient = NewRpcClient("http://localhost:20336/")
 	return &wm
@@ -97,12 +108,18 @@ func (wm *WalletManager) GetWallets() ([]*openwallet.Wallet, error) {
 //SendRawTransaction 广播交易
 func (wm *WalletManager) SendRawTransaction(txHex string) (string, error) {
 
-	return wm.sendRawTransactionByNode(txHex)
+	return wm.sendRawTransactionByNode(txHex, BroadcastModeSync)
+}
+
+//BroadcastRawTransaction 按指定的广播模式广播交易，confirm模式与sync相同，等待上链由WaitForTransaction完成
+func (wm *WalletManager) BroadcastRawTransaction(txHex string, mode string) (string, error) {
+
+	return wm.sendRawTransactionByNode(txHex, mode)
 }
 
-func (wm *WalletManager) sendRawTransactionByNode(txHex string) (string, error) {
+func (wm *WalletManager) sendRawTransactionByNode(txHex string, mode string) (string, error) {
 
-	txid, err := wm.RestClient.sendTransaction(txHex)
+	txid, err := wm.RestClient.sendTransaction(txHex, mode)
 	if err != nil {
 		fmt.Println(err)
 		return "", err
@@ -110,3 +127,212 @@ func (wm *WalletManager) sendRawTransactionByNode(txHex string) (string, error)
 
 	return txid, nil
 }
+
+//WaitForTransaction 轮询交易的执行结果，直到交易上链或超时
+func (wm *WalletManager) WaitForTransaction(txid string, timeout time.Duration) (*TxResult, error) {
+
+	interval := wm.Config.ConfirmInterval
+	if interval <= 0 {
+		interval = time.Second * 2
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		result, err := wm.RestClient.getTxResult(txid)
+		if err != nil {
+			wm.Log.Warningf("get transaction: %s result failed, unexpected error: %v", txid, err)
+		} else if result != nil && result.Height > 0 {
+			return result, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("transaction: %s is not included in block within %v", txid, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+//GetActiveProposals 获取投票期内的治理提案，以及地址的投票情况
+func (wm *WalletManager) GetActiveProposals(addresses ...string) ([]*Proposal, error) {
+
+	proposals, err := wm.RestClient.getProposals("PROPOSAL_STATUS_VOTING_PERIOD")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range proposals {
+		for _, addr := range addresses {
+			option, err := wm.RestClient.getProposalVote(p.ProposalID, addr)
+			if err != nil {
+				return nil, err
+			}
+			if option != "" {
+				p.Votes[addr] = option
+			}
+		}
+	}
+
+	return proposals, nil
+}
+
+//GetAuthzGrants 获取地址作为授权方或被授权方的有效授权，节点不支持按单方查询时，查询地址两两之间的授权
+func (wm *WalletManager) GetAuthzGrants(addresses ...string) ([]*AuthzGrant, error) {
+
+	now := time.Now()
+	grants := make([]*AuthzGrant, 0)
+	exists := make(map[string]bool)
+	add := func(list []*AuthzGrant) {
+		for _, g := range list {
+			key := g.Granter + "/" + g.Grantee + "/" + g.MsgTypeURL
+			if exists[key] || g.IsExpired(now) {
+				continue
+			}
+			exists[key] = true
+			grants = append(grants, g)
+		}
+	}
+
+	for _, addr := range addresses {
+		granterGrants, err := wm.RestClient.getGranterGrants(addr)
+		if err != nil {
+			//只有节点不支持按授权方查询时才按地址对查询，超时等其他错误直接返回
+			if !isUnimplementedError(err) {
+				return nil, err
+			}
+			log.Warningf("query grants of granter: %s is not supported, query by address pairs instead, unexpected error: %v", addr, err)
+			for _, grantee := range addresses {
+				if grantee == addr {
+					continue
+				}
+				pairGrants, err := wm.RestClient.getGrantsByPair(addr, grantee)
+				if err != nil {
+					return nil, err
+				}
+				add(pairGrants)
+			}
+			continue
+		}
+		add(granterGrants)
+
+		granteeGrants, err := wm.RestClient.getGranteeGrants(addr)
+		if err != nil {
+			return nil, err
+		}
+		add(granteeGrants)
+	}
+
+	return grants, nil
+}
+
+//GetIBCPacket 查询IBC转账交易发出的数据包状态
+func (wm *WalletManager) GetIBCPacket(txid string) (*IBCPacket, error) {
+
+	trans, err := wm.RestClient.Call("/cosmos/tx/v1beta1/txs/"+txid, nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	txResponse := trans.Get("tx_response")
+	if result := NewTxResult(&txResponse); result.Failed() {
+		return nil, fmt.Errorf("transaction: %s has not sent any ibc packet, %s", txid, result.FailedReason())
+	}
+
+	var packet *IBCPacket
+	logList := txResponse.Get("logs").Array()
+	for i := range logList {
+		packet = NewIBCPacket(txid, &logList[i])
+		if packet != nil {
+			break
+		}
+	}
+	if packet == nil {
+		return nil, fmt.Errorf("transaction: %s has not sent any ibc packet", txid)
+	}
+
+	//数据包超时，资金已退回。序号只在同一端口和通道内唯一
+	timeoutTxs, err := wm.RestClient.searchTxs(
+		fmt.Sprintf("timeout_packet.packet_src_port='%s'", packet.SourcePort),
+		fmt.Sprintf("timeout_packet.packet_src_channel='%s'", packet.SourceChannel),
+		fmt.Sprintf("timeout_packet.packet_sequence='%d'", packet.Sequence))
+	if err != nil {
+		return nil, err
+	}
+	if len(timeoutTxs.Get("tx_responses").Array()) > 0 {
+		packet.Status = IBCPacketTimeout
+		return packet, nil
+	}
+
+	//数据包已确认，确认失败时资金同样会退回
+	ackTxs, err := wm.RestClient.searchTxs(
+		fmt.Sprintf("acknowledge_packet.packet_src_port='%s'", packet.SourcePort),
+		fmt.Sprintf("acknowledge_packet.packet_src_channel='%s'", packet.SourceChannel),
+		fmt.Sprintf("acknowledge_packet.packet_sequence='%d'", packet.Sequence))
+	if err != nil {
+		return nil, err
+	}
+	for _, ackTx := range ackTxs.Get("tx_responses").Array() {
+		packet.Status = IBCPacketAcknowledged
+		for _, l := range ackTx.Get("logs").Array() {
+			if errs := getEventAttributes(&l, "fungible_token_packet", "error"); len(errs) > 0 {
+				packet.Status = IBCPacketAckError
+				packet.Reason = errs[0]
+			}
+		}
+		return packet, nil
+	}
+
+	return packet, nil
+}
+
+//isNoIBCPacketError 交易已上链但没有发出数据包，不需要继续等待
+func isNoIBCPacketError(err error) bool {
+	return strings.Contains(err.Error(), "has not sent any ibc packet")
+}
+
+//WaitIBCPacket 等待IBC转账的数据包被确认或超时。交易还未被索引或查询失败时按配置的间隔重试，
+//交易没有发出数据包时直接返回错误，到达超时时间仍未确认时返回pending状态的数据包
+func (wm *WalletManager) WaitIBCPacket(txid string, timeout time.Duration) (*IBCPacket, error) {
+
+	interval := wm.Config.IBCPacketInterval
+	if interval <= 0 {
+		interval = time.Second * 6
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		packet, err := wm.GetIBCPacket(txid)
+		if err != nil {
+			if isNoIBCPacketError(err) {
+				return nil, err
+			}
+			wm.Log.Warningf("get ibc packet of transaction: %s failed, unexpected error: %v", txid, err)
+		} else if packet.Status != IBCPacketPending {
+			return packet, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("ibc packet of transaction: %s is not found within %v, %v", txid, timeout, err)
+			}
+			return packet, nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+//SetIBCPacketHandler 设置IBC转账的数据包被确认、超时或等待超时后的回调，提交IBC转账后在后台等待数据包的状态
+func (wm *WalletManager) SetIBCPacketHandler(handler func(packet *IBCPacket)) {
+	wm.ibcPacketMu.Lock()
+	defer wm.ibcPacketMu.Unlock()
+	wm.ibcPacketHandler = handler
+}
+
+//notifyIBCPacket 通知数据包的状态
+func (wm *WalletManager) notifyIBCPacket(packet *IBCPacket) {
+	wm.ibcPacketMu.Lock()
+	handler := wm.ibcPacketHandler
+	wm.ibcPacketMu.Unlock()
+	if handler != nil {
+		handler(packet)
+	}
+}
@@ -15,6 +15,14 @@
 
 package cosmos
 
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
 var (
 	tw *WalletManager
 )
@@ -25,3 +33,62 @@ func init() {
 	tw.Config.RpcPassword = ""
 	tw.RestClient = NewClient("https://stargate.cosmos.network", false)
 }
+
+func Test_GetAuthzGrants(t *testing.T) {
+	hot := "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+	cold := "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"
+	sendGrant := `{"granter":"` + cold + `","grantee":"` + hot + `","authorization":{"@type":"/cosmos.bank.v1beta1.SendAuthorization","spend_limit":[{"denom":"uatom","amount":"1000000"}]},"expiration":"2030-01-01T00:00:00Z"}`
+	expiredGrant := `{"granter":"` + cold + `","grantee":"` + hot + `","authorization":{"@type":"/cosmos.authz.v1beta1.GenericAuthorization","msg":"/cosmos.gov.v1beta1.MsgVote"},"expiration":"2020-01-01T00:00:00Z"}`
+	genericGrant := `{"authorization":{"@type":"/cosmos.authz.v1beta1.GenericAuthorization","msg":"/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward"},"expiration":"2030-01-01T00:00:00Z"}`
+
+	legacy := false
+	unavailable := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/cosmos/authz/v1beta1/grants/") && unavailable:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"code":14,"message":"service unavailable"}`)
+		case strings.HasPrefix(r.URL.Path, "/cosmos/authz/v1beta1/grants/") && legacy:
+			w.WriteHeader(http.StatusNotImplemented)
+			fmt.Fprint(w, `{"code":12,"message":"Not Implemented"}`)
+		case r.URL.Path == "/cosmos/authz/v1beta1/grants/granter/"+cold:
+			fmt.Fprintf(w, `{"grants":[%s,%s]}`, sendGrant, expiredGrant)
+		case r.URL.Path == "/cosmos/authz/v1beta1/grants/grantee/"+hot:
+			fmt.Fprintf(w, `{"grants":[%s]}`, sendGrant)
+		case r.URL.Path == "/cosmos/authz/v1beta1/grants" && r.URL.Query().Get("granter") == cold:
+			fmt.Fprintf(w, `{"grants":[%s]}`, genericGrant)
+		default:
+			fmt.Fprint(w, `{"grants":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+
+	//过期的授权被忽略，授权方和被授权方查到的相同授权只返回一次
+	grants, err := wm.GetAuthzGrants(hot, cold)
+	if err != nil {
+		t.Fatalf("get grants failed: %v", err)
+	}
+	if len(grants) != 1 || grants[0].MsgTypeURL != MsgSendTypeURL || grants[0].SpendLimit != "1000000uatom" {
+		t.Fatalf("unexpected grants: %+v", grants)
+	}
+
+	//旧版本节点按地址两两查询
+	legacy = true
+	grants, err = wm.GetAuthzGrants(hot, cold)
+	if err != nil {
+		t.Fatalf("get grants failed: %v", err)
+	}
+	if len(grants) != 1 || grants[0].Granter != cold || grants[0].Grantee != hot ||
+		grants[0].MsgTypeURL != "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward" {
+		t.Errorf("unexpected grants: %+v", grants)
+	}
+
+	//节点暂时不可用时返回错误，不按地址两两查询
+	unavailable = true
+	if _, err = wm.GetAuthzGrants(hot, cold); err == nil {
+		t.Errorf("query grants should fail when node is unavailable")
+	}
+}
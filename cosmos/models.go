@@ -19,11 +19,16 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	owcrypt "github.com/blocktree/go-owcrypt"
+	ow "github.com/blocktree/openwallet/v2/common"
 	"github.com/blocktree/openwallet/v2/crypto"
 	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/cosmos/cosmos-sdk/types"
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/tidwall/gjson"
 )
@@ -37,21 +42,24 @@ type Block struct {
 	Timestamp     uint64
 	PrevBlockHash string
 	Transactions  []string
+	// 交易的原始数据，顺序与Transactions相同
+	TxBytes [][]byte
 }
 
 type TxValue struct {
 	//MsgType string
-	From   string
-	To     string
-	Amount uint64
+	From string
+	To   string
+	//最小单位的数量，18位精度的denom可能超过uint64
+	Amount *big.Int
 	Status string
 	Reason string
-	// Denom  string
+	Denom  string
 }
 
 type FeeValue struct {
-	Amount uint64
-	//	Denom  string
+	Amount *big.Int
+	Denom  string
 }
 
 type Transaction struct {
@@ -62,9 +70,15 @@ type Transaction struct {
 	TimeStamp   uint64
 	TxValue     []TxValue
 	BlockHeight uint64
+	BlockHash   string
 	Memo        string
+	//指定的手续费支付方，为空时由首个签名地址支付
+	FeePayer string
+	//手续费授权方，不为空时手续费从授权方的额度中扣除
+	FeeGranter string
 }
 
+//NewTransaction 解析交易，denom为空时提取所有denom的转账，否则只提取该denom
 func NewTransaction(json *gjson.Result, txType, msgType, denom string) *Transaction {
 
 	obj := &Transaction{}
@@ -79,30 +93,38 @@ func NewTransaction(json *gjson.Result, txType, msgType, denom string) *Transact
 	reason := ""
 	var status string
 
-	//if strings.Contains(json.Get("raw_log").String(), "true") {
-		status = "true"
-	//} else {
-	//	status = "false"
-	//}
-	if logList == nil || len(logList) == 0 {
-		reason = gjson.Get(json.Get("raw_log").String(), "message").String()
+	//按执行结果的错误码判断是否失败，失败的交易仍然扣除手续费，但没有转账
+	status = "true"
+	txResponse := json.Get("tx_response")
+	txResult := NewTxResult(&txResponse)
+	if txResult.Failed() {
+		reason = txResult.FailedReason()
 		status = "false"
+
+		//执行失败的交易不执行任何消息，只由支付方支付手续费，与消息类型无关
+		obj.TxType = "cosmos-sdk/StdTx"
+		obj.TxValue = getFeeValues(json, denom, reason)
+		if len(feeList) > 0 {
+			obj.Fee = []FeeValue{{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()}}
+		}
+		msgList = nil
 	}
-	for _, msg := range msgList {
+	for i, msg := range msgList {
 		if msg.Get("@type").String() == msgType {
 			obj.TxType = "cosmos-sdk/StdTx"
 			for _, coin := range msg.Get("amount").Array() {
-				if coin.Get("denom").String() == denom {
+				if matchDenom(coin.Get("denom").String(), denom) {
 					obj.TxValue = append(obj.TxValue, TxValue{
 						From:   msg.Get("from_address").String(),
 						To:     msg.Get("to_address").String(),
-						Amount: coin.Get("amount").Uint(),
+						Amount: parseAmount(coin.Get("amount").String()),
 						Status: status,
 						Reason: reason,
+						Denom:  coin.Get("denom").String(),
 					})
 
 					if feeList != nil && len(feeList) > 0 {
-						obj.Fee = append(obj.Fee, FeeValue{feeList[0].Get("amount").Uint()})
+						obj.Fee = append(obj.Fee, FeeValue{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()})
 					} else {
 						obj.Fee = nil
 					}
@@ -114,13 +136,14 @@ func NewTransaction(json *gjson.Result, txType, msgType, denom string) *Transact
 			obj.TxType = "cosmos-sdk/StdTx"
 			for _, input := range msg.Get("inputs").Array() {
 				for _, coin := range input.Get("coins").Array() {
-					if coin.Get("denom").String() == denom {
+					if matchDenom(coin.Get("denom").String(), denom) {
 						obj.TxValue = append(obj.TxValue, TxValue{
 							From:   input.Get("address").String(),
 							To:     "multiaddress",
-							Amount: coin.Get("amount").Uint(),
+							Amount: parseAmount(coin.Get("amount").String()),
 							Status: status,
 							Reason: reason,
+							Denom:  coin.Get("denom").String(),
 						})
 					}
 				}
@@ -128,23 +151,112 @@ func NewTransaction(json *gjson.Result, txType, msgType, denom string) *Transact
 
 			for _, output := range msg.Get("outputs").Array() {
 				for _, coin := range output.Get("coins").Array() {
-					if coin.Get("denom").String() == denom {
+					if matchDenom(coin.Get("denom").String(), denom) {
 						obj.TxValue = append(obj.TxValue, TxValue{
 							From:   "multiaddress",
 							To:     output.Get("address").String(),
-							Amount: coin.Get("amount").Uint(),
+							Amount: parseAmount(coin.Get("amount").String()),
 							Status: status,
 							Reason: reason,
+							Denom:  coin.Get("denom").String(),
 						})
 					}
 				}
 			}
 			if feeList != nil && len(feeList) > 0 {
-				obj.Fee = append(obj.Fee, FeeValue{feeList[0].Get("amount").Uint()})
+				obj.Fee = append(obj.Fee, FeeValue{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()})
 			} else {
 				obj.Fee = nil
 			}
 		}
+		if msg.Get("@type").String() == "/ibc.applications.transfer.v1.MsgTransfer" {
+			obj.TxType = "cosmos-sdk/StdTx"
+			if matchDenom(msg.Get("token").Get("denom").String(), denom) {
+				obj.TxValue = append(obj.TxValue, TxValue{
+					From:   msg.Get("sender").String(),
+					To:     msg.Get("receiver").String(),
+					Amount: parseAmount(msg.Get("token").Get("amount").String()),
+					Status: status,
+					Reason: reason,
+					Denom:  msg.Get("token").Get("denom").String(),
+				})
+
+				if feeList != nil && len(feeList) > 0 {
+					obj.Fee = append(obj.Fee, FeeValue{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()})
+				} else {
+					obj.Fee = nil
+				}
+			}
+		}
+		if refund := getIBCRefund(&msg, getMsgLog(logList, i)); refund != nil {
+			//IBC转账超时或确认失败，资金从托管账户退回发送地址，数据包中的denom为跨链路径，退回的是本链的denom
+			obj.TxType = "cosmos-sdk/StdTx"
+			refundDenom := ibctransfertypes.ParseDenomTrace(refund.Get("denom").String()).IBCDenom()
+			if matchDenom(refundDenom, denom) {
+				obj.TxValue = append(obj.TxValue, TxValue{
+					From:   refund.Get("receiver").String(),
+					To:     refund.Get("sender").String(),
+					Amount: parseAmount(refund.Get("amount").String()),
+					Status: status,
+					Reason: reason,
+					Denom:  refundDenom,
+				})
+
+				if feeList != nil && len(feeList) > 0 {
+					obj.Fee = append(obj.Fee, FeeValue{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()})
+				} else {
+					obj.Fee = nil
+				}
+			}
+		}
+		if receive, receiveDenom := getIBCReceive(&msg, getMsgLog(logList, i)); receive != nil {
+			//其他链通过IBC转入，本链收到的是凭证denom，或退回本链的原始denom
+			obj.TxType = "cosmos-sdk/StdTx"
+			if matchDenom(receiveDenom, denom) {
+				obj.TxValue = append(obj.TxValue, TxValue{
+					From:   receive.Get("sender").String(),
+					To:     receive.Get("receiver").String(),
+					Amount: parseAmount(receive.Get("amount").String()),
+					Status: status,
+					Reason: reason,
+					Denom:  receiveDenom,
+				})
+
+				if feeList != nil && len(feeList) > 0 {
+					obj.Fee = append(obj.Fee, FeeValue{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()})
+				} else {
+					obj.Fee = nil
+				}
+			}
+		}
+		if msg.Get("@type").String() == "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward" ||
+			msg.Get("@type").String() == "/cosmos.distribution.v1beta1.MsgWithdrawValidatorCommission" {
+			//收益和佣金的实际到账记录在消息执行日志的transfer事件中
+			msgLog := getMsgLog(logList, i)
+			if msgLog == nil {
+				continue
+			}
+			obj.TxType = "cosmos-sdk/StdTx"
+			validator := msg.Get("validator_address").String()
+			for _, transfer := range getTransferEvents(msgLog) {
+				for _, coin := range getCoins(transfer.Amount, denom) {
+					obj.TxValue = append(obj.TxValue, TxValue{
+						From:   validator,
+						To:     transfer.Recipient,
+						Amount: coin.Amount.BigInt(),
+						Status: status,
+						Reason: reason,
+						Denom:  coin.Denom,
+					})
+
+					if feeList != nil && len(feeList) > 0 {
+						obj.Fee = append(obj.Fee, FeeValue{parseAmount(feeList[0].Get("amount").String()), feeList[0].Get("denom").String()})
+					} else {
+						obj.Fee = nil
+					}
+				}
+			}
+		}
 	}
 
 	if obj.TxType != txType {
@@ -158,9 +270,193 @@ func NewTransaction(json *gjson.Result, txType, msgType, denom string) *Transact
 	obj.TimeStamp = json.Get("tx_response").Get("timestamp").Uint()
 	obj.BlockHeight = json.Get("tx_response").Get("height").Uint()
 	obj.Memo = json.Get("tx").Get("body").Get("memo").String()
+	obj.FeePayer = json.Get("tx").Get("auth_info").Get("fee").Get("payer").String()
+	obj.FeeGranter = json.Get("tx").Get("auth_info").Get("fee").Get("granter").String()
 	return obj
 }
 
+//getFeeValues 按auth_info生成执行失败的交易扣除的手续费，未指定支付方时由首个签名者支付
+func getFeeValues(json *gjson.Result, denom, reason string) []TxValue {
+	payer := json.Get("tx").Get("auth_info").Get("fee").Get("payer").String()
+	if payer == "" {
+		tx, err := newEncodingConfig().TxConfig.TxJSONDecoder()([]byte(json.Get("tx").Raw))
+		if feeTx, ok := tx.(types.FeeTx); err == nil && ok {
+			payer = feeTx.FeePayer().String()
+		}
+	}
+	if payer == "" {
+		//未注册的消息类型无法解码，取首个消息的发送方
+		msg := json.Get("tx").Get("body").Get("messages.0")
+		for _, key := range []string{"from_address", "delegator_address", "voter", "sender", "grantee", "depositor", "proposer"} {
+			if payer = msg.Get(key).String(); payer != "" {
+				break
+			}
+		}
+	}
+
+	values := make([]TxValue, 0)
+	for _, coin := range json.Get("tx").Get("auth_info").Get("fee").Get("amount").Array() {
+		if !matchDenom(coin.Get("denom").String(), denom) {
+			continue
+		}
+		values = append(values, TxValue{
+			From:   payer,
+			Amount: parseAmount(coin.Get("amount").String()),
+			Status: "false",
+			Reason: reason,
+			Denom:  coin.Get("denom").String(),
+		})
+	}
+	return values
+}
+
+type TransferEvent struct {
+	Sender    string
+	Recipient string
+	Amount    string
+}
+
+//getMsgLog 获取指定消息的执行日志
+func getMsgLog(logList []gjson.Result, msgIndex int) *gjson.Result {
+	for i := range logList {
+		//msg_index为0时会被省略，读取结果同样为0
+		if logList[i].Get("msg_index").Int() == int64(msgIndex) {
+			return &logList[i]
+		}
+	}
+	return nil
+}
+
+//getEventAttributes 获取日志中指定事件的属性值
+func getEventAttributes(msgLog *gjson.Result, eventType, key string) []string {
+	values := make([]string, 0)
+	for _, event := range msgLog.Get("events").Array() {
+		if event.Get("type").String() != eventType {
+			continue
+		}
+		for _, attr := range event.Get("attributes").Array() {
+			if attr.Get("key").String() == key {
+				values = append(values, attr.Get("value").String())
+			}
+		}
+	}
+	return values
+}
+
+//getTransferEvents 获取日志中的transfer事件，每个转账由recipient、sender、amount三个属性组成
+func getTransferEvents(msgLog *gjson.Result) []TransferEvent {
+	transfers := make([]TransferEvent, 0)
+	for _, event := range msgLog.Get("events").Array() {
+		if event.Get("type").String() != "transfer" {
+			continue
+		}
+		var transfer *TransferEvent
+		for _, attr := range event.Get("attributes").Array() {
+			switch attr.Get("key").String() {
+			case "recipient":
+				if transfer != nil {
+					transfers = append(transfers, *transfer)
+				}
+				transfer = &TransferEvent{Recipient: attr.Get("value").String()}
+			case "sender":
+				if transfer != nil {
+					transfer.Sender = attr.Get("value").String()
+				}
+			case "amount":
+				if transfer != nil {
+					transfer.Amount = attr.Get("value").String()
+				}
+			}
+		}
+		if transfer != nil {
+			transfers = append(transfers, *transfer)
+		}
+	}
+	return transfers
+}
+
+//getIBCRefund 获取IBC退款的数据包内容，只有超时或确认失败并执行成功的消息才会退款
+func getIBCRefund(msg *gjson.Result, msgLog *gjson.Result) *gjson.Result {
+	if msgLog == nil {
+		return nil
+	}
+	switch msg.Get("@type").String() {
+	case "/ibc.core.channel.v1.MsgTimeout", "/ibc.core.channel.v1.MsgTimeoutOnClose":
+		if len(getEventAttributes(msgLog, "timeout", "refund_receiver")) == 0 {
+			return nil
+		}
+	case "/ibc.core.channel.v1.MsgAcknowledgement":
+		ack, _ := base64.StdEncoding.DecodeString(msg.Get("acknowledgement").String())
+		if !gjson.GetBytes(ack, "error").Exists() {
+			return nil
+		}
+	default:
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(msg.Get("packet").Get("data").String())
+	if err != nil {
+		return nil
+	}
+	packetData := gjson.ParseBytes(data)
+	return &packetData
+}
+
+//matchDenom 是否提取该denom，filter为空时提取所有denom
+func matchDenom(denom, filter string) bool {
+	return len(denom) > 0 && (filter == "" || denom == filter)
+}
+
+//getCoins 从形如 100uatom,20ibc/xxx 的数量字符串中获取数量不为0的币，filter不为空时只返回该denom
+func getCoins(coinsStr, filter string) types.Coins {
+	coins, err := types.ParseCoinsNormalized(coinsStr)
+	if err != nil {
+		return nil
+	}
+	result := make(types.Coins, 0, len(coins))
+	for _, coin := range coins {
+		if coin.IsPositive() && matchDenom(coin.Denom, filter) {
+			result = append(result, coin)
+		}
+	}
+	return result
+}
+
+//parseAmount 解析最小单位的数量，无法解析时为0
+func parseAmount(amount string) *big.Int {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return big.NewInt(0)
+	}
+	return value
+}
+
+//getIBCReceive 获取IBC转入的数据包内容和本链收到的denom，只有执行成功的消息才会到账
+func getIBCReceive(msg *gjson.Result, msgLog *gjson.Result) (*gjson.Result, string) {
+	if msgLog == nil || msg.Get("@type").String() != "/ibc.core.channel.v1.MsgRecvPacket" {
+		return nil, ""
+	}
+	success := getEventAttributes(msgLog, ibctransfertypes.EventTypePacket, ibctransfertypes.AttributeKeyAckSuccess)
+	if len(success) == 0 || success[0] != "true" {
+		return nil, ""
+	}
+	packet := msg.Get("packet")
+	data, err := base64.StdEncoding.DecodeString(packet.Get("data").String())
+	if err != nil {
+		return nil, ""
+	}
+	packetData := gjson.ParseBytes(data)
+	denom := packetData.Get("denom").String()
+	sourcePort := packet.Get("source_port").String()
+	sourceChannel := packet.Get("source_channel").String()
+	if ibctransfertypes.ReceiverChainIsSource(sourcePort, sourceChannel, denom) {
+		//本链发出的币退回，去掉对方链的路径前缀
+		denom = denom[len(ibctransfertypes.GetDenomPrefix(sourcePort, sourceChannel)):]
+	} else {
+		denom = ibctransfertypes.GetDenomPrefix(packet.Get("destination_port").String(), packet.Get("destination_channel").String()) + denom
+	}
+	return &packetData, ibctransfertypes.ParseDenomTrace(denom).IBCDenom()
+}
+
 func NewBlock(json *gjson.Result) *Block {
 	obj := &Block{}
 
@@ -180,6 +476,7 @@ func NewBlock(json *gjson.Result) *Block {
 		for _, tx := range txs {
 			txid, _ := base64.StdEncoding.DecodeString(tx.String())
 			obj.Transactions = append(obj.Transactions, hex.EncodeToString(owcrypt.Hash(txid, 0, owcrypt.HASH_ALG_SHA256)))
+			obj.TxBytes = append(obj.TxBytes, txid)
 		}
 	//}
 
@@ -203,6 +500,208 @@ func (b *Block) BlockHeader() *openwallet.BlockHeader {
 	return &obj
 }
 
+//Proposal 治理提案
+type Proposal struct {
+	ProposalID      uint64
+	Title           string
+	Description     string
+	Status          string
+	VotingStartTime string
+	VotingEndTime   string
+	//地址的投票选项，未投票的地址不在其中
+	Votes map[string]string
+}
+
+func NewProposal(json *gjson.Result) *Proposal {
+	obj := &Proposal{}
+	obj.ProposalID = json.Get("proposal_id").Uint()
+	obj.Title = json.Get("content").Get("title").String()
+	obj.Description = json.Get("content").Get("description").String()
+	obj.Status = json.Get("status").String()
+	obj.VotingStartTime = json.Get("voting_start_time").String()
+	obj.VotingEndTime = json.Get("voting_end_time").String()
+	obj.Votes = make(map[string]string)
+	return obj
+}
+
+//IBC转账的数据包状态
+const (
+	IBCPacketPending      = "pending"
+	IBCPacketAcknowledged = "acknowledged"
+	IBCPacketTimeout      = "timeout"
+	IBCPacketAckError     = "ack_error"
+)
+
+//IBCPacket IBC转账发出的数据包
+type IBCPacket struct {
+	TxID             string
+	Sequence         uint64
+	SourcePort       string
+	SourceChannel    string
+	DestPort         string
+	DestChannel      string
+	TimeoutHeight    string
+	TimeoutTimestamp uint64
+	Status           string
+	Reason           string
+}
+
+//NewIBCPacket 从交易日志的send_packet事件解析数据包
+func NewIBCPacket(txid string, msgLog *gjson.Result) *IBCPacket {
+	attr := func(key string) string {
+		values := getEventAttributes(msgLog, "send_packet", key)
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+	if attr("packet_sequence") == "" {
+		return nil
+	}
+	obj := &IBCPacket{}
+	obj.TxID = txid
+	obj.Sequence = ow.NewString(attr("packet_sequence")).UInt64()
+	obj.SourcePort = attr("packet_src_port")
+	obj.SourceChannel = attr("packet_src_channel")
+	obj.DestPort = attr("packet_dst_port")
+	obj.DestChannel = attr("packet_dst_channel")
+	obj.TimeoutHeight = attr("packet_timeout_height")
+	obj.TimeoutTimestamp = ow.NewString(attr("packet_timeout_timestamp")).UInt64()
+	obj.Status = IBCPacketPending
+	return obj
+}
+
+//AuthzGrant x/authz的授权
+type AuthzGrant struct {
+	Granter string
+	Grantee string
+	//授权类型，如/cosmos.bank.v1beta1.SendAuthorization
+	Authorization string
+	//授权执行的消息类型
+	MsgTypeURL string
+	//send授权剩余的转账额度，如1000uatom
+	SpendLimit string
+	//过期时间，RFC3339格式，为空时不过期
+	Expiration string
+}
+
+func NewAuthzGrant(json *gjson.Result) *AuthzGrant {
+	obj := &AuthzGrant{}
+	obj.Granter = json.Get("granter").String()
+	obj.Grantee = json.Get("grantee").String()
+	obj.Authorization = json.Get("authorization").Get("@type").String()
+	obj.MsgTypeURL = json.Get("authorization").Get("msg").String()
+	if obj.MsgTypeURL == "" && strings.HasSuffix(obj.Authorization, ".SendAuthorization") {
+		obj.MsgTypeURL = MsgSendTypeURL
+	}
+	limits := make([]string, 0)
+	for _, c := range json.Get("authorization").Get("spend_limit").Array() {
+		limits = append(limits, c.Get("amount").String()+c.Get("denom").String())
+	}
+	obj.SpendLimit = strings.Join(limits, ",")
+	obj.Expiration = json.Get("expiration").String()
+	return obj
+}
+
+//IsExpired 授权是否已过期
+func (g *AuthzGrant) IsExpired(now time.Time) bool {
+	if g.Expiration == "" {
+		return false
+	}
+	expiration, err := time.Parse(time.RFC3339Nano, g.Expiration)
+	if err != nil {
+		return false
+	}
+	return !expiration.After(now)
+}
+
+//TxResult 交易上链后的执行结果
+type TxResult struct {
+	TxHash    string
+	Height    uint64
+	Code      uint32
+	Codespace string
+	RawLog    string
+	GasWanted uint64
+	GasUsed   uint64
+	Timestamp string
+}
+
+func NewTxResult(json *gjson.Result) *TxResult {
+	obj := &TxResult{}
+	obj.TxHash = json.Get("txhash").String()
+	obj.Height = json.Get("height").Uint()
+	obj.Code = uint32(json.Get("code").Uint())
+	obj.Codespace = json.Get("codespace").String()
+	obj.RawLog = json.Get("raw_log").String()
+	obj.GasWanted = json.Get("gas_wanted").Uint()
+	obj.GasUsed = json.Get("gas_used").Uint()
+	obj.Timestamp = json.Get("timestamp").String()
+	return obj
+}
+
+//Failed 交易是否执行失败
+func (r *TxResult) Failed() bool {
+	return r.Code != 0
+}
+
+//FailedReason 执行失败的原因，包括错误码所属模块、错误码和节点返回的日志
+func (r *TxResult) FailedReason() string {
+	return fmt.Sprintf("codespace: %s, code: %d, %s", r.Codespace, r.Code, r.RawLog)
+}
+
+//DenomTrace ibc凭证的来源路径和原始denom
+type DenomTrace struct {
+	//经过的端口和通道，如transfer/channel-141
+	Path      string
+	BaseDenom string
+}
+
+func NewDenomTrace(json *gjson.Result) *DenomTrace {
+	obj := &DenomTrace{}
+	obj.Path = json.Get("path").String()
+	obj.BaseDenom = json.Get("base_denom").String()
+	return obj
+}
+
+//FullPath 完整的denom路径，如transfer/channel-141/uosmo
+func (dt *DenomTrace) FullPath() string {
+	if dt.Path == "" {
+		return dt.BaseDenom
+	}
+	return dt.Path + "/" + dt.BaseDenom
+}
+
+//DenomMetadata x/bank登记的denom元数据
+type DenomMetadata struct {
+	Base    string
+	Display string
+	Name    string
+	Symbol  string
+	//显示单位的精度
+	Decimals uint64
+}
+
+func NewDenomMetadata(json *gjson.Result) *DenomMetadata {
+	obj := &DenomMetadata{}
+	obj.Base = json.Get("base").String()
+	obj.Display = json.Get("display").String()
+	obj.Name = json.Get("name").String()
+	obj.Symbol = json.Get("symbol").String()
+	//显示单位的exponent为精度，没有显示单位时取最大的exponent
+	for _, unit := range json.Get("denom_units").Array() {
+		exponent := unit.Get("exponent").Uint()
+		if unit.Get("denom").String() == obj.Display {
+			obj.Decimals = exponent
+			break
+		}
+		if exponent > obj.Decimals {
+			obj.Decimals = exponent
+		}
+	}
+	return obj
+}
+
 //UnscanRecords 扫描失败的区块及交易
 type UnscanRecord struct {
 	ID          string `storm:"id"` // primary key
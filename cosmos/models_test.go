@@ -0,0 +1,144 @@
+package cosmos
+
+import (
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	"github.com/tidwall/gjson"
+)
+
+func loadTestTransaction(t *testing.T, name string) *gjson.Result {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read test data failed: %v", err)
+	}
+	json := gjson.ParseBytes(data)
+	return &json
+}
+
+func Test_NewTransaction_withdrawRewards(t *testing.T) {
+	json := loadTestTransaction(t, "tx_withdraw_rewards.json")
+
+	trx := NewTransaction(json, "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "uatom")
+	if len(trx.TxValue) != 2 {
+		t.Fatalf("expected 2 reward payouts, got %d", len(trx.TxValue))
+	}
+
+	amounts := []uint64{120345, 7788}
+	for i, v := range trx.TxValue {
+		if v.To != "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9" {
+			t.Errorf("payout %d has wrong recipient: %s", i, v.To)
+		}
+		if v.Amount.Uint64() != amounts[i] {
+			t.Errorf("payout %d expected amount %d, got %d", i, amounts[i], v.Amount)
+		}
+		if v.Status != "true" {
+			t.Errorf("payout %d expected success status", i)
+		}
+	}
+}
+
+func Test_NewTransaction_ibcTimeoutRefund(t *testing.T) {
+	json := loadTestTransaction(t, "tx_ibc_timeout.json")
+
+	trx := NewTransaction(json, "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "uatom")
+	if len(trx.TxValue) != 1 {
+		t.Fatalf("expected 1 refund, got %d", len(trx.TxValue))
+	}
+	refund := trx.TxValue[0]
+	if refund.To != "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9" || refund.Amount.Int64() != 1000000 {
+		t.Errorf("unexpected refund: %+v", refund)
+	}
+}
+
+func Test_NewTransaction_multiDenom(t *testing.T) {
+	json := loadTestTransaction(t, "tx_multi_denom.json")
+	usdc := "ibc/CDC4587874B85BEA4FCEC3CEA5A1195139799A1FEE711A07D972537E18FDA39D"
+	osmo := ibctransfertypes.ParseDenomTrace("transfer/channel-141/uosmo").IBCDenom()
+
+	//不指定denom时提取全部denom的转账
+	trx := NewTransaction(json, "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "")
+	if len(trx.TxValue) != 3 {
+		t.Fatalf("expected 3 transfers, got %d", len(trx.TxValue))
+	}
+	expected := []TxValue{
+		{From: "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n", To: "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9", Amount: big.NewInt(25000000), Denom: usdc},
+		{From: "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n", To: "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9", Amount: big.NewInt(1000000), Denom: "uatom"},
+		{From: "osmo1djhe9ury7c05gu5ptjefv0uj9gp48a90r8u8fs", To: "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9", Amount: big.NewInt(5000000), Denom: osmo},
+	}
+	for i, v := range trx.TxValue {
+		if v.From != expected[i].From || v.To != expected[i].To || v.Amount.Cmp(expected[i].Amount) != 0 || v.Denom != expected[i].Denom {
+			t.Errorf("transfer %d expected %+v, got %+v", i, expected[i], v)
+		}
+	}
+	if len(trx.Fee) == 0 || trx.Fee[0].Amount.Int64() != 2500 || trx.Fee[0].Denom != "uatom" {
+		t.Errorf("unexpected fee: %+v", trx.Fee)
+	}
+
+	//指定denom时只提取该denom
+	trx = NewTransaction(json, "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", osmo)
+	if len(trx.TxValue) != 1 || trx.TxValue[0].Denom != osmo {
+		t.Errorf("unexpected transfers of denom %s: %+v", osmo, trx.TxValue)
+	}
+}
+
+func Test_NewTransaction_failed(t *testing.T) {
+	cases := []struct {
+		name   string
+		fee    uint64
+		reason string
+	}{
+		{"tx_failed_send.json", 2500, "codespace: sdk, code: 5, failed to execute message; message index: 0: 120000000uatom is smaller than 500000000uatom: insufficient funds"},
+		{"tx_failed_ibc.json", 3000, "codespace: sdk, code: 11, out of gas in location: WriteFlat; gasWanted: 120000, gasUsed: 121847: out of gas"},
+	}
+	for _, c := range cases {
+		//执行失败的交易只记录发送地址支付的手续费，不记录转账
+		trx := NewTransaction(loadTestTransaction(t, c.name), "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "")
+		if len(trx.TxValue) != 1 || len(trx.Fee) != 1 {
+			t.Fatalf("%s: unexpected transaction: %+v", c.name, trx)
+		}
+		v := trx.TxValue[0]
+		if v.From != "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9" || v.To != "" || v.Status != "false" || v.Reason != c.reason ||
+			v.Denom != "uatom" || v.Amount.Uint64() != c.fee {
+			t.Errorf("%s: unexpected value: %+v", c.name, v)
+		}
+		if trx.Fee[0].Amount.Uint64() != c.fee || trx.Fee[0].Denom != "uatom" {
+			t.Errorf("%s: unexpected fee: %+v", c.name, trx.Fee)
+		}
+	}
+
+	//任何消息类型执行失败都记录手续费，未指定支付方时由首个签名者支付
+	failed := func(msg, payer string) *gjson.Result {
+		json := gjson.Parse(`{"tx":{"body":{"messages":[` + msg + `]},"auth_info":{"signer_infos":[],` +
+			`"fee":{"amount":[{"denom":"uatom","amount":"2500"}],"gas_limit":"200000","payer":"` + payer + `","granter":""}},"signatures":[]},` +
+			`"tx_response":{"code":5,"codespace":"sdk","raw_log":"failed","logs":[]}}`)
+		return &json
+	}
+	commission := `{"@type":"/cosmos.distribution.v1beta1.MsgWithdrawValidatorCommission","validator_address":"cosmosvaloper1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u2lcnj0"}`
+	delegate := `{"@type":"/cosmos.staking.v1beta1.MsgDelegate","delegator_address":"cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",` +
+		`"validator_address":"cosmosvaloper1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u2lcnj0","amount":{"denom":"uatom","amount":"1000000"}}`
+	payers := []struct {
+		msg   string
+		payer string
+		from  string
+	}{
+		{commission, "", "cosmos1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u0tvx7u"},
+		{delegate, "", "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"},
+		{delegate, "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n", "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"},
+	}
+	for _, c := range payers {
+		trx := NewTransaction(failed(c.msg, c.payer), "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", "")
+		if len(trx.TxValue) != 1 || trx.TxValue[0].From != c.from || trx.TxValue[0].Amount.Int64() != 2500 || trx.TxValue[0].Status != "false" {
+			t.Errorf("unexpected fee of failed transaction: %+v", trx.TxValue)
+		}
+	}
+
+	//成功的交易没有执行日志时不作为失败
+	json := gjson.Parse(`{"tx":{"body":{"messages":[{"@type":"/cosmos.bank.v1beta1.MsgSend","from_address":"a","to_address":"b","amount":[{"denom":"uatom","amount":"1"}]}]}},"tx_response":{"code":0,"logs":[]}}`)
+	if trx := NewTransaction(&json, "cosmos-sdk/StdTx", "/cosmos.bank.v1beta1.MsgSend", ""); len(trx.TxValue) != 1 || trx.TxValue[0].Status != "true" {
+		t.Errorf("unexpected transaction: %+v", trx)
+	}
+}
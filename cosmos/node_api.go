@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/blocktree/openwallet/v2/log"
@@ -29,6 +30,12 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// 按高度搜索区块交易时每页的数量
+const blockTxsPageLimit = 100
+
+// 查询交易池时的最大数量，节点不支持分页查询交易池
+const unconfirmedTxsLimit = 100
+
 type ClientInterface interface {
 	Call(path string, request []interface{}) (*gjson.Result, error)
 }
@@ -115,12 +122,28 @@ func (b *Client) isError(resp *req.Resp) error {
 	}
 
 	if resp.Response().StatusCode != http.StatusOK {
-		return fmt.Errorf("%s", resp.String())
+		return &HTTPError{StatusCode: resp.Response().StatusCode, Body: resp.String()}
 	}
 
 	return nil
 }
 
+//HTTPError 节点返回非200的状态码，错误信息为返回的内容
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Body
+}
+
+//isUnimplementedError 节点不支持该接口（404或501），其他错误如超时和5xx不视为不支持
+func isUnimplementedError(err error) bool {
+	hErr, ok := err.(*HTTPError)
+	return ok && (hErr.StatusCode == http.StatusNotFound || hErr.StatusCode == http.StatusNotImplemented)
+}
+
 // See 2 (end of page 4) http://www.ietf.org/rfc/rfc2617.txt
 // "To receive authorization, the client sends the userid and password,
 // separated by a single colon (":") character, within a base64
@@ -225,13 +248,194 @@ func (c *Client) getBalance(address string, denom string) (*AddrBalance, error)
 
 	for _, coin := range coins {
 		if coin.Get("denom").String() == denom {
-			return &AddrBalance{Address: address, Balance: big.NewInt(coin.Get("amount").Int())}, nil
+			//代币的数量可能超出int64的范围
+			balance, ok := new(big.Int).SetString(coin.Get("amount").String(), 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid balance: %s of denom: %s", coin.Get("amount").String(), denom)
+			}
+			return &AddrBalance{Address: address, Balance: balance}, nil
 		}
 	}
 
 	return &AddrBalance{Address: address, Balance: big.NewInt(0)}, nil
 }
 
+// 获取地址全部denom的余额，按分页查询全部结果
+func (c *Client) getAllBalances(address string) (map[string]*big.Int, error) {
+	balances := make(map[string]*big.Int)
+	nextKey := ""
+	for {
+		path := "/cosmos/bank/v1beta1/balances/" + address
+		if nextKey != "" {
+			path += "?pagination.key=" + url.QueryEscape(nextKey)
+		}
+
+		resp, err := c.Call(path, nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, coin := range resp.Get("balances").Array() {
+			amount, ok := new(big.Int).SetString(coin.Get("amount").String(), 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid balance: %s of denom: %s", coin.Get("amount").String(), coin.Get("denom").String())
+			}
+			balances[coin.Get("denom").String()] = amount
+		}
+
+		nextKey = resp.Get("pagination.next_key").String()
+		if nextKey == "" {
+			return balances, nil
+		}
+	}
+}
+
+// 获取ibc凭证的denom路径，hash为ibc/之后的部分，不存在时返回nil
+func (c *Client) getDenomTrace(hash string) (*DenomTrace, error) {
+	path := "/ibc/apps/transfer/v1/denom_traces/" + hash
+
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	trace := resp.Get("denom_trace")
+	if !trace.Exists() {
+		return nil, nil
+	}
+	return NewDenomTrace(&trace), nil
+}
+
+// 获取denom的元数据，未登记时返回nil。ibc/...等含有路径的denom转义后作为路径参数，
+// 节点不支持该路径时分页查询全部元数据
+func (c *Client) getDenomMetadata(denom string) (*DenomMetadata, error) {
+	path := "/cosmos/bank/v1beta1/denoms_metadata/" + url.PathEscape(denom)
+
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		//denom未登记元数据
+		if strings.Contains(err.Error(), "client metadata for denom") {
+			return nil, nil
+		}
+		if isUnimplementedError(err) {
+			return c.findDenomMetadata(denom)
+		}
+		return nil, err
+	}
+
+	metadata := resp.Get("metadata")
+	if !metadata.Exists() {
+		return nil, nil
+	}
+	return NewDenomMetadata(&metadata), nil
+}
+
+// 分页查询全部denom的元数据，按base查找denom，未登记时返回nil
+func (c *Client) findDenomMetadata(denom string) (*DenomMetadata, error) {
+	nextKey := ""
+	for {
+		path := "/cosmos/bank/v1beta1/denoms_metadata"
+		if nextKey != "" {
+			path += "?pagination.key=" + url.QueryEscape(nextKey)
+		}
+
+		resp, err := c.Call(path, nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, metadata := range resp.Get("metadatas").Array() {
+			if metadata.Get("base").String() == denom {
+				return NewDenomMetadata(&metadata), nil
+			}
+		}
+
+		nextKey = resp.Get("pagination.next_key").String()
+		if nextKey == "" {
+			return nil, nil
+		}
+	}
+}
+
+//isNotFoundError 节点返回的查询对象不存在的错误，gRPC的NotFound错误码为5
+func isNotFoundError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(strings.ToLower(msg), "not found") || gjson.Get(msg, "code").Int() == 5
+}
+
+// 获取区块中每个交易的执行结果，为tendermint的RPC接口
+func (c *Client) getBlockResults(height uint64) ([]gjson.Result, error) {
+	path := fmt.Sprintf("/block_results?height=%d", height)
+
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Get("result.txs_results").Array(), nil
+}
+
+// 查询节点交易池中的交易哈希（大写），交易池中的交易超过单次查询的数量时complete为false
+func (c *Client) getUnconfirmedTxHashes() (map[string]bool, bool, error) {
+	path := fmt.Sprintf("/unconfirmed_txs?limit=%d", unconfirmedTxsLimit)
+
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := resp.Get("result")
+	hashes := make(map[string]bool)
+	for _, tx := range result.Get("txs").Array() {
+		txBytes, err := base64.StdEncoding.DecodeString(tx.String())
+		if err != nil {
+			return nil, false, err
+		}
+		hashes[getTxHash(txBytes)] = true
+	}
+
+	return hashes, result.Get("n_txs").Uint() >= result.Get("total").Uint(), nil
+}
+
+// 按高度搜索区块中的全部交易和执行结果，分页获取，返回大写的交易哈希到交易内容的映射，交易内容与按哈希查询的格式相同
+func (c *Client) getBlockTransactions(height uint64) (map[string]*gjson.Result, error) {
+	txs := make(map[string]*gjson.Result)
+	offset := 0
+	for {
+		path := fmt.Sprintf("/cosmos/tx/v1beta1/txs?events=%s&pagination.offset=%d&pagination.limit=%d",
+			url.QueryEscape(fmt.Sprintf("tx.height=%d", height)), offset, blockTxsPageLimit)
+
+		resp, err := c.Call(path, nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		txList := resp.Get("txs").Array()
+		txResponses := resp.Get("tx_responses").Array()
+		for i, txResponse := range txResponses {
+			tx := txResponse.Get("tx")
+			if i < len(txList) {
+				tx = txList[i]
+			}
+			trans := gjson.Parse(fmt.Sprintf(`{"tx":%s,"tx_response":%s}`, tx.Raw, txResponse.Raw))
+			txs[strings.ToUpper(txResponse.Get("txhash").String())] = &trans
+		}
+		offset += len(txResponses)
+
+		//v0.46之后总数不在分页信息中
+		total := resp.Get("pagination.total")
+		if !total.Exists() {
+			total = resp.Get("total")
+		}
+		if len(txResponses) == 0 || uint64(offset) >= total.Uint() {
+			return txs, nil
+		}
+	}
+}
+
 // 获取区块信息
 func (c *Client) getBlock(hash string) (*Block, error) {
 	path := "blocks/signature/" + hash
@@ -257,7 +461,7 @@ func (c *Client) getBlockByHeight(height uint64) (*Block, error) {
 	return NewBlock(resp), nil
 }
 
-func (c *Client) sendTransaction(txBytes string) (string, error) {
+func (c *Client) sendTransaction(txBytes string, mode string) (string, error) {
 
 	path := "/cosmos/tx/v1beta1/txs"
 	var (
@@ -271,14 +475,184 @@ func (c *Client) sendTransaction(txBytes string) (string, error) {
 
 	dat["tx_bytes"] = tx_bytes
 	dat["mode"] = "BROADCAST_MODE_SYNC"
+	if mode == BroadcastModeAsync {
+		dat["mode"] = "BROADCAST_MODE_ASYNC"
+	}
 
 	resp, err := c.Call(path, req.BodyJSON(&dat), "POST")
 	if err != nil {
 		return "", err
 	}
 	if resp.Get("tx_response").Get("code").Uint() != 0 && resp.Get("tx_response").Get("raw_log").String() != "[]" {
-		return "", errors.New(resp.Get("tx_response").Get("raw_log").String())
+		return "", &BroadcastError{
+			Code:      uint32(resp.Get("tx_response").Get("code").Uint()),
+			Codespace: resp.Get("tx_response").Get("codespace").String(),
+			RawLog:    resp.Get("tx_response").Get("raw_log").String(),
+		}
 	}
 
 	return resp.Get("tx_response").Get("txhash").String(), nil
 }
+
+// 查询交易的执行结果，交易还未上链时返回nil
+func (c *Client) getTxResult(txid string) (*TxResult, error) {
+	path := "/cosmos/tx/v1beta1/txs/" + txid
+
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !resp.Get("tx_response").Exists() {
+		return nil, nil
+	}
+	txResponse := resp.Get("tx_response")
+	return NewTxResult(&txResponse), nil
+}
+
+// 模拟交易，返回消耗的gas
+func (c *Client) simulateTransaction(txBytes []byte) (uint64, error) {
+	path := "/cosmos/tx/v1beta1/simulate"
+	var (
+		dat = make(map[string]interface{}, 0)
+	)
+	dat["tx_bytes"] = txBytes
+
+	resp, err := c.Call(path, req.BodyJSON(&dat), "POST")
+	if err != nil {
+		return 0, err
+	}
+
+	gasUsed := resp.Get("gas_info.gas_used").Uint()
+	if gasUsed == 0 {
+		return 0, fmt.Errorf("simulate transaction failed: %s", resp.Raw)
+	}
+	return gasUsed, nil
+}
+
+// 获取委托人的所有验证人地址，按分页查询全部结果
+func (c *Client) getDelegatorValidators(address string) ([]string, error) {
+	validators := make([]string, 0)
+	nextKey := ""
+	for {
+		path := "/cosmos/staking/v1beta1/delegations/" + address
+		if nextKey != "" {
+			path += "?pagination.key=" + url.QueryEscape(nextKey)
+		}
+
+		resp, err := c.Call(path, nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range resp.Get("delegation_responses").Array() {
+			validators = append(validators, d.Get("delegation").Get("validator_address").String())
+		}
+
+		nextKey = resp.Get("pagination.next_key").String()
+		if nextKey == "" {
+			return validators, nil
+		}
+	}
+}
+
+// 获取授权方发出的授权
+func (c *Client) getGranterGrants(granter string) ([]*AuthzGrant, error) {
+	return c.getGrants("/cosmos/authz/v1beta1/grants/granter/"+granter, "", "")
+}
+
+// 获取被授权方收到的授权
+func (c *Client) getGranteeGrants(grantee string) ([]*AuthzGrant, error) {
+	return c.getGrants("/cosmos/authz/v1beta1/grants/grantee/"+grantee, "", "")
+}
+
+// 获取授权方给被授权方的授权，旧版本节点只支持同时指定授权方和被授权方
+func (c *Client) getGrantsByPair(granter, grantee string) ([]*AuthzGrant, error) {
+	return c.getGrants("/cosmos/authz/v1beta1/grants?granter="+granter+"&grantee="+grantee, granter, grantee)
+}
+
+func (c *Client) getGrants(path, granter, grantee string) ([]*AuthzGrant, error) {
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]*AuthzGrant, 0)
+	for _, g := range resp.Get("grants").Array() {
+		grant := NewAuthzGrant(&g)
+		if grant.Granter == "" {
+			grant.Granter = granter
+		}
+		if grant.Grantee == "" {
+			grant.Grantee = grantee
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, nil
+}
+
+// 获取指定状态的治理提案，按分页查询全部结果
+func (c *Client) getProposals(status string) ([]*Proposal, error) {
+	proposals := make([]*Proposal, 0)
+	nextKey := ""
+	for {
+		path := "/cosmos/gov/v1beta1/proposals?proposal_status=" + status
+		if nextKey != "" {
+			path += "&pagination.key=" + url.QueryEscape(nextKey)
+		}
+
+		resp, err := c.Call(path, nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range resp.Get("proposals").Array() {
+			proposals = append(proposals, NewProposal(&p))
+		}
+
+		nextKey = resp.Get("pagination.next_key").String()
+		if nextKey == "" {
+			return proposals, nil
+		}
+	}
+}
+
+// 获取地址对提案的投票，未投票时返回空字符串
+func (c *Client) getProposalVote(proposalID uint64, voter string) (string, error) {
+	path := fmt.Sprintf("/cosmos/gov/v1beta1/proposals/%d/votes/%s", proposalID, voter)
+
+	resp, err := c.Call(path, nil, "GET")
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return "", nil
+		}
+		return "", err
+	}
+
+	options := make([]string, 0)
+	for _, o := range resp.Get("vote").Get("options").Array() {
+		options = append(options, o.Get("option").String()+"="+o.Get("weight").String())
+	}
+	if len(options) == 1 {
+		return resp.Get("vote").Get("options").Array()[0].Get("option").String(), nil
+	}
+	if len(options) == 0 {
+		return resp.Get("vote").Get("option").String(), nil
+	}
+
+	return strings.Join(options, ","), nil
+}
+
+// 按事件查询交易
+func (c *Client) searchTxs(events ...string) (*gjson.Result, error) {
+	query := make([]string, 0, len(events))
+	for _, e := range events {
+		query = append(query, "events="+url.QueryEscape(e))
+	}
+	path := "/cosmos/tx/v1beta1/txs?" + strings.Join(query, "&")
+
+	return c.Call(path, nil, "GET")
+}
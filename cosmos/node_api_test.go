@@ -2,6 +2,8 @@ package cosmos
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 	"time"
@@ -139,3 +141,50 @@ func Test_getBlockByHeight(t *testing.T) {
 		fmt.Println(result)
 	}
 }
+
+func Test_getProposals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("proposal_status") != "PROPOSAL_STATUS_VOTING_PERIOD" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("pagination.key") == "" {
+			fmt.Fprint(w, `{"proposals":[{"proposal_id":"81"},{"proposal_id":"82"}],"pagination":{"next_key":"AAAAAAAAAFM=","total":"3"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"proposals":[{"proposal_id":"83"}],"pagination":{"next_key":null,"total":"0"}}`)
+	}))
+	defer server.Close()
+
+	proposals, err := NewClient(server.URL, false).getProposals("PROPOSAL_STATUS_VOTING_PERIOD")
+	if err != nil {
+		t.Fatalf("get proposals failed: %v", err)
+	}
+	if len(proposals) != 3 || proposals[2].ProposalID != 83 {
+		t.Errorf("unexpected proposals: %+v", proposals)
+	}
+}
+
+func Test_getDelegatorValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cosmos/staking/v1beta1/delegations/cosmos1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u0tvx7u" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("pagination.key") == "" {
+			fmt.Fprint(w, `{"delegation_responses":[{"delegation":{"validator_address":"cosmosvaloper1a"}},{"delegation":{"validator_address":"cosmosvaloper1b"}}],"pagination":{"next_key":"FDEAAA==","total":"3"}}`)
+			return
+		}
+		if key := r.URL.Query().Get("pagination.key"); key != "FDEAAA==" {
+			t.Errorf("unexpected pagination key: %s", key)
+		}
+		fmt.Fprint(w, `{"delegation_responses":[{"delegation":{"validator_address":"cosmosvaloper1c"}}],"pagination":{"next_key":null,"total":"0"}}`)
+	}))
+	defer server.Close()
+
+	validators, err := NewClient(server.URL, false).getDelegatorValidators("cosmos1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u0tvx7u")
+	if err != nil {
+		t.Fatalf("get delegator validators failed: %v", err)
+	}
+	if len(validators) != 3 || validators[2] != "cosmosvaloper1c" {
+		t.Errorf("unexpected validators: %v", validators)
+	}
+}
@@ -0,0 +1,380 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package cosmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+// 预留序号的默认超时时间，超时未广播的序号会被回收
+const defaultPendingSequenceTimeout = 10 * time.Minute
+
+//AddressSequence 地址的序号状态
+type AddressSequence struct {
+	Address string `json:"address"`
+	// 账户编号
+	AccountNumber uint64 `json:"account_number"`
+	// 最近一次从链上获取的序号
+	Chain uint64 `json:"chain"`
+	// 已广播成功的下一个序号，广播的交易可能还在交易池中
+	Committed uint64 `json:"committed"`
+	// 已预留未广播的序号，值为预留时间
+	Pending map[uint64]int64 `json:"pending"`
+	// 最近一次从链上同步的时间
+	SyncTime int64 `json:"sync_time"`
+}
+
+//next 下一个可用的序号，从已广播的下一个序号开始，跳过已预留的序号
+func (as *AddressSequence) next() uint64 {
+	next := as.Chain
+	if as.Committed > next {
+		next = as.Committed
+	}
+	for {
+		if _, ok := as.Pending[next]; !ok {
+			return next
+		}
+		next++
+	}
+}
+
+//SubmittedTx 已广播、设置了超时高度的交易，超时未上链时可用相同的序号重建
+type SubmittedTx struct {
+	TxID          string `json:"txid"`
+	Address       string `json:"address"`
+	Sequence      uint64 `json:"sequence"`
+	TimeoutHeight uint64 `json:"timeout_height"`
+	AccountID     string `json:"account_id"`
+	// 手续费支付方及其序号，超时未上链时同样回退
+	FeePayer         string `json:"fee_payer,omitempty"`
+	FeePayerSequence uint64 `json:"fee_payer_sequence,omitempty"`
+	// 已签名的广播数据，重建时可从中解析交易内容
+	RawHex     string `json:"raw_hex"`
+	SubmitTime int64  `json:"submit_time"`
+}
+
+//SequenceManager 地址序号管理器，为创建中的交易预留序号，广播失败时释放，节点报告序号不匹配时从链上重新同步。
+//预留状态只保存在内存中，重启后按链上序号和钱包记录的已广播序号重新分配；已广播的有超时高度的交易同时保存在发送地址的扩展参数中
+type SequenceManager struct {
+	wm *WalletManager
+	//预留序号的超时时间
+	PendingTimeout time.Duration
+	mu             sync.Mutex
+	addresses      map[string]*AddressSequence
+	submitted      map[string]*SubmittedTx
+}
+
+//NewSequenceManager 创建序号管理器
+func NewSequenceManager(wm *WalletManager) *SequenceManager {
+	return &SequenceManager{
+		wm:             wm,
+		PendingTimeout: defaultPendingSequenceTimeout,
+		addresses:      make(map[string]*AddressSequence),
+		submitted:      make(map[string]*SubmittedTx),
+	}
+}
+
+//getAddressSequence 获取地址的序号状态，没有时新建
+func (sm *SequenceManager) getAddressSequence(address string) *AddressSequence {
+	as, ok := sm.addresses[address]
+	if !ok {
+		as = &AddressSequence{
+			Address: address,
+			Pending: make(map[uint64]int64),
+		}
+		sm.addresses[address] = as
+	}
+	return as
+}
+
+//Reserve 从链上获取账户编号和序号，预留下一个可用的序号，local为本地记录的已广播序号
+func (sm *SequenceManager) Reserve(address string, local uint64) (uint64, uint64, error) {
+	accountNumber, chain, err := sm.wm.RestClient.getAccountNumberAndSequence(address)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	as := sm.getAddressSequence(address)
+	as.AccountNumber = uint64(accountNumber)
+	as.Chain = uint64(chain)
+	as.SyncTime = time.Now().Unix()
+	if as.Committed < local {
+		as.Committed = local
+	}
+
+	//回收已上链和超时未广播的序号
+	now := time.Now()
+	for seq, reserved := range as.Pending {
+		if seq < as.Chain || now.Sub(time.Unix(reserved, 0)) > sm.PendingTimeout {
+			delete(as.Pending, seq)
+		}
+	}
+
+	seq := as.next()
+	as.Pending[seq] = now.Unix()
+	return as.AccountNumber, seq, nil
+}
+
+//Release 广播失败或交易单作废时释放预留的序号
+func (sm *SequenceManager) Release(address string, seq uint64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	as, ok := sm.addresses[address]
+	if !ok {
+		return
+	}
+	delete(as.Pending, seq)
+}
+
+//Commit 广播成功后确认序号
+func (sm *SequenceManager) Commit(address string, seq uint64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	as := sm.getAddressSequence(address)
+	delete(as.Pending, seq)
+	if as.Committed < seq+1 {
+		as.Committed = seq + 1
+	}
+}
+
+//Resync 节点报告序号不匹配时，丢弃本地状态，按链上的序号重新同步，返回链上的序号
+func (sm *SequenceManager) Resync(address string) (uint64, error) {
+	accountNumber, chain, err := sm.wm.RestClient.getAccountNumberAndSequence(address)
+	if err != nil {
+		return 0, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	as := sm.getAddressSequence(address)
+	as.AccountNumber = uint64(accountNumber)
+	as.Chain = uint64(chain)
+	as.Committed = uint64(chain)
+	as.Pending = make(map[uint64]int64)
+	as.SyncTime = time.Now().Unix()
+	return as.Chain, nil
+}
+
+//ReserveAt 预留节点期望的序号，用于序号不匹配时重新签名。只丢弃小于该序号的预留，不影响其他交易预留的序号，
+//该序号已被其他交易预留时返回错误
+func (sm *SequenceManager) ReserveAt(address string, sequence uint64) (uint64, error) {
+	accountNumber, _, err := sm.wm.RestClient.getAccountNumberAndSequence(address)
+	if err != nil {
+		return 0, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	as := sm.getAddressSequence(address)
+	if _, ok := as.Pending[sequence]; ok {
+		return 0, fmt.Errorf("sequence %d of address: %s is reserved by another transaction", sequence, address)
+	}
+	as.AccountNumber = uint64(accountNumber)
+	as.Chain = sequence
+	as.Committed = sequence
+	for seq := range as.Pending {
+		if seq < sequence {
+			delete(as.Pending, seq)
+		}
+	}
+	as.Pending[sequence] = time.Now().Unix()
+	return as.AccountNumber, nil
+}
+
+//Rewind 已广播的交易超时未上链，回退到该交易的序号，下次预留时重新使用。
+//其他交易已预留的序号保持不变，不会重复分配
+func (sm *SequenceManager) Rewind(address string, sequence uint64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	as := sm.getAddressSequence(address)
+	if as.Committed > sequence {
+		as.Committed = sequence
+	}
+}
+
+//submittedExtKey 地址扩展参数中保存已广播交易的键
+func (sm *SequenceManager) submittedExtKey() string {
+	return sm.wm.FullName() + "_submitted"
+}
+
+//Track 记录已广播的有超时高度的交易，并保存到发送地址的扩展参数中
+func (sm *SequenceManager) Track(wrapper openwallet.WalletDAI, tx *SubmittedTx) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.submitted[tx.TxID] = tx
+	return sm.saveSubmitted(wrapper, tx.Address)
+}
+
+//Replace 交易广播成功后，使用相同序号的其他已记录交易（超时后被重建的交易）不再记录
+func (sm *SequenceManager) Replace(wrapper openwallet.WalletDAI, address string, sequence uint64, txid string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	addresses := make([]string, 0)
+	for id, tx := range sm.submitted {
+		if id == txid {
+			continue
+		}
+		if (tx.Address == address && tx.Sequence == sequence) || (tx.FeePayer == address && tx.FeePayerSequence == sequence) {
+			delete(sm.submitted, id)
+			if !containsString(addresses, tx.Address) {
+				addresses = append(addresses, tx.Address)
+			}
+		}
+	}
+	for _, addr := range addresses {
+		if err := sm.saveSubmitted(wrapper, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Untrack 交易已上链，不再记录
+func (sm *SequenceManager) Untrack(wrapper openwallet.WalletDAI, txid string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	tx, ok := sm.submitted[txid]
+	if !ok {
+		return nil
+	}
+	delete(sm.submitted, txid)
+	return sm.saveSubmitted(wrapper, tx.Address)
+}
+
+//saveSubmitted 保存地址已广播的交易到扩展参数，调用方需持有锁
+func (sm *SequenceManager) saveSubmitted(wrapper openwallet.WalletDAI, address string) error {
+	list := make([]*SubmittedTx, 0)
+	for _, tx := range sm.submitted {
+		if tx.Address == address {
+			list = append(list, tx)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Sequence < list[j].Sequence
+	})
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return wrapper.SetAddressExtParam(address, sm.submittedExtKey(), string(data))
+}
+
+//Load 从钱包地址的扩展参数恢复已广播的交易，重启后可继续处理超时未上链的交易
+func (sm *SequenceManager) Load(wrapper openwallet.WalletDAI) error {
+	addresses, err := wrapper.GetAddressList(0, -1)
+	if err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, addr := range addresses {
+		val, err := wrapper.GetAddressExtParam(addr.Address, sm.submittedExtKey())
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			continue
+		}
+		data, ok := val.(string)
+		if !ok {
+			b, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			data = string(b)
+		}
+		list := make([]*SubmittedTx, 0)
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return fmt.Errorf("invalid submitted transactions of address: %s, %v", addr.Address, err)
+		}
+		for _, tx := range list {
+			if _, ok := sm.submitted[tx.TxID]; !ok {
+				sm.submitted[tx.TxID] = tx
+			}
+		}
+	}
+	return nil
+}
+
+//Submitted 已记录的交易，按地址和序号排序
+func (sm *SequenceManager) Submitted() []*SubmittedTx {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	list := make([]*SubmittedTx, 0, len(sm.submitted))
+	for _, tx := range sm.submitted {
+		list = append(list, tx)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Address != list[j].Address {
+			return list[i].Address < list[j].Address
+		}
+		return list[i].Sequence < list[j].Sequence
+	})
+	return list
+}
+
+//State 查询地址的序号状态，不指定地址时返回全部
+func (sm *SequenceManager) State(addresses ...string) []*AddressSequence {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	list := make([]*AddressSequence, 0)
+	for address, as := range sm.addresses {
+		if len(addresses) > 0 && !containsString(addresses, address) {
+			continue
+		}
+		state := *as
+		state.Pending = make(map[uint64]int64, len(as.Pending))
+		for seq, reserved := range as.Pending {
+			state.Pending[seq] = reserved
+		}
+		list = append(list, &state)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+//containsString 列表是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package cosmos
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testSequenceManager(chainSequence *int) (*SequenceManager, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"result":{"value":{"account_number":"173110","sequence":"%d"}}}`, *chainSequence)
+	}))
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	return wm.SequenceManager, server.Close
+}
+
+func Test_SequenceManager(t *testing.T) {
+	chainSequence := 5
+	sm, closeServer := testSequenceManager(&chainSequence)
+	defer closeServer()
+
+	address := "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+
+	//并发创建的交易预留不同的序号
+	accountNumber, seq1, err := sm.Reserve(address, 0)
+	if err != nil || accountNumber != 173110 || seq1 != 5 {
+		t.Errorf("unexpected reserve: %d %d %v", accountNumber, seq1, err)
+	}
+	_, seq2, _ := sm.Reserve(address, 0)
+	if seq2 != 6 {
+		t.Errorf("unexpected reserve: %d", seq2)
+	}
+
+	//广播失败释放最后的序号，可以再次使用
+	sm.Release(address, seq2)
+	_, seq3, _ := sm.Reserve(address, 0)
+	if seq3 != 6 {
+		t.Errorf("released sequence should be reused: %d", seq3)
+	}
+
+	//广播成功后，即使链上序号还未更新，也不会重复使用
+	sm.Commit(address, seq1)
+	sm.Commit(address, seq3)
+	_, seq4, _ := sm.Reserve(address, 0)
+	if seq4 != 7 {
+		t.Errorf("unexpected reserve after commit: %d", seq4)
+	}
+
+	//节点报告序号不匹配，按链上的序号重新同步
+	chainSequence = 6
+	chain, err := sm.Resync(address)
+	if err != nil || chain != 6 {
+		t.Errorf("unexpected resync: %d %v", chain, err)
+	}
+	state := sm.State(address)
+	if len(state) != 1 || state[0].Committed != 6 || len(state[0].Pending) != 0 {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	_, seq5, _ := sm.Reserve(address, 0)
+	if seq5 != 6 {
+		t.Errorf("unexpected reserve after resync: %d", seq5)
+	}
+}
+
+func Test_SequenceManager_ReserveAt(t *testing.T) {
+	chainSequence := 5
+	sm, closeServer := testSequenceManager(&chainSequence)
+	defer closeServer()
+
+	address := "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+
+	//序号5已广播但被交易池丢弃，之后的交易预留了6和7
+	_, seq, _ := sm.Reserve(address, 0)
+	sm.Commit(address, seq)
+	_, seqA, _ := sm.Reserve(address, 0)
+	_, seqB, _ := sm.Reserve(address, 0)
+	if seqA != 6 || seqB != 7 {
+		t.Fatalf("unexpected reserve: %d %d", seqA, seqB)
+	}
+
+	//6广播时节点期望5，释放6并按5重新签名，7的预留不受影响
+	sm.Release(address, seqA)
+	accountNumber, err := sm.ReserveAt(address, 5)
+	if err != nil || accountNumber != 173110 {
+		t.Fatalf("unexpected reserve at: %d %v", accountNumber, err)
+	}
+	state := sm.State(address)
+	if _, ok := state[0].Pending[seqB]; !ok || len(state[0].Pending) != 2 || state[0].Committed != 5 {
+		t.Errorf("unexpected state: %+v", state[0])
+	}
+	if _, seq, _ = sm.Reserve(address, 0); seq == seqB || seq == 5 {
+		t.Errorf("reserved sequence should not be handed out again: %d", seq)
+	}
+
+	//期望的序号已被其他交易预留
+	if _, err = sm.ReserveAt(address, seqB); err == nil {
+		t.Errorf("reserve at sequence of other transaction should fail")
+	}
+}
+
+func Test_SequenceManager_Rewind(t *testing.T) {
+	chainSequence := 5
+	sm, closeServer := testSequenceManager(&chainSequence)
+	defer closeServer()
+
+	address := "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+
+	//5和6已广播，7已预留还未广播
+	for i := 0; i < 2; i++ {
+		_, seq, _ := sm.Reserve(address, 0)
+		sm.Commit(address, seq)
+	}
+	_, pending, _ := sm.Reserve(address, 0)
+	if pending != 7 {
+		t.Fatalf("unexpected reserve: %d", pending)
+	}
+
+	//5超时未上链，回退后重新使用5和6，跳过已预留的7
+	sm.Rewind(address, 5)
+	expected := []uint64{5, 6, 8}
+	for _, want := range expected {
+		if _, seq, _ := sm.Reserve(address, 0); seq != want {
+			t.Errorf("unexpected reserve after rewind: %d, expected: %d", seq, want)
+		}
+	}
+}
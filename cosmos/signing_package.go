@@ -0,0 +1,307 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package cosmos
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+)
+
+//SigningPackageVersion 离线签名包的格式版本，格式变化时递增
+const SigningPackageVersion = 1
+
+/*
+SigningPackage 离线签名包
+
+签名包为JSON格式，除待签名的交易单外，还包含可读的交易内容，离线签名方核对后再签名：
+
+	{
+	  "version": 1,                       // 格式版本
+	  "chain_id": "cosmoshub-4",
+	  "account_number": 173110,
+	  "sequence": 5,
+	  "sign_mode": "direct",              // direct 或 amino_json
+	  "memo": "",
+	  "fee": {"amount": "2500", "denom": "uatom", "gas_limit": 200000, "granter": "", "payer": ""},
+	  "messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", ...}],
+	  "sign_bytes": "0a94...",            // 待签名数据，hex编码
+	  "sign_doc": {...},                  // amino_json模式下按键排序的签名文档
+	  "transaction": "7b22...",           // RawTransaction.RawHex
+	  "signatures": [{"account_id": "...", "address": "...", "public_key": "...", "hd_path": "...", "message": "...", "signature": ""}]
+	}
+
+导入时按transaction重新生成待签名数据和可读内容，与签名包逐项比对，并检查待签名数据的SHA256等于每个签名的message，
+手续费支付方的message为按其账户编号和序号生成的待签名数据的SHA256。
+*/
+type SigningPackage struct {
+	Version       int                        `json:"version"`
+	ChainID       string                     `json:"chain_id"`
+	AccountNumber uint64                     `json:"account_number"`
+	Sequence      uint64                     `json:"sequence"`
+	SignMode      string                     `json:"sign_mode"`
+	Memo          string                     `json:"memo"`
+	Fee           SigningPackageFee          `json:"fee"`
+	Messages      []json.RawMessage          `json:"messages"`
+	SignBytes     string                     `json:"sign_bytes"`
+	SignDoc       json.RawMessage            `json:"sign_doc,omitempty"`
+	Transaction   string                     `json:"transaction"`
+	Signatures    []*SigningPackageSignature `json:"signatures"`
+}
+
+//SigningPackageFee 签名包的手续费
+type SigningPackageFee struct {
+	Amount   string `json:"amount"`
+	Denom    string `json:"denom"`
+	GasLimit uint64 `json:"gas_limit"`
+	Granter  string `json:"granter,omitempty"`
+	Payer    string `json:"payer,omitempty"`
+}
+
+//SigningPackageSignature 签名包中的一个待签名
+type SigningPackageSignature struct {
+	AccountID string `json:"account_id"`
+	Address   string `json:"address"`
+	PublicKey string `json:"public_key"`
+	HDPath    string `json:"hd_path"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+//newSigningPackage 按交易单生成签名包的可读内容
+func newSigningPackage(unsignedTrans string) (*SigningPackage, error) {
+	t, err := decodeUnsignedTx(unsignedTrans)
+	if err != nil {
+		return nil, err
+	}
+
+	encCfg := newEncodingConfig()
+
+	msgs, err := t.getMsgs()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]json.RawMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		msgJSON, err := encCfg.Marshaler.MarshalInterfaceJSON(msg)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msgJSON)
+	}
+
+	signBytes, err := t.getSignBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	signMode := SignModeDirect
+	var signDoc json.RawMessage
+	if t.signMode(encCfg.TxConfig) == signing.SignMode_SIGN_MODE_LEGACY_AMINO_JSON {
+		signMode = SignModeAminoJSON
+		signDoc = signBytes
+	}
+
+	return &SigningPackage{
+		Version:       SigningPackageVersion,
+		ChainID:       t.ChainID,
+		AccountNumber: t.AccNum,
+		Sequence:      t.AccSeq,
+		SignMode:      signMode,
+		Memo:          t.Memo,
+		Fee: SigningPackageFee{
+			Amount:   fmt.Sprint(t.Fee),
+			Denom:    t.FeeDenom,
+			GasLimit: t.GasLimit,
+			Granter:  t.FeeGranter,
+			Payer:    t.FeePayer,
+		},
+		Messages:    messages,
+		SignBytes:   hex.EncodeToString(signBytes),
+		SignDoc:     signDoc,
+		Transaction: unsignedTrans,
+		Signatures:  make([]*SigningPackageSignature, 0),
+	}, nil
+}
+
+//ExportSigningPackage 导出交易单的离线签名包
+func ExportSigningPackage(rawTx *openwallet.RawTransaction) (*SigningPackage, error) {
+	pkg, err := newSigningPackage(rawTx.RawHex)
+	if err != nil {
+		return nil, err
+	}
+
+	for accountID, keySignatures := range rawTx.Signatures {
+		for _, keySignature := range keySignatures {
+			if keySignature.Address == nil {
+				continue
+			}
+			pkg.Signatures = append(pkg.Signatures, &SigningPackageSignature{
+				AccountID: accountID,
+				Address:   keySignature.Address.Address,
+				PublicKey: keySignature.Address.PublicKey,
+				HDPath:    keySignature.Address.HDPath,
+				Message:   keySignature.Message,
+				Signature: keySignature.Signature,
+			})
+		}
+	}
+
+	return pkg, nil
+}
+
+//DecodeSigningPackage 解析签名包，并校验内容与交易单一致
+func DecodeSigningPackage(data []byte) (*SigningPackage, error) {
+	pkg := &SigningPackage{}
+	err := json.Unmarshal(data, pkg)
+	if err != nil {
+		return nil, err
+	}
+	err = pkg.Check()
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+//Encode 签名包编码为JSON
+func (pkg *SigningPackage) Encode() ([]byte, error) {
+	return json.MarshalIndent(pkg, "", "  ")
+}
+
+//Check 按交易单重新生成待签名数据和可读内容，与签名包比对，并检查每个签名的message
+func (pkg *SigningPackage) Check() error {
+	if pkg.Version != SigningPackageVersion {
+		return fmt.Errorf("unsupported signing package version: %d", pkg.Version)
+	}
+
+	rebuilt, err := newSigningPackage(pkg.Transaction)
+	if err != nil {
+		return fmt.Errorf("signing package transaction decode failed, unexpected error: %v", err)
+	}
+
+	if rebuilt.ChainID != pkg.ChainID || rebuilt.AccountNumber != pkg.AccountNumber || rebuilt.Sequence != pkg.Sequence {
+		return fmt.Errorf("signing package chain id, account number or sequence does not match the transaction")
+	}
+	if rebuilt.SignMode != pkg.SignMode {
+		return fmt.Errorf("signing package sign mode does not match the transaction")
+	}
+	if rebuilt.Memo != pkg.Memo {
+		return fmt.Errorf("signing package memo does not match the transaction")
+	}
+	if rebuilt.Fee != pkg.Fee {
+		return fmt.Errorf("signing package fee does not match the transaction")
+	}
+	if len(rebuilt.Messages) != len(pkg.Messages) {
+		return fmt.Errorf("signing package messages do not match the transaction")
+	}
+	for i := range rebuilt.Messages {
+		if !jsonEqual(rebuilt.Messages[i], pkg.Messages[i]) {
+			return fmt.Errorf("signing package message %d does not match the transaction", i)
+		}
+	}
+	if rebuilt.SignBytes != pkg.SignBytes {
+		return fmt.Errorf("signing package sign bytes do not match the transaction")
+	}
+	if len(pkg.SignDoc) > 0 && !jsonEqual(rebuilt.SignDoc, pkg.SignDoc) {
+		return fmt.Errorf("signing package sign doc does not match the transaction")
+	}
+
+	signBytes, _ := hex.DecodeString(rebuilt.SignBytes)
+	hash := hex.EncodeToString(owcrypt.Hash(signBytes, 0, owcrypt.HASH_ALG_SHA256))
+	t, _ := decodeUnsignedTx(pkg.Transaction)
+	for _, sig := range pkg.Signatures {
+		expected := hash
+		if t.hasFeePayer() && sig.Address == t.FeePayer {
+			expected, err = t.getFeePayerHash()
+			if err != nil {
+				return err
+			}
+		}
+		if sig.Message != expected {
+			return fmt.Errorf("sign message of address: %s does not match the sign bytes", sig.Address)
+		}
+	}
+	return nil
+}
+
+//Sign 离线签名，校验签名包后，用私钥签名公钥匹配的待签名，返回签名的数量
+func (pkg *SigningPackage) Sign(prikey []byte) (int, error) {
+	err := pkg.Check()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(prikey) != 32 {
+		return 0, fmt.Errorf("invalid private key")
+	}
+	publicKey := hex.EncodeToString((&secp256k1.PrivKey{Key: prikey}).PubKey().Bytes())
+
+	count := 0
+	for _, sig := range pkg.Signatures {
+		if sig.PublicKey != publicKey {
+			continue
+		}
+		signature, err := signTransactionHash(sig.Message, prikey)
+		if err != nil {
+			return count, err
+		}
+		sig.Signature = signature
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no signature matches the public key: %s", publicKey)
+	}
+	return count, nil
+}
+
+//ImportSigningPackage 导入离线签名包的签名到交易单，签名包必须来自该交易单
+func ImportSigningPackage(rawTx *openwallet.RawTransaction, pkg *SigningPackage) error {
+	if pkg.Transaction != rawTx.RawHex {
+		return fmt.Errorf("signing package does not belong to the transaction")
+	}
+	err := pkg.Check()
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range pkg.Signatures {
+		if len(sig.Signature) == 0 {
+			continue
+		}
+		for _, keySignature := range rawTx.Signatures[sig.AccountID] {
+			if keySignature.Address != nil && keySignature.Address.PublicKey == sig.PublicKey && keySignature.Message == sig.Message {
+				keySignature.Signature = sig.Signature
+			}
+		}
+	}
+	return nil
+}
+
+//jsonEqual 比较两个JSON的内容是否相同，忽略格式和转义的差异
+func jsonEqual(a, b json.RawMessage) bool {
+	var objA, objB interface{}
+	if json.Unmarshal(a, &objA) != nil || json.Unmarshal(b, &objB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(objA, objB)
+}
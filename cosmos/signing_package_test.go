@@ -0,0 +1,103 @@
+package cosmos
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_SigningPackage(t *testing.T) {
+	prikey := "1234567812345678123456781234567812345678123456781234567812345678"
+	key, _ := hex.DecodeString(prikey)
+
+	for _, signMode := range []string{SignModeDirect, SignModeAminoJSON} {
+		rawTx, keySignature := testSignedRawTransaction(t, prikey)
+		keySignature.Signature = ""
+		if signMode == SignModeAminoJSON {
+			//重新按amino_json模式生成交易单
+			cosmosTx, _ := decodeUnsignedTx(rawTx.RawHex)
+			cosmosTx.SignMode = signMode
+			rawTx.RawHex, keySignature.Message, _ = cosmosTx.getUnsignedTxAndHash()
+		}
+
+		pkg, err := ExportSigningPackage(rawTx)
+		if err != nil {
+			t.Errorf("export signing package failed: %v", err)
+			return
+		}
+		data, err := pkg.Encode()
+		if err != nil {
+			t.Errorf("encode signing package failed: %v", err)
+			return
+		}
+		if !strings.Contains(string(data), "/cosmos.bank.v1beta1.MsgSend") {
+			t.Errorf("signing package should contain readable messages: %s", data)
+		}
+
+		//离线签名方导入并签名
+		offline, err := DecodeSigningPackage(data)
+		if err != nil {
+			t.Errorf("decode signing package failed: %v", err)
+			return
+		}
+		count, err := offline.Sign(key)
+		if err != nil || count != 1 {
+			t.Errorf("sign signing package failed: %v", err)
+			return
+		}
+		data, _ = offline.Encode()
+
+		signed, err := DecodeSigningPackage(data)
+		if err != nil {
+			t.Errorf("decode signed package failed: %v", err)
+			return
+		}
+		err = ImportSigningPackage(rawTx, signed)
+		if err != nil {
+			t.Errorf("import signing package failed: %v", err)
+			return
+		}
+
+		decoder := &TransactionDecoder{}
+		err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+		if err != nil || !rawTx.IsCompleted {
+			t.Errorf("verify failed: %v", err)
+		}
+	}
+}
+
+func Test_SigningPackage_tampered(t *testing.T) {
+	prikey := "1234567812345678123456781234567812345678123456781234567812345678"
+	key, _ := hex.DecodeString(prikey)
+
+	rawTx, _ := testSignedRawTransaction(t, prikey)
+	pkg, _ := ExportSigningPackage(rawTx)
+
+	//可读内容被修改
+	pkg.Memo = "changed"
+	if _, err := pkg.Sign(key); err == nil {
+		t.Errorf("sign should fail with tampered memo")
+	}
+
+	//交易单被替换，待签名数据与message不一致
+	pkg, _ = ExportSigningPackage(rawTx)
+	cosmosTx, _ := decodeUnsignedTx(rawTx.RawHex)
+	cosmosTx.Amount = big.NewInt(1)
+	other, err := newSigningPackage(mustUnsignedTx(t, cosmosTx))
+	if err != nil {
+		t.Fatalf("create signing package failed: %v", err)
+	}
+	other.Signatures = pkg.Signatures
+	if _, err := other.Sign(key); err == nil {
+		t.Errorf("sign should fail with mismatched message")
+	}
+}
+
+func mustUnsignedTx(t *testing.T, cosmosTx *CosmosTx) string {
+	unsignedTrans, _, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	return unsignedTrans
+}
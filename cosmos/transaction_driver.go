@@ -5,16 +5,79 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocktree/go-owcdrivers/addressEncoder"
 	"github.com/blocktree/go-owcrypt"
+	"github.com/cosmos/cosmos-sdk/client"
+	kmultisig "github.com/cosmos/cosmos-sdk/crypto/keys/multisig"
 	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
 	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
-	"github.com/cosmos/cosmos-sdk/types/tx/signing"
-	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/cosmos/cosmos-sdk/crypto/types/multisig"
 	"github.com/cosmos/cosmos-sdk/simapp"
+	simappparams "github.com/cosmos/cosmos-sdk/simapp/params"
 	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
 	xauthsigning "github.com/cosmos/cosmos-sdk/x/auth/signing"
+	"github.com/cosmos/cosmos-sdk/x/authz"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	"github.com/cosmos/cosmos-sdk/x/feegrant"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	ibccoretypes "github.com/cosmos/ibc-go/v2/modules/core/types"
+)
+
+// 交易单动作，通过RawTransaction的扩展参数action指定
+const (
+	TxActionSend        = "send"
+	TxActionDelegate    = "delegate"
+	TxActionUndelegate  = "undelegate"
+	TxActionRedelegate  = "redelegate"
+	TxActionWithdraw    = "withdraw_rewards"
+	TxActionVote        = "vote"
+	TxActionIBC         = "ibc_transfer"
+	TxActionGrantFee    = "grant_allowance"
+	TxActionRevokeFee   = "revoke_allowance"
+	TxActionGrantAuthz  = "grant_authorization"
+	TxActionRevokeAuthz = "revoke_authorization"
+)
+
+// 授权类型，通过RawTransaction的扩展参数authorization指定
+const (
+	AuthzTypeSend    = "send"    //SendAuthorization，限定转账额度
+	AuthzTypeGeneric = "generic" //GenericAuthorization，不限额度地执行指定类型的消息
 )
 
+// 转账消息的类型，SendAuthorization授权的消息类型
+const MsgSendTypeURL = "/cosmos.bank.v1beta1.MsgSend"
+
+// 广播模式，通过RawTransaction的扩展参数broadcast_mode或配置broadcastMode指定
+const (
+	BroadcastModeSync    = "sync"    //节点CheckTx通过后返回
+	BroadcastModeAsync   = "async"   //节点收到交易后立即返回
+	BroadcastModeConfirm = "confirm" //CheckTx通过后，等待交易上链并返回执行结果
+)
+
+//isValidBroadcastMode 是否支持的广播模式，空为默认的sync
+func isValidBroadcastMode(mode string) bool {
+	return mode == "" || mode == BroadcastModeSync || mode == BroadcastModeAsync || mode == BroadcastModeConfirm
+}
+
+// 签名模式，通过RawTransaction的扩展参数sign_mode或配置signMode指定
+const (
+	SignModeDirect    = "direct"
+	SignModeAminoJSON = "amino_json"
+)
+
+// IBC转账默认的超时时间
+const defaultIBCTimeout = 10 * time.Minute
+
 func NewPublicKey(key []byte) cryptotypes.PubKey {
 	return &secp256k1.PubKey{Key: key}
 }
@@ -23,41 +86,466 @@ func NewPublicKey(key []byte) cryptotypes.PubKey {
 //	return &secp256k1.PrivKey{Key: key}
 //}
 
+//CosmosOutput 批量转账的一个输出
+type CosmosOutput struct {
+	To     string   `json:"to"`
+	Amount *big.Int `json:"amount"`
+}
+
 type CosmosTx struct {
-	From string `json:"from"`
-	To string `json:"to"`
-	Denom string `json:"denom"`
-	FeeDenom string `json:"fee_denom"`
-	Memo string `json:"memo"`
-	ChainID string `json:"chain_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Denom     string `json:"denom"`
+	FeeDenom  string `json:"fee_denom"`
+	Memo      string `json:"memo"`
+	ChainID   string `json:"chain_id"`
 	PublicKey string `json:"public_key"`
-	Amount int64 `json:"amount"`
-	Fee int64 `json:"fee"`
-	AccNum uint64 `json:"acc_num"`
-	AccSeq uint64 `json:"acc_seq"`
-	GasLimit uint64 `json:"gas_limit"`
-	Timeout uint64 `json:"timeout"`
+	// 最小单位的数量，18位精度的denom可能超过int64
+	Amount   *big.Int `json:"amount"`
+	Fee      int64    `json:"fee"`
+	AccNum   uint64   `json:"acc_num"`
+	AccSeq   uint64   `json:"acc_seq"`
+	GasLimit uint64   `json:"gas_limit"`
+	Timeout  uint64   `json:"timeout"`
+	// 交易动作，为空时等同于send
+	Action string `json:"action,omitempty"`
+	// 质押的验证人地址（cosmosvaloper...）
+	Validator string `json:"validator,omitempty"`
+	// 转质押的目标验证人地址
+	DstValidator string `json:"dst_validator,omitempty"`
+	// 领取质押收益的验证人地址列表
+	Validators []string `json:"validators,omitempty"`
+	// 领取佣金的验证人地址
+	CommissionValidator string `json:"commission_validator,omitempty"`
+	// 投票的提案编号
+	ProposalID uint64 `json:"proposal_id,omitempty"`
+	// 投票选项，加权投票格式为 yes=0.6,no=0.4
+	VoteOption string `json:"vote_option,omitempty"`
+	// IBC转账的源端口和通道，接收地址使用To
+	SourcePort    string `json:"source_port,omitempty"`
+	SourceChannel string `json:"source_channel,omitempty"`
+	// IBC转账超时高度，格式为 {revision}-{height}
+	TimeoutHeight string `json:"timeout_height,omitempty"`
+	// IBC转账超时时间戳，单位纳秒
+	TimeoutTimestamp uint64 `json:"timeout_timestamp,omitempty"`
+	// 批量转账的输出，不为空时忽略To和Amount
+	Outputs []CosmosOutput `json:"outputs,omitempty"`
+	// 批量转账使用一条MsgMultiSend，否则每个输出一条MsgSend
+	MultiSend bool `json:"multi_send,omitempty"`
+	// 多签地址的成员公钥，不为空时From为多签地址，忽略PublicKey
+	MultisigPubKeys []string `json:"multisig_pub_keys,omitempty"`
+	// 多签地址的必要签名数
+	Threshold uint32 `json:"threshold,omitempty"`
+	// 签名模式，为空时等同于direct，多签交易固定使用amino_json
+	SignMode string `json:"sign_mode,omitempty"`
+	// 手续费授权方地址，手续费按x/feegrant的授权额度从授权方扣除
+	FeeGranter string `json:"fee_granter,omitempty"`
+	// 手续费支付方地址，不为空时支付方作为第二个签名方
+	FeePayer string `json:"fee_payer,omitempty"`
+	// 手续费支付方的公钥、账户编号和序号
+	FeePayerPublicKey string `json:"fee_payer_public_key,omitempty"`
+	FeePayerAccNum    uint64 `json:"fee_payer_acc_num,omitempty"`
+	FeePayerAccSeq    uint64 `json:"fee_payer_acc_seq,omitempty"`
+	// 手续费授权的过期时间，unix时间戳，0为不过期，授权额度使用Amount，0为不限额度
+	AllowanceExpiration int64 `json:"allowance_expiration,omitempty"`
+	// 周期授权的周期秒数，0为基础授权
+	AllowancePeriod int64 `json:"allowance_period,omitempty"`
+	// 周期授权每个周期的额度
+	AllowancePeriodLimit int64 `json:"allowance_period_limit,omitempty"`
+	// 周期授权的首次重置时间，unix时间戳
+	AllowancePeriodReset int64 `json:"allowance_period_reset,omitempty"`
+	// 授权的类型，send或generic，授权对象为To，send授权的额度使用Amount
+	AuthzType string `json:"authz_type,omitempty"`
+	// generic授权和撤销授权的消息类型
+	AuthzMsgTypeURL string `json:"authz_msg_type_url,omitempty"`
+	// 授权的过期时间，unix时间戳
+	AuthzExpiration int64 `json:"authz_expiration,omitempty"`
+	// 授权方地址，不为空时消息以授权方为发送方构建，包装为MsgExec由From作为被授权方签名
+	AuthzGranter string `json:"authz_granter,omitempty"`
 }
 
+//isMultisig 是否多签地址发起的交易
+func (t CosmosTx) isMultisig() bool {
+	return len(t.MultisigPubKeys) > 0
+}
 
-func (t CosmosTx) getUnsignedTxAndHash() (string, string, error) {
+//getMultisigMembers 多签成员的公钥，顺序与生成地址时一致
+func (t CosmosTx) getMultisigMembers() ([]cryptotypes.PubKey, error) {
+	members := make([]cryptotypes.PubKey, 0, len(t.MultisigPubKeys))
+	for _, pub := range t.MultisigPubKeys {
+		key, err := hex.DecodeString(pub)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, NewPublicKey(key))
+	}
+	return members, nil
+}
+
+//getPubKey 交易发起地址的公钥，多签地址为LegacyAminoPubKey
+func (t CosmosTx) getPubKey() (cryptotypes.PubKey, error) {
+	if t.isMultisig() {
+		members, err := t.getMultisigMembers()
+		if err != nil {
+			return nil, err
+		}
+		if t.Threshold == 0 || int(t.Threshold) > len(members) {
+			return nil, fmt.Errorf("invalid multisig threshold: %d of %d", t.Threshold, len(members))
+		}
+		return kmultisig.NewLegacyAminoPubKey(int(t.Threshold), members), nil
+	}
+	publicKey, err := hex.DecodeString(t.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublicKey(publicKey), nil
+}
+
+//signMode 签名模式，多签的签名信息依赖签名成员，成员使用LEGACY_AMINO_JSON签名
+func (t CosmosTx) signMode(txConfig client.TxConfig) signing.SignMode {
+	if t.isMultisig() || t.SignMode == SignModeAminoJSON {
+		return signing.SignMode_SIGN_MODE_LEGACY_AMINO_JSON
+	}
+	return txConfig.SignModeHandler().DefaultMode()
+}
+
+//hasFeePayer 是否由发送地址以外的地址支付手续费
+func (t CosmosTx) hasFeePayer() bool {
+	return len(t.FeePayer) > 0 && t.FeePayer != t.From
+}
+
+//checkSignMode 手续费授权、支付方、授权和MsgExec消息在amino_json模式下不被签名或无法编码，只支持direct模式
+func (t CosmosTx) checkSignMode(txConfig client.TxConfig) error {
+	if t.signMode(txConfig) != signing.SignMode_SIGN_MODE_LEGACY_AMINO_JSON {
+		return nil
+	}
+	if len(t.FeeGranter) > 0 || t.hasFeePayer() {
+		return errors.New("fee granter and fee payer are only supported in direct sign mode")
+	}
+	if t.Action == TxActionGrantFee || t.Action == TxActionRevokeFee || t.Action == TxActionGrantAuthz || t.Action == TxActionRevokeAuthz {
+		return fmt.Errorf("action: %s is only supported in direct sign mode", t.Action)
+	}
+	if len(t.AuthzGranter) > 0 {
+		return errors.New("authz exec is only supported in direct sign mode")
+	}
+	return nil
+}
+
+//isValidSignMode 是否支持的签名模式
+func isValidSignMode(mode string) bool {
+	return mode == "" || mode == SignModeDirect || mode == SignModeAminoJSON
+}
+
+//GetAminoSignDoc 获取amino_json签名模式下按键排序的签名文档，离线签名方可核对后再签名
+func GetAminoSignDoc(unsignedTrans string) (string, error) {
+	t, err := decodeUnsignedTx(unsignedTrans)
+	if err != nil {
+		return "", err
+	}
+	if t.signMode(newEncodingConfig().TxConfig) != signing.SignMode_SIGN_MODE_LEGACY_AMINO_JSON {
+		return "", errors.New("transaction is not signed in amino_json mode")
+	}
+	signBytes, err := t.getSignBytes()
+	if err != nil {
+		return "", err
+	}
+	return string(signBytes), nil
+}
+
+//newEncodingConfig 交易编码配置，在simapp的基础上注册IBC消息
+func newEncodingConfig() simappparams.EncodingConfig {
 	encCfg := simapp.MakeTestEncodingConfig()
-	txBuilder := encCfg.TxConfig.NewTxBuilder()
+	ibctransfertypes.RegisterInterfaces(encCfg.InterfaceRegistry)
+	ibctransfertypes.RegisterLegacyAminoCodec(encCfg.Amino)
+	ibccoretypes.RegisterInterfaces(encCfg.InterfaceRegistry)
+	return encCfg
+}
 
+//getMsgs 根据交易动作构建交易消息
+func (t CosmosTx) getMsgs() ([]types.Msg, error) {
 	from, err := types.AccAddressFromBech32(t.From)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	if len(t.AuthzGranter) > 0 {
+		return t.getExecMsgs(from)
+	}
+
+	amount := types.NewCoin(t.Denom, intAmount(t.Amount))
+
+	switch t.Action {
+	case "", TxActionSend:
+		if len(t.Outputs) > 0 {
+			return t.getBatchSendMsgs(from)
+		}
+		to, err := types.AccAddressFromBech32(t.To)
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{banktypes.NewMsgSend(from, to, types.NewCoins(amount))}, nil
+	case TxActionDelegate:
+		validator, err := types.ValAddressFromBech32(t.Validator)
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{stakingtypes.NewMsgDelegate(from, validator, amount)}, nil
+	case TxActionUndelegate:
+		validator, err := types.ValAddressFromBech32(t.Validator)
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{stakingtypes.NewMsgUndelegate(from, validator, amount)}, nil
+	case TxActionRedelegate:
+		srcValidator, err := types.ValAddressFromBech32(t.Validator)
+		if err != nil {
+			return nil, err
+		}
+		dstValidator, err := types.ValAddressFromBech32(t.DstValidator)
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{stakingtypes.NewMsgBeginRedelegate(from, srcValidator, dstValidator, amount)}, nil
+	case TxActionWithdraw:
+		msgs := make([]types.Msg, 0, len(t.Validators)+1)
+		for _, v := range t.Validators {
+			validator, err := types.ValAddressFromBech32(v)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, distrtypes.NewMsgWithdrawDelegatorReward(from, validator))
+		}
+		if t.CommissionValidator != "" {
+			validator, err := getCommissionValidator(t.From, t.CommissionValidator)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, distrtypes.NewMsgWithdrawValidatorCommission(validator))
+		}
+		if len(msgs) == 0 {
+			return nil, errors.New("no rewards to withdraw")
+		}
+		return msgs, nil
+	case TxActionVote:
+		if strings.Contains(t.VoteOption, "=") {
+			options, err := govtypes.WeightedVoteOptionsFromString(normalizeVoteOption(t.VoteOption))
+			if err != nil {
+				return nil, err
+			}
+			return []types.Msg{govtypes.NewMsgVoteWeighted(from, t.ProposalID, options)}, nil
+		}
+		option, err := govtypes.VoteOptionFromString(normalizeVoteOption(t.VoteOption))
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{govtypes.NewMsgVote(from, t.ProposalID, option)}, nil
+	case TxActionIBC:
+		timeoutHeight := clienttypes.ZeroHeight()
+		if t.TimeoutHeight != "" {
+			timeoutHeight, err = clienttypes.ParseHeight(t.TimeoutHeight)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if timeoutHeight.IsZero() && t.TimeoutTimestamp == 0 {
+			return nil, errors.New("ibc transfer timeout is not set")
+		}
+		return []types.Msg{ibctransfertypes.NewMsgTransfer(t.SourcePort, t.SourceChannel, amount, t.From, t.To, timeoutHeight, t.TimeoutTimestamp)}, nil
+	case TxActionGrantFee:
+		grantee, err := types.AccAddressFromBech32(t.To)
+		if err != nil {
+			return nil, err
+		}
+		allowance, err := t.getFeeAllowance()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := feegrant.NewMsgGrantAllowance(allowance, from, grantee)
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{msg}, nil
+	case TxActionRevokeFee:
+		grantee, err := types.AccAddressFromBech32(t.To)
+		if err != nil {
+			return nil, err
+		}
+		msg := feegrant.NewMsgRevokeAllowance(from, grantee)
+		return []types.Msg{&msg}, nil
+	case TxActionGrantAuthz:
+		grantee, err := types.AccAddressFromBech32(t.To)
+		if err != nil {
+			return nil, err
+		}
+		authorization, err := t.getAuthorization()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := authz.NewMsgGrant(from, grantee, authorization, time.Unix(t.AuthzExpiration, 0).UTC())
+		if err != nil {
+			return nil, err
+		}
+		return []types.Msg{msg}, nil
+	case TxActionRevokeAuthz:
+		grantee, err := types.AccAddressFromBech32(t.To)
+		if err != nil {
+			return nil, err
+		}
+		if t.AuthzMsgTypeURL == "" {
+			return nil, errors.New("authorization msg type url is empty")
+		}
+		msg := authz.NewMsgRevoke(from, grantee, t.AuthzMsgTypeURL)
+		return []types.Msg{&msg}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported transaction action: %s", t.Action)
+}
+
+//intAmount 最小单位的数量转为sdk.Int，未设置时为0
+func intAmount(amount *big.Int) types.Int {
+	if amount == nil {
+		return types.ZeroInt()
+	}
+	return types.NewIntFromBigInt(amount)
+}
+
+//getFeeAllowance 构建手续费授权额度，设置了周期时为周期授权，否则为基础授权
+func (t CosmosTx) getFeeAllowance() (feegrant.FeeAllowanceI, error) {
+	basic := feegrant.BasicAllowance{}
+	if intAmount(t.Amount).IsPositive() {
+		basic.SpendLimit = types.NewCoins(types.NewCoin(t.Denom, intAmount(t.Amount)))
+	}
+	if t.AllowanceExpiration > 0 {
+		expiration := time.Unix(t.AllowanceExpiration, 0).UTC()
+		basic.Expiration = &expiration
+	}
+	if t.AllowancePeriod == 0 {
+		return &basic, basic.ValidateBasic()
+	}
+
+	//与命令行的校验一致，周期额度不能超过总额度，周期不能在过期后重置
+	if intAmount(t.Amount).IsPositive() && intAmount(t.Amount).LT(types.NewInt(t.AllowancePeriodLimit)) {
+		return nil, errors.New("period spend limit should be less than spend limit")
 	}
-	to, err := types.AccAddressFromBech32(t.To)
+	if t.AllowanceExpiration > 0 && t.AllowancePeriodReset > t.AllowanceExpiration {
+		return nil, errors.New("period cannot reset after expiration")
+	}
+
+	periodLimit := types.NewCoins(types.NewInt64Coin(t.Denom, t.AllowancePeriodLimit))
+	periodic := &feegrant.PeriodicAllowance{
+		Basic:            basic,
+		Period:           time.Duration(t.AllowancePeriod) * time.Second,
+		PeriodReset:      time.Unix(t.AllowancePeriodReset, 0).UTC(),
+		PeriodSpendLimit: periodLimit,
+		PeriodCanSpend:   periodLimit,
+	}
+	return periodic, periodic.ValidateBasic()
+}
+
+//getAuthorization 构建授权，send授权限定Amount的转账额度，generic授权不限额度
+func (t CosmosTx) getAuthorization() (authz.Authorization, error) {
+	if t.AuthzExpiration <= time.Now().Unix() {
+		return nil, errors.New("authorization expiration should be in the future")
+	}
+	var authorization authz.Authorization
+	switch t.AuthzType {
+	case "", AuthzTypeSend:
+		authorization = banktypes.NewSendAuthorization(types.NewCoins(types.NewCoin(t.Denom, intAmount(t.Amount))))
+	case AuthzTypeGeneric:
+		if t.AuthzMsgTypeURL == "" {
+			return nil, errors.New("authorization msg type url is empty")
+		}
+		authorization = authz.NewGenericAuthorization(t.AuthzMsgTypeURL)
+	default:
+		return nil, fmt.Errorf("unsupported authorization type: %s", t.AuthzType)
+	}
+	return authorization, authorization.ValidateBasic()
+}
+
+//getExecMsgs 以授权方为发送方构建消息，包装为被授权方执行的MsgExec
+func (t CosmosTx) getExecMsgs(grantee types.AccAddress) ([]types.Msg, error) {
+	inner := t
+	inner.From = t.AuthzGranter
+	inner.AuthzGranter = ""
+	msgs, err := inner.getMsgs()
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
+	msg := authz.NewMsgExec(grantee, msgs)
+	return []types.Msg{&msg}, nil
+}
 
-	msg := banktypes.NewMsgSend(from, to, types.NewCoins(types.NewInt64Coin(t.Denom, t.Amount)))
+//getCommissionValidator 解析领取佣金的验证人，验证人必须由委托人地址运营
+func getCommissionValidator(delegator, commissionValidator string) (types.ValAddress, error) {
+	owner, err := types.AccAddressFromBech32(delegator)
+	if err != nil {
+		return nil, err
+	}
+	validator, err := types.ValAddressFromBech32(commissionValidator)
+	if err != nil {
+		return nil, err
+	}
+	if !validator.Equals(types.ValAddress(owner)) {
+		return nil, fmt.Errorf("commission validator %s is not operated by %s, expected %s",
+			commissionValidator, delegator, types.ValAddress(owner).String())
+	}
+	return validator, nil
+}
 
-	err = txBuilder.SetMsgs(msg)
+//getBatchSendMsgs 构建批量转账消息
+func (t CosmosTx) getBatchSendMsgs(from types.AccAddress) ([]types.Msg, error) {
+	msgs := make([]types.Msg, 0, len(t.Outputs))
+	outputs := make([]banktypes.Output, 0, len(t.Outputs))
+	total := types.NewInt(0)
+	for _, o := range t.Outputs {
+		to, err := types.AccAddressFromBech32(o.To)
+		if err != nil {
+			return nil, err
+		}
+		coins := types.NewCoins(types.NewCoin(t.Denom, intAmount(o.Amount)))
+		msgs = append(msgs, banktypes.NewMsgSend(from, to, coins))
+		outputs = append(outputs, banktypes.NewOutput(to, coins))
+		total = total.Add(intAmount(o.Amount))
+	}
+
+	if t.MultiSend {
+		inputs := []banktypes.Input{banktypes.NewInput(from, types.NewCoins(types.NewCoin(t.Denom, total)))}
+		return []types.Msg{banktypes.NewMsgMultiSend(inputs, outputs)}, nil
+	}
+
+	return msgs, nil
+}
+
+//normalizeVoteOption 将yes、no、abstain、no_with_veto转换为链上的投票选项名称
+func normalizeVoteOption(option string) string {
+	options := strings.Split(option, ",")
+	for i, o := range options {
+		fields := strings.SplitN(strings.TrimSpace(o), "=", 2)
+		name := strings.ToUpper(fields[0])
+		switch name {
+		case "YES", "NO", "ABSTAIN", "NO_WITH_VETO":
+			name = "VOTE_OPTION_" + name
+		case "NOWITHVETO", "VETO":
+			name = "VOTE_OPTION_NO_WITH_VETO"
+		}
+		fields[0] = name
+		options[i] = strings.Join(fields, "=")
+	}
+	return strings.Join(options, ",")
+}
+
+//buildTx 构建交易，sigData依次为发送地址和手续费支付方的签名，为空时生成待签名的交易
+func (t CosmosTx) buildTx(txConfig client.TxConfig, sigData ...signing.SignatureData) (client.TxBuilder, error) {
+	txBuilder := txConfig.NewTxBuilder()
+
+	msgs, err := t.getMsgs()
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	err = txBuilder.SetMsgs(msgs...)
+	if err != nil {
+		return nil, err
 	}
 
 	txBuilder.SetGasLimit(t.GasLimit)
@@ -65,34 +553,87 @@ func (t CosmosTx) getUnsignedTxAndHash() (string, string, error) {
 	txBuilder.SetMemo(t.Memo)
 	txBuilder.SetTimeoutHeight(t.Timeout)
 
-	var sigsV2 []signing.SignatureV2
-	publicKey, err := hex.DecodeString(t.PublicKey)
+	err = t.checkSignMode(txConfig)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	if len(t.FeeGranter) > 0 {
+		granter, err := types.AccAddressFromBech32(t.FeeGranter)
+		if err != nil {
+			return nil, err
+		}
+		txBuilder.SetFeeGranter(granter)
 	}
 
-	sigV2 := signing.SignatureV2{
-		PubKey:   NewPublicKey(publicKey),
-		Data:     &signing.SingleSignatureData{
-			SignMode:  encCfg.TxConfig.SignModeHandler().DefaultMode(),
-			Signature: nil,
-		},
-		Sequence: t.AccSeq,
+	pubKey, err := t.getPubKey()
+	if err != nil {
+		return nil, err
 	}
 
-	sigsV2 = append(sigsV2, sigV2)
+	var fromSigData signing.SignatureData
+	if len(sigData) > 0 {
+		fromSigData = sigData[0]
+	}
+	if fromSigData == nil {
+		if t.isMultisig() {
+			fromSigData = multisig.NewMultisig(len(t.MultisigPubKeys))
+		} else {
+			fromSigData = &signing.SingleSignatureData{
+				SignMode:  t.signMode(txConfig),
+				Signature: nil,
+			}
+		}
+	}
 
-	err = txBuilder.SetSignatures(sigsV2...)
-	if err != nil {
-		return "", "", err
+	sigs := []signing.SignatureV2{{
+		PubKey:   pubKey,
+		Data:     fromSigData,
+		Sequence: t.AccSeq,
+	}}
+
+	//手续费支付方作为第二个签名方
+	if t.hasFeePayer() {
+		payer, err := types.AccAddressFromBech32(t.FeePayer)
+		if err != nil {
+			return nil, err
+		}
+		feePayerBuilder, ok := txBuilder.(interface{ SetFeePayer(types.AccAddress) })
+		if !ok {
+			return nil, errors.New("tx builder does not support fee payer")
+		}
+		feePayerBuilder.SetFeePayer(payer)
+
+		payerPub, err := hex.DecodeString(t.FeePayerPublicKey)
+		if err != nil || len(payerPub) != 33 {
+			return nil, fmt.Errorf("invalid public key of fee payer: %s", t.FeePayerPublicKey)
+		}
+		var payerSigData signing.SignatureData
+		if len(sigData) > 1 {
+			payerSigData = sigData[1]
+		}
+		if payerSigData == nil {
+			payerSigData = &signing.SingleSignatureData{
+				SignMode:  t.signMode(txConfig),
+				Signature: nil,
+			}
+		}
+		sigs = append(sigs, signing.SignatureV2{
+			PubKey:   NewPublicKey(payerPub),
+			Data:     payerSigData,
+			Sequence: t.FeePayerAccSeq,
+		})
 	}
 
-	signerData := xauthsigning.SignerData{
-		ChainID:       t.ChainID,
-		AccountNumber: t.AccNum,
-		Sequence:      t.AccSeq,
+	err = txBuilder.SetSignatures(sigs...)
+	if err != nil {
+		return nil, err
 	}
-	sigbytes, err := encCfg.TxConfig.SignModeHandler().GetSignBytes(encCfg.TxConfig.SignModeHandler().DefaultMode(), signerData, txBuilder.GetTx())
+
+	return txBuilder, nil
+}
+
+func (t CosmosTx) getUnsignedTxAndHash() (string, string, error) {
+	sigbytes, err := t.getSignBytes()
 	if err != nil {
 		return "", "", err
 	}
@@ -103,10 +644,148 @@ func (t CosmosTx) getUnsignedTxAndHash() (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
-	
+
 	return hex.EncodeToString(txBytes), hex.EncodeToString(sigHash), nil
 }
 
+//getSignBytes 生成待签名的数据
+func (t CosmosTx) getSignBytes() ([]byte, error) {
+	return t.getSignerSignBytes(t.AccNum, t.AccSeq)
+}
+
+//getFeePayerSignBytes 生成手续费支付方的待签名数据
+func (t CosmosTx) getFeePayerSignBytes() ([]byte, error) {
+	return t.getSignerSignBytes(t.FeePayerAccNum, t.FeePayerAccSeq)
+}
+
+//getFeePayerHash 手续费支付方的待签名哈希
+func (t CosmosTx) getFeePayerHash() (string, error) {
+	signBytes, err := t.getFeePayerSignBytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(owcrypt.Hash(signBytes, 0, owcrypt.HASH_ALG_SHA256)), nil
+}
+
+//getSignerSignBytes 按签名方的账户编号和序号生成待签名的数据
+func (t CosmosTx) getSignerSignBytes(accountNumber, sequence uint64) ([]byte, error) {
+	encCfg := newEncodingConfig()
+
+	txBuilder, err := t.buildTx(encCfg.TxConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signerData := xauthsigning.SignerData{
+		ChainID:       t.ChainID,
+		AccountNumber: accountNumber,
+		Sequence:      sequence,
+	}
+	return encCfg.TxConfig.SignModeHandler().GetSignBytes(t.signMode(encCfg.TxConfig), signerData, txBuilder.GetTx())
+}
+
+//signatureError 签名校验失败的错误，code为细分的错误码
+type signatureError struct {
+	code uint64
+	msg  string
+}
+
+func (e *signatureError) Error() string {
+	return e.msg
+}
+
+func newSignatureError(code uint64, format string, a ...interface{}) *signatureError {
+	return &signatureError{code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+//checkSignature 校验待签名数据的哈希和签名，返回压缩格式的公钥
+func checkSignature(signBytes []byte, message, publicKey, signature string) ([]byte, error) {
+	sigHash := owcrypt.Hash(signBytes, 0, owcrypt.HASH_ALG_SHA256)
+	if message != hex.EncodeToString(sigHash) {
+		return nil, newSignatureError(ErrVerifySignBytesMismatch, "sign message does not match the transaction")
+	}
+
+	pub, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil, newSignatureError(ErrVerifyPublicKeyMismatch, "invalid public key: %s", publicKey)
+	}
+	if len(pub) == 65 {
+		pub = owcrypt.PointCompress(pub, CurveType)
+	}
+	if len(pub) != 33 {
+		return nil, newSignatureError(ErrVerifyPublicKeyMismatch, "invalid public key: %s", publicKey)
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != 64 {
+		return nil, newSignatureError(ErrVerifySignatureInvalid, "invalid signature length")
+	}
+
+	if !NewPublicKey(pub).VerifySignature(signBytes, sig) {
+		return nil, newSignatureError(ErrVerifySignatureInvalid, "signature does not match the public key: %s", publicKey)
+	}
+	return pub, nil
+}
+
+//verifyFeePayerSignature 校验手续费支付方的签名
+func (t CosmosTx) verifyFeePayerSignature(signBytes []byte, message, publicKey, signature string) error {
+	pub, err := checkSignature(signBytes, message, publicKey, signature)
+	if err != nil {
+		return err
+	}
+	if addressEncoder.AddressEncode(NewPublicKey(pub).Address().Bytes(), addressEncoder.ATOM_mainnetAddress) != t.FeePayer {
+		return newSignatureError(ErrVerifyPublicKeyMismatch, "public key: %s does not match the fee payer: %s", publicKey, t.FeePayer)
+	}
+	return nil
+}
+
+//verifySignature 校验签名，包括待签名数据、签名和公钥对应的地址
+func (t CosmosTx) verifySignature(signBytes []byte, message, publicKey, signature string) error {
+	pub, err := checkSignature(signBytes, message, publicKey, signature)
+	if err != nil {
+		return err
+	}
+
+	if t.isMultisig() {
+		//多签成员的公钥必须属于多签地址
+		isMember := false
+		for _, member := range t.MultisigPubKeys {
+			if member == hex.EncodeToString(pub) {
+				isMember = true
+				break
+			}
+		}
+		if !isMember {
+			return newSignatureError(ErrVerifyPublicKeyMismatch, "public key: %s is not a member of multisig address: %s", publicKey, t.From)
+		}
+		pubKey, err := t.getPubKey()
+		if err != nil {
+			return err
+		}
+		if addressEncoder.AddressEncode(pubKey.Address().Bytes(), addressEncoder.ATOM_mainnetAddress) != t.From {
+			return newSignatureError(ErrVerifyPublicKeyMismatch, "multisig public keys do not match the address: %s", t.From)
+		}
+		return nil
+	}
+
+	if addressEncoder.AddressEncode(NewPublicKey(pub).Address().Bytes(), addressEncoder.ATOM_mainnetAddress) != t.From {
+		return newSignatureError(ErrVerifyPublicKeyMismatch, "public key: %s does not match the address: %s", publicKey, t.From)
+	}
+	return nil
+}
+
+//getSimulateTxBytes 生成用于模拟交易的编码，签名为空
+func (t CosmosTx) getSimulateTxBytes() ([]byte, error) {
+	encCfg := newEncodingConfig()
+
+	txBuilder, err := t.buildTx(encCfg.TxConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return encCfg.TxConfig.TxEncoder()(txBuilder.GetTx())
+}
+
 func signTransactionHash(txHash string, prikey []byte) (string, error) {
 	hash, err := hex.DecodeString(txHash)
 	if err != nil {
@@ -116,7 +795,7 @@ func signTransactionHash(txHash string, prikey []byte) (string, error) {
 		return "", errors.New("Invalid transaction hash!")
 	}
 
-	sig,_, ret := owcrypt.Signature(prikey, nil, hash, owcrypt.ECC_CURVE_SECP256K1)
+	sig, _, ret := owcrypt.Signature(prikey, nil, hash, owcrypt.ECC_CURVE_SECP256K1)
 
 	if ret != owcrypt.SUCCESS {
 		return "", errors.New("Signature failed!")
@@ -125,75 +804,287 @@ func signTransactionHash(txHash string, prikey []byte) (string, error) {
 	return hex.EncodeToString(sig), nil
 }
 
-func getBroadcastBytes(unsignedTrans,  signature string) (string, error) {
+//decodeUnsignedTx 解析待签名交易单
+func decodeUnsignedTx(unsignedTrans string) (*CosmosTx, error) {
 	txBytes, err := hex.DecodeString(unsignedTrans)
-	if err != nil || len(txBytes) == 0 {
-		return "", err
+	if err != nil {
+		return nil, err
+	}
+	if len(txBytes) == 0 {
+		return nil, errors.New("unsigned transaction is empty")
 	}
 	t := CosmosTx{}
 	err = json.Unmarshal(txBytes, &t)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return &t, nil
+}
+
+//getBroadcastBytes 合并签名生成广播数据，同时返回本地计算的交易哈希
+func getBroadcastBytes(unsignedTrans, signature string) (string, string, error) {
+	return getFeePayerBroadcastBytes(unsignedTrans, signature, "")
+}
+
+//getFeePayerBroadcastBytes 合并发送地址和手续费支付方的签名生成广播数据，没有支付方时feePayerSignature为空
+func getFeePayerBroadcastBytes(unsignedTrans, signature, feePayerSignature string) (string, string, error) {
+	t, err := decodeUnsignedTx(unsignedTrans)
+	if err != nil {
+		return "", "", err
 	}
 	sig, err := hex.DecodeString(signature)
 	if err != nil || len(sig) != 64 {
-		return "", err
+		return "", "", errors.New("invalid signature")
 	}
 
+	encCfg := newEncodingConfig()
 
+	sigData := []signing.SignatureData{&signing.SingleSignatureData{
+		SignMode:  t.signMode(encCfg.TxConfig),
+		Signature: sig,
+	}}
+	if t.hasFeePayer() {
+		payerSig, err := hex.DecodeString(feePayerSignature)
+		if err != nil || len(payerSig) != 64 {
+			return "", "", errors.New("invalid signature of fee payer")
+		}
+		sigData = append(sigData, &signing.SingleSignatureData{
+			SignMode:  t.signMode(encCfg.TxConfig),
+			Signature: payerSig,
+		})
+	}
 
+	txBuilder, err := t.buildTx(encCfg.TxConfig, sigData...)
+	if err != nil {
+		return "", "", err
+	}
 
-	encCfg := simapp.MakeTestEncodingConfig()
-	txBuilder := encCfg.TxConfig.NewTxBuilder()
+	txBytes, err := encCfg.TxConfig.TxEncoder()(txBuilder.GetTx())
+	if err != nil {
+		return "", "", err
+	}
 
-	from, err := types.AccAddressFromBech32(t.From)
+	return hex.EncodeToString(txBytes) + ":" + t.From + "@" + fmt.Sprint(t.AccSeq), getTxHash(txBytes), nil
+}
+
+//getTxHash 交易哈希，为编码后交易的SHA256，与节点返回的txhash相同
+func getTxHash(txBytes []byte) string {
+	return strings.ToUpper(hex.EncodeToString(owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256)))
+}
+
+//getBroadcastTxHash 从广播数据计算交易哈希
+func getBroadcastTxHash(signedTrans string) (string, error) {
+	txBytes, err := hex.DecodeString(strings.Split(signedTrans, ":")[0])
 	if err != nil {
 		return "", err
 	}
-	to, err := types.AccAddressFromBech32(t.To)
+	return getTxHash(txBytes), nil
+}
+
+//parseBroadcastFeePayer 从广播数据中解析手续费支付方的地址和序号，没有支付方时返回false
+func parseBroadcastFeePayer(signedTrans string) (string, uint64, bool) {
+	txBytes, err := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	if err != nil {
+		return "", 0, false
+	}
+	tx, err := newEncodingConfig().TxConfig.TxDecoder()(txBytes)
 	if err != nil {
-		return "", err
+		return "", 0, false
 	}
+	sigTx, ok := tx.(xauthsigning.SigVerifiableTx)
+	if !ok {
+		return "", 0, false
+	}
+	sigs, err := sigTx.GetSignaturesV2()
+	if err != nil || len(sigs) < 2 {
+		return "", 0, false
+	}
+	payer := addressEncoder.AddressEncode(sigs[1].PubKey.Address().Bytes(), addressEncoder.ATOM_mainnetAddress)
+	return payer, sigs[1].Sequence, true
+}
 
-	msg := banktypes.NewMsgSend(from, to, types.NewCoins(types.NewInt64Coin(t.Denom, t.Amount)))
+//parseBroadcastTimeoutHeight 从广播数据中解析交易的超时高度，未设置时为0
+func parseBroadcastTimeoutHeight(signedTrans string) uint64 {
+	txBytes, err := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	if err != nil {
+		return 0
+	}
+	tx, err := newEncodingConfig().TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		return 0
+	}
+	timeoutTx, ok := tx.(types.TxWithTimeoutHeight)
+	if !ok {
+		return 0
+	}
+	return timeoutTx.GetTimeoutHeight()
+}
 
-	err = txBuilder.SetMsgs(msg)
+//parseBroadcastSender 从广播数据中解析发送地址和序号
+func parseBroadcastSender(signedTrans string) (string, uint64, error) {
+	txstrs := strings.Split(signedTrans, ":")
+	if len(txstrs) != 2 {
+		return "", 0, errors.New("invalid broadcast data")
+	}
+	data := strings.Split(txstrs[1], "@")
+	if len(data) != 2 {
+		return "", 0, errors.New("invalid broadcast data")
+	}
+	sequence, err := strconv.ParseUint(data[1], 10, 64)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
+	return data[0], sequence, nil
+}
 
-	txBuilder.SetGasLimit(t.GasLimit)
-	txBuilder.SetFeeAmount(types.NewCoins(types.NewCoin(t.FeeDenom, types.NewInt(t.Fee))))
-	txBuilder.SetMemo(t.Memo)
-	txBuilder.SetTimeoutHeight(t.Timeout)
+//resignBroadcastTx 按新的序号重新签名已签名的单签交易，返回广播数据、被签消息和新的签名
+func resignBroadcastTx(signedTrans, chainID string, accountNumber, sequence uint64, prikey []byte) (string, string, string, error) {
+	from, _, err := parseBroadcastSender(signedTrans)
+	if err != nil {
+		return "", "", "", err
+	}
+	txBytes, err := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	if err != nil {
+		return "", "", "", err
+	}
 
-	var sigsV2 []signing.SignatureV2
-	publicKey, err := hex.DecodeString(t.PublicKey)
+	encCfg := newEncodingConfig()
+
+	tx, err := encCfg.TxConfig.TxDecoder()(txBytes)
 	if err != nil {
-		return "", err
+		return "", "", "", err
+	}
+	txBuilder, err := encCfg.TxConfig.WrapTxBuilder(tx)
+	if err != nil {
+		return "", "", "", err
+	}
+	sigs, err := txBuilder.GetTx().GetSignaturesV2()
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(sigs) != 1 {
+		return "", "", "", errors.New("only single signer transaction can be re-signed")
+	}
+	single, ok := sigs[0].Data.(*signing.SingleSignatureData)
+	if !ok {
+		return "", "", "", errors.New("multisig transaction can not be re-signed")
 	}
 
 	sigV2 := signing.SignatureV2{
-		PubKey:   NewPublicKey(publicKey),
-		Data:     &signing.SingleSignatureData{
-			SignMode:  encCfg.TxConfig.SignModeHandler().DefaultMode(),
-			Signature: sig,
-		},
-		Sequence: t.AccSeq,
+		PubKey:   sigs[0].PubKey,
+		Data:     &signing.SingleSignatureData{SignMode: single.SignMode},
+		Sequence: sequence,
+	}
+	err = txBuilder.SetSignatures(sigV2)
+	if err != nil {
+		return "", "", "", err
 	}
 
-	sigsV2 = append(sigsV2, sigV2)
-
-	err = txBuilder.SetSignatures(sigsV2...)
+	signerData := xauthsigning.SignerData{
+		ChainID:       chainID,
+		AccountNumber: accountNumber,
+		Sequence:      sequence,
+	}
+	signBytes, err := encCfg.TxConfig.SignModeHandler().GetSignBytes(single.SignMode, signerData, txBuilder.GetTx())
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
+	message := hex.EncodeToString(owcrypt.Hash(signBytes, 0, owcrypt.HASH_ALG_SHA256))
+	signature, err := signTransactionHash(message, prikey)
+	if err != nil {
+		return "", "", "", err
+	}
+	sig, _ := hex.DecodeString(signature)
 
+	sigV2.Data = &signing.SingleSignatureData{SignMode: single.SignMode, Signature: sig}
+	err = txBuilder.SetSignatures(sigV2)
+	if err != nil {
+		return "", "", "", err
+	}
 
 	txBytes, err = encCfg.TxConfig.TxEncoder()(txBuilder.GetTx())
 	if err != nil {
-		return "", err
+		return "", "", "", err
+	}
+
+	return hex.EncodeToString(txBytes) + ":" + from + "@" + fmt.Sprint(sequence), message, signature, nil
+}
+
+//getMultisigBroadcastBytes 合并多签成员的签名，signatures为成员公钥到签名的映射，签名数量需达到必要签名数，同时返回交易哈希
+func getMultisigBroadcastBytes(unsignedTrans string, signatures map[string]string) (string, string, error) {
+	t, err := decodeUnsignedTx(unsignedTrans)
+	if err != nil {
+		return "", "", err
+	}
+	if !t.isMultisig() {
+		return "", "", errors.New("transaction is not sent from a multisig address")
+	}
+	members, err := t.getMultisigMembers()
+	if err != nil {
+		return "", "", err
 	}
 
-	return hex.EncodeToString(txBytes) + ":" + t.From + "@" + fmt.Sprint(t.AccSeq), nil
-}
\ No newline at end of file
+	encCfg := newEncodingConfig()
+
+	mSig := multisig.NewMultisig(len(members))
+	count := uint32(0)
+	for i, pub := range t.MultisigPubKeys {
+		signature, ok := signatures[pub]
+		if !ok || signature == "" {
+			continue
+		}
+		sig, err := hex.DecodeString(signature)
+		if err != nil || len(sig) != 64 {
+			return "", "", fmt.Errorf("invalid signature of multisig member: %s", pub)
+		}
+		err = multisig.AddSignatureV2(mSig, signing.SignatureV2{
+			PubKey: members[i],
+			Data: &signing.SingleSignatureData{
+				SignMode:  t.signMode(encCfg.TxConfig),
+				Signature: sig,
+			},
+			Sequence: t.AccSeq,
+		}, members)
+		if err != nil {
+			return "", "", err
+		}
+		count++
+		if count == t.Threshold {
+			break
+		}
+	}
+	if count < t.Threshold {
+		return "", "", fmt.Errorf("multisig requires %d signatures, got %d", t.Threshold, count)
+	}
+
+	txBuilder, err := t.buildTx(encCfg.TxConfig, mSig)
+	if err != nil {
+		return "", "", err
+	}
+
+	txBytes, err := encCfg.TxConfig.TxEncoder()(txBuilder.GetTx())
+	if err != nil {
+		return "", "", err
+	}
+
+	return hex.EncodeToString(txBytes) + ":" + t.From + "@" + fmt.Sprint(t.AccSeq), getTxHash(txBytes), nil
+}
+
+//NewMultisigAddress 通过成员公钥和必要签名数生成多签地址
+func NewMultisigAddress(pubs [][]byte, threshold int) (string, error) {
+	if threshold <= 0 || threshold > len(pubs) {
+		return "", fmt.Errorf("invalid multisig threshold: %d of %d", threshold, len(pubs))
+	}
+	members := make([]cryptotypes.PubKey, 0, len(pubs))
+	for _, pub := range pubs {
+		if len(pub) == 65 {
+			pub = owcrypt.PointCompress(pub, CurveType)
+		}
+		if len(pub) != 33 {
+			return "", fmt.Errorf("invalid public key: %s", hex.EncodeToString(pub))
+		}
+		members = append(members, NewPublicKey(pub))
+	}
+	pubKey := kmultisig.NewLegacyAminoPubKey(threshold, members)
+	return addressEncoder.AddressEncode(pubKey.Address().Bytes(), addressEncoder.ATOM_mainnetAddress), nil
+}
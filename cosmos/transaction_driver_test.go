@@ -3,7 +3,19 @@ package cosmos
 import (
 	"encoding/hex"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+	xauthsigning "github.com/cosmos/cosmos-sdk/x/auth/signing"
+	"github.com/cosmos/cosmos-sdk/x/authz"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	"github.com/cosmos/cosmos-sdk/x/feegrant"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
 )
 
 func Test_transaction(t *testing.T) {
@@ -15,7 +27,7 @@ func Test_transaction(t *testing.T) {
 		Memo:      "123",
 		ChainID:   "cosmoshub-4",
 		PublicKey: "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
-		Amount:    500000,
+		Amount:    big.NewInt(500000),
 		Fee:       2500,
 		AccNum:    173110,
 		AccSeq:    5,
@@ -44,11 +56,704 @@ func Test_transaction(t *testing.T) {
 	// signature = hex.EncodeToString([]byte{169,213,22,69,126,153,158,86,46,52,137,108,112,198,224,171,82,18,230,38,133,30,179,81,31,245,74,123,106,248,57,172,95,199,41,201,188,125,51,35,152,52,112,59,149,92,235,23,217,162,165,83,76,118,72,22,31,24,222,231,10,100,65,227})
 	fmt.Println("signature : ", signature)
 
-	broadcastBytes, err :=getBroadcastBytes(unsignedTrans, signature)
+	broadcastBytes, _, err := getBroadcastBytes(unsignedTrans, signature)
 	if err != nil {
 		t.Error("combine failed")
 		return
 	}
 
 	fmt.Println("broadcast : ", broadcastBytes)
-}
\ No newline at end of file
+}
+func Test_stakingTransaction(t *testing.T) {
+	from, _ := types.AccAddressFromBech32("cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9")
+	other, _ := types.AccAddressFromBech32("cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n")
+	validator := types.ValAddress(from).String()
+	dstValidator := types.ValAddress(other).String()
+
+	for _, action := range []string{TxActionDelegate, TxActionUndelegate, TxActionRedelegate} {
+		cosmosTx := CosmosTx{
+			From:         "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+			Denom:        "uatom",
+			FeeDenom:     "uatom",
+			ChainID:      "cosmoshub-4",
+			PublicKey:    "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+			Amount:       big.NewInt(500000),
+			Fee:          2500,
+			AccNum:       173110,
+			AccSeq:       5,
+			GasLimit:     200000,
+			Action:       action,
+			Validator:    validator,
+			DstValidator: dstValidator,
+		}
+
+		unsignedTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+		if err != nil {
+			t.Errorf("%s create failed: %v", action, err)
+			return
+		}
+
+		private_key, _ := hex.DecodeString("1234567812345678123456781234567812345678123456781234567812345678")
+		signature, err := signTransactionHash(hash, private_key)
+		if err != nil {
+			t.Errorf("%s sign failed: %v", action, err)
+			return
+		}
+
+		broadcastBytes, _, err := getBroadcastBytes(unsignedTrans, signature)
+		if err != nil {
+			t.Errorf("%s combine failed: %v", action, err)
+			return
+		}
+
+		txBytes, _ := hex.DecodeString(strings.Split(broadcastBytes, ":")[0])
+		tx, err := newEncodingConfig().TxConfig.TxDecoder()(txBytes)
+		if err != nil || len(tx.GetMsgs()) != 1 {
+			t.Fatalf("%s decode failed: %v", action, err)
+		}
+		coin := types.NewInt64Coin("uatom", 500000)
+		switch msg := tx.GetMsgs()[0].(type) {
+		case *stakingtypes.MsgDelegate:
+			if action != TxActionDelegate || msg.DelegatorAddress != cosmosTx.From || msg.ValidatorAddress != validator || !msg.Amount.IsEqual(coin) {
+				t.Errorf("%s unexpected message: %v", action, msg)
+			}
+		case *stakingtypes.MsgUndelegate:
+			if action != TxActionUndelegate || msg.DelegatorAddress != cosmosTx.From || msg.ValidatorAddress != validator || !msg.Amount.IsEqual(coin) {
+				t.Errorf("%s unexpected message: %v", action, msg)
+			}
+		case *stakingtypes.MsgBeginRedelegate:
+			if action != TxActionRedelegate || msg.DelegatorAddress != cosmosTx.From || msg.ValidatorSrcAddress != validator ||
+				msg.ValidatorDstAddress != dstValidator || !msg.Amount.IsEqual(coin) {
+				t.Errorf("%s unexpected message: %v", action, msg)
+			}
+		default:
+			t.Errorf("%s unexpected message type: %T", action, msg)
+		}
+	}
+
+	//只能领取委托人自己运营的验证人佣金
+	cosmosTx := CosmosTx{
+		From:                "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		Denom:               "uatom",
+		Action:              TxActionWithdraw,
+		Validators:          []string{dstValidator},
+		CommissionValidator: validator,
+	}
+	msgs, err := cosmosTx.getMsgs()
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("withdraw create failed: %v", err)
+	}
+	if msg, ok := msgs[1].(*distrtypes.MsgWithdrawValidatorCommission); !ok || msg.ValidatorAddress != validator {
+		t.Errorf("unexpected commission message: %v", msgs[1])
+	}
+	cosmosTx.CommissionValidator = dstValidator
+	if _, err = cosmosTx.getMsgs(); err == nil {
+		t.Errorf("commission of other validator should fail")
+	}
+}
+
+func Test_voteTransaction(t *testing.T) {
+	for _, option := range []string{"yes", "no_with_veto", "yes=0.6,no=0.4"} {
+		cosmosTx := CosmosTx{
+			From:       "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+			Denom:      "uatom",
+			FeeDenom:   "uatom",
+			ChainID:    "cosmoshub-4",
+			PublicKey:  "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+			Fee:        2500,
+			AccNum:     173110,
+			AccSeq:     5,
+			GasLimit:   200000,
+			Action:     TxActionVote,
+			ProposalID: 37,
+			VoteOption: option,
+		}
+
+		_, hash, err := cosmosTx.getUnsignedTxAndHash()
+		if err != nil {
+			t.Errorf("vote %s create failed: %v", option, err)
+			return
+		}
+		fmt.Println(option, "hash : ", hash)
+	}
+
+	if normalizeVoteOption("yes=0.6, no=0.4") != "VOTE_OPTION_YES=0.6,VOTE_OPTION_NO=0.4" {
+		t.Errorf("normalize weighted vote option failed: %s", normalizeVoteOption("yes=0.6, no=0.4"))
+	}
+}
+
+func Test_ibcTransferTransaction(t *testing.T) {
+	cosmosTx := CosmosTx{
+		From:             "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		To:               "osmo1djhe9ury7c05gu5ptjefv0uj9gp48a90r8u8fs",
+		Denom:            "uatom",
+		FeeDenom:         "uatom",
+		ChainID:          "cosmoshub-4",
+		PublicKey:        "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+		Amount:           big.NewInt(1000000),
+		Fee:              2500,
+		AccNum:           173110,
+		AccSeq:           5,
+		GasLimit:         200000,
+		Action:           TxActionIBC,
+		SourcePort:       "transfer",
+		SourceChannel:    "channel-141",
+		TimeoutTimestamp: 1636341165000000000,
+	}
+
+	unsignedTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Errorf("ibc transfer create failed: %v", err)
+		return
+	}
+
+	private_key, _ := hex.DecodeString("1234567812345678123456781234567812345678123456781234567812345678")
+	signature, _ := signTransactionHash(hash, private_key)
+	broadcastBytes, _, err := getBroadcastBytes(unsignedTrans, signature)
+	if err != nil {
+		t.Errorf("ibc transfer combine failed: %v", err)
+		return
+	}
+	fmt.Println("broadcast : ", broadcastBytes)
+
+	cosmosTx.TimeoutTimestamp = 0
+	if _, _, err := cosmosTx.getUnsignedTxAndHash(); err == nil {
+		t.Errorf("ibc transfer without timeout should fail")
+	}
+}
+
+func Test_batchSendTransaction(t *testing.T) {
+	for _, multiSend := range []bool{false, true} {
+		cosmosTx := CosmosTx{
+			From:      "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+			Denom:     "uatom",
+			FeeDenom:  "uatom",
+			ChainID:   "cosmoshub-4",
+			PublicKey: "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+			Fee:       5000,
+			AccNum:    173110,
+			AccSeq:    5,
+			GasLimit:  400000,
+			Outputs: []CosmosOutput{
+				{To: "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n", Amount: big.NewInt(500000)},
+				{To: "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9", Amount: big.NewInt(200000)},
+			},
+			MultiSend: multiSend,
+		}
+
+		msgs, err := cosmosTx.getMsgs()
+		if err != nil {
+			t.Errorf("batch send create failed: %v", err)
+			return
+		}
+		if multiSend && len(msgs) != 1 || !multiSend && len(msgs) != 2 {
+			t.Errorf("unexpected message count: %d", len(msgs))
+		}
+
+		_, _, err = cosmosTx.getUnsignedTxAndHash()
+		if err != nil {
+			t.Errorf("batch send create failed: %v", err)
+			return
+		}
+	}
+}
+
+func Test_simulateTxBytes(t *testing.T) {
+	cosmosTx := CosmosTx{
+		From:      "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		To:        "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:     "uatom",
+		FeeDenom:  "uatom",
+		ChainID:   "cosmoshub-4",
+		PublicKey: "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+		Amount:    big.NewInt(500000),
+		Fee:       2500,
+		AccNum:    173110,
+		AccSeq:    5,
+		GasLimit:  200000,
+	}
+
+	txBytes, err := cosmosTx.getSimulateTxBytes()
+	if err != nil {
+		t.Errorf("simulate tx bytes create failed: %v", err)
+		return
+	}
+
+	tx, err := newEncodingConfig().TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		t.Errorf("simulate tx bytes decode failed: %v", err)
+		return
+	}
+	if len(tx.GetMsgs()) != 1 {
+		t.Errorf("unexpected message count: %d", len(tx.GetMsgs()))
+	}
+}
+
+func Test_calculateFee(t *testing.T) {
+	gasPrice := convertGasPriceFromAmount("0.0000000125")
+	if fee := calculateFee(200000, gasPrice); fee != 2500 {
+		t.Errorf("unexpected fee: %d", fee)
+	}
+	if fee := calculateFee(100001, gasPrice); fee != 1251 {
+		t.Errorf("unexpected fee: %d", fee)
+	}
+	if price := convertGasPriceToAmount(gasPrice); price != "0.0000000125" {
+		t.Errorf("unexpected gas price: %s", price)
+	}
+}
+
+func Test_multisigTransaction(t *testing.T) {
+	prikeys := []string{
+		"1234567812345678123456781234567812345678123456781234567812345678",
+		"2234567812345678123456781234567812345678123456781234567812345678",
+		"3234567812345678123456781234567812345678123456781234567812345678",
+	}
+	pubs := make([][]byte, 0)
+	pubHexs := make([]string, 0)
+	for _, k := range prikeys {
+		key, _ := hex.DecodeString(k)
+		pub := (&secp256k1.PrivKey{Key: key}).PubKey().Bytes()
+		pubs = append(pubs, pub)
+		pubHexs = append(pubHexs, hex.EncodeToString(pub))
+	}
+
+	address, err := NewMultisigAddress(pubs, 2)
+	if err != nil {
+		t.Errorf("multisig address create failed: %v", err)
+		return
+	}
+	if !strings.HasPrefix(address, "cosmos1") {
+		t.Errorf("unexpected multisig address: %s", address)
+	}
+
+	cosmosTx := CosmosTx{
+		From:            address,
+		To:              "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:           "uatom",
+		FeeDenom:        "uatom",
+		ChainID:         "cosmoshub-4",
+		Amount:          big.NewInt(500000),
+		Fee:             2500,
+		AccNum:          173110,
+		AccSeq:          5,
+		GasLimit:        200000,
+		MultisigPubKeys: pubHexs,
+		Threshold:       2,
+	}
+
+	unsignedTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Errorf("multisig create failed: %v", err)
+		return
+	}
+
+	signatures := make(map[string]string)
+	key, _ := hex.DecodeString(prikeys[0])
+	signatures[pubHexs[0]], _ = signTransactionHash(hash, key)
+	_, _, err = getMultisigBroadcastBytes(unsignedTrans, signatures)
+	if err == nil {
+		t.Errorf("multisig should require 2 signatures")
+		return
+	}
+
+	key, _ = hex.DecodeString(prikeys[2])
+	signatures[pubHexs[2]], _ = signTransactionHash(hash, key)
+	signedTrans, _, err := getMultisigBroadcastBytes(unsignedTrans, signatures)
+	if err != nil {
+		t.Errorf("multisig compose signatures failed: %v", err)
+		return
+	}
+
+	txBytes, _ := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	encCfg := newEncodingConfig()
+	tx, err := encCfg.TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		t.Errorf("multisig tx decode failed: %v", err)
+		return
+	}
+	sigs, err := tx.(xauthsigning.SigVerifiableTx).GetSignaturesV2()
+	if err != nil || len(sigs) != 1 {
+		t.Errorf("unexpected signatures: %v", err)
+		return
+	}
+	pubKey, _ := cosmosTx.getPubKey()
+	signerData := xauthsigning.SignerData{
+		ChainID:       cosmosTx.ChainID,
+		AccountNumber: cosmosTx.AccNum,
+		Sequence:      cosmosTx.AccSeq,
+	}
+	err = xauthsigning.VerifySignature(pubKey, signerData, sigs[0].Data, encCfg.TxConfig.SignModeHandler(), tx)
+	if err != nil {
+		t.Errorf("multisig verify failed: %v", err)
+	}
+	if _, ok := sigs[0].Data.(*signing.MultiSignatureData); !ok {
+		t.Errorf("unexpected signature data")
+	}
+}
+
+func Test_aminoJSONTransaction(t *testing.T) {
+	private_key, _ := hex.DecodeString("1234567812345678123456781234567812345678123456781234567812345678")
+	pub := (&secp256k1.PrivKey{Key: private_key}).PubKey()
+	cosmosTx := CosmosTx{
+		From:      types.AccAddress(pub.Address()).String(),
+		To:        "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:     "uatom",
+		FeeDenom:  "uatom",
+		Memo:      "123",
+		ChainID:   "cosmoshub-4",
+		PublicKey: hex.EncodeToString(pub.Bytes()),
+		Amount:    big.NewInt(500000),
+		Fee:       2500,
+		AccNum:    173110,
+		AccSeq:    5,
+		GasLimit:  200000,
+		SignMode:  SignModeAminoJSON,
+	}
+
+	unsignedTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Errorf("create failed: %v", err)
+		return
+	}
+
+	signDoc, err := GetAminoSignDoc(unsignedTrans)
+	if err != nil {
+		t.Errorf("get sign doc failed: %v", err)
+		return
+	}
+	if !strings.HasPrefix(signDoc, `{"account_number":"173110","chain_id":"cosmoshub-4",`) {
+		t.Errorf("unexpected sign doc: %s", signDoc)
+	}
+
+	signature, _ := signTransactionHash(hash, private_key)
+	signedTrans, _, err := getBroadcastBytes(unsignedTrans, signature)
+	if err != nil {
+		t.Errorf("compose signatures failed: %v", err)
+		return
+	}
+
+	txBytes, _ := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	encCfg := newEncodingConfig()
+	tx, err := encCfg.TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		t.Errorf("tx decode failed: %v", err)
+		return
+	}
+	sigs, _ := tx.(xauthsigning.SigVerifiableTx).GetSignaturesV2()
+	data, ok := sigs[0].Data.(*signing.SingleSignatureData)
+	if !ok || data.SignMode != signing.SignMode_SIGN_MODE_LEGACY_AMINO_JSON {
+		t.Errorf("unexpected sign mode")
+		return
+	}
+	signerData := xauthsigning.SignerData{
+		ChainID:       cosmosTx.ChainID,
+		AccountNumber: cosmosTx.AccNum,
+		Sequence:      cosmosTx.AccSeq,
+	}
+	err = xauthsigning.VerifySignature(pub, signerData, data, encCfg.TxConfig.SignModeHandler(), tx)
+	if err != nil {
+		t.Errorf("verify failed: %v", err)
+	}
+
+	cosmosTx.SignMode = SignModeDirect
+	unsignedTrans, _, _ = cosmosTx.getUnsignedTxAndHash()
+	if _, err = GetAminoSignDoc(unsignedTrans); err == nil {
+		t.Errorf("direct mode should not have amino sign doc")
+	}
+}
+
+func Test_feeDelegationTransaction(t *testing.T) {
+	fromKey, _ := hex.DecodeString("1234567812345678123456781234567812345678123456781234567812345678")
+	payerKey, _ := hex.DecodeString("2234567812345678123456781234567812345678123456781234567812345678")
+	fromPub := (&secp256k1.PrivKey{Key: fromKey}).PubKey()
+	payerPub := (&secp256k1.PrivKey{Key: payerKey}).PubKey()
+
+	cosmosTx := CosmosTx{
+		From:              types.AccAddress(fromPub.Address()).String(),
+		To:                "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:             "uatom",
+		FeeDenom:          "uatom",
+		ChainID:           "cosmoshub-4",
+		PublicKey:         hex.EncodeToString(fromPub.Bytes()),
+		Amount:            big.NewInt(500000),
+		Fee:               2500,
+		AccNum:            173110,
+		AccSeq:            5,
+		GasLimit:          200000,
+		FeeGranter:        "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		FeePayer:          types.AccAddress(payerPub.Address()).String(),
+		FeePayerPublicKey: hex.EncodeToString(payerPub.Bytes()),
+		FeePayerAccNum:    173111,
+		FeePayerAccSeq:    9,
+	}
+
+	unsignedTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Fatalf("fee delegation create failed: %v", err)
+	}
+	payerHash, err := cosmosTx.getFeePayerHash()
+	if err != nil || payerHash == hash {
+		t.Fatalf("fee payer should sign with its own account number and sequence: %v", err)
+	}
+	signature, _ := signTransactionHash(hash, fromKey)
+	payerSignature, _ := signTransactionHash(payerHash, payerKey)
+
+	//缺少支付方的签名
+	_, _, err = getBroadcastBytes(unsignedTrans, signature)
+	if err == nil {
+		t.Errorf("fee payer signature should be required")
+	}
+
+	signedTrans, _, err := getFeePayerBroadcastBytes(unsignedTrans, signature, payerSignature)
+	if err != nil {
+		t.Fatalf("fee delegation compose signatures failed: %v", err)
+	}
+	payer, payerSequence, ok := parseBroadcastFeePayer(signedTrans)
+	if !ok || payer != cosmosTx.FeePayer || payerSequence != 9 {
+		t.Errorf("unexpected fee payer: %s %d", payer, payerSequence)
+	}
+
+	encCfg := newEncodingConfig()
+	txBytes, _ := hex.DecodeString(strings.Split(signedTrans, ":")[0])
+	tx, err := encCfg.TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	feeTx := tx.(types.FeeTx)
+	if feeTx.FeeGranter().String() != cosmosTx.FeeGranter || feeTx.FeePayer().String() != cosmosTx.FeePayer {
+		t.Errorf("unexpected fee granter or payer: %s %s", feeTx.FeeGranter(), feeTx.FeePayer())
+	}
+	sigs, _ := tx.(xauthsigning.SigVerifiableTx).GetSignaturesV2()
+	signers := []xauthsigning.SignerData{
+		{ChainID: "cosmoshub-4", AccountNumber: 173110, Sequence: 5},
+		{ChainID: "cosmoshub-4", AccountNumber: 173111, Sequence: 9},
+	}
+	for i, sig := range sigs {
+		signBytes, _ := encCfg.TxConfig.SignModeHandler().GetSignBytes(signing.SignMode_SIGN_MODE_DIRECT, signers[i], tx)
+		if !sig.PubKey.VerifySignature(signBytes, sig.Data.(*signing.SingleSignatureData).Signature) {
+			t.Errorf("signature %d verify failed", i)
+		}
+	}
+
+	//amino_json模式不签名手续费授权方和支付方
+	cosmosTx.SignMode = SignModeAminoJSON
+	_, _, err = cosmosTx.getUnsignedTxAndHash()
+	if err == nil {
+		t.Errorf("fee delegation should not be supported in amino_json mode")
+	}
+}
+
+func Test_feeAllowanceTransaction(t *testing.T) {
+	cosmosTx := CosmosTx{
+		From:                 "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		To:                   "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:                "uatom",
+		FeeDenom:             "uatom",
+		ChainID:              "cosmoshub-4",
+		PublicKey:            "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+		Amount:               big.NewInt(10000000),
+		Fee:                  2500,
+		AccNum:               173110,
+		AccSeq:               5,
+		GasLimit:             200000,
+		Action:               TxActionGrantFee,
+		AllowanceExpiration:  1893456000,
+		AllowancePeriod:      86400,
+		AllowancePeriodLimit: 100000,
+		AllowancePeriodReset: 1667260800,
+	}
+
+	msgs, err := cosmosTx.getMsgs()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("grant allowance create failed: %v", err)
+	}
+	grant, ok := msgs[0].(*feegrant.MsgGrantAllowance)
+	if !ok || grant.Grantee != cosmosTx.To {
+		t.Fatalf("unexpected grant message: %v", msgs[0])
+	}
+	allowance, err := grant.GetFeeAllowanceI()
+	if err != nil {
+		t.Fatalf("unexpected allowance: %v", err)
+	}
+	periodic, ok := allowance.(*feegrant.PeriodicAllowance)
+	if !ok || periodic.Basic.SpendLimit.AmountOf("uatom").Int64() != 10000000 || periodic.PeriodSpendLimit.AmountOf("uatom").Int64() != 100000 {
+		t.Errorf("unexpected periodic allowance: %v", allowance)
+	}
+	_, _, err = cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Errorf("grant allowance sign bytes failed: %v", err)
+	}
+
+	//周期额度大于总额度
+	cosmosTx.AllowancePeriodLimit = 20000000
+	if _, err = cosmosTx.getMsgs(); err == nil {
+		t.Errorf("period spend limit greater than spend limit should fail")
+	}
+
+	cosmosTx.Action = TxActionRevokeFee
+	msgs, err = cosmosTx.getMsgs()
+	if err != nil {
+		t.Fatalf("revoke allowance create failed: %v", err)
+	}
+	if _, ok := msgs[0].(*feegrant.MsgRevokeAllowance); !ok {
+		t.Errorf("unexpected revoke message: %v", msgs[0])
+	}
+}
+
+func Test_authzTransaction(t *testing.T) {
+	cosmosTx := CosmosTx{
+		From:            "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		To:              "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:           "uatom",
+		FeeDenom:        "uatom",
+		ChainID:         "cosmoshub-4",
+		PublicKey:       "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+		Amount:          big.NewInt(10000000),
+		Fee:             2500,
+		AccNum:          173110,
+		AccSeq:          5,
+		GasLimit:        200000,
+		Action:          TxActionGrantAuthz,
+		AuthzType:       AuthzTypeSend,
+		AuthzExpiration: 1893456000,
+	}
+
+	//send授权限定转账额度
+	msgs, err := cosmosTx.getMsgs()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("grant authorization create failed: %v", err)
+	}
+	grant, ok := msgs[0].(*authz.MsgGrant)
+	if !ok || grant.Granter != cosmosTx.From || grant.Grantee != cosmosTx.To {
+		t.Fatalf("unexpected grant message: %v", msgs[0])
+	}
+	sendAuth, ok := grant.Grant.GetAuthorization().(*banktypes.SendAuthorization)
+	if !ok || sendAuth.SpendLimit.AmountOf("uatom").Int64() != 10000000 {
+		t.Errorf("unexpected send authorization: %v", grant.Grant.GetAuthorization())
+	}
+	_, _, err = cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Errorf("grant authorization sign bytes failed: %v", err)
+	}
+
+	//generic授权只能领取收益
+	cosmosTx.AuthzType = AuthzTypeGeneric
+	cosmosTx.AuthzMsgTypeURL = "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward"
+	msgs, err = cosmosTx.getMsgs()
+	if err != nil {
+		t.Fatalf("grant generic authorization create failed: %v", err)
+	}
+	if auth := msgs[0].(*authz.MsgGrant).Grant.GetAuthorization(); auth.MsgTypeURL() != cosmosTx.AuthzMsgTypeURL {
+		t.Errorf("unexpected generic authorization: %v", auth)
+	}
+
+	//已过期的授权
+	cosmosTx.AuthzExpiration = 1600000000
+	if _, err = cosmosTx.getMsgs(); err == nil {
+		t.Errorf("expired authorization should fail")
+	}
+
+	cosmosTx.Action = TxActionRevokeAuthz
+	msgs, err = cosmosTx.getMsgs()
+	if err != nil {
+		t.Fatalf("revoke authorization create failed: %v", err)
+	}
+	if revoke, ok := msgs[0].(*authz.MsgRevoke); !ok || revoke.MsgTypeUrl != cosmosTx.AuthzMsgTypeURL {
+		t.Errorf("unexpected revoke message: %v", msgs[0])
+	}
+
+	//被授权方签名，从授权方转出
+	cosmosTx.Action = TxActionSend
+	cosmosTx.AuthzGranter = "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"
+	cosmosTx.To = "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9"
+	msgs, err = cosmosTx.getMsgs()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("exec create failed: %v", err)
+	}
+	exec, ok := msgs[0].(*authz.MsgExec)
+	if !ok || exec.Grantee != cosmosTx.From || exec.GetSigners()[0].String() != cosmosTx.From {
+		t.Fatalf("unexpected exec message: %v", msgs[0])
+	}
+	inner, err := exec.GetMessages()
+	if err != nil || len(inner) != 1 {
+		t.Fatalf("unexpected exec messages: %v", err)
+	}
+	if send, ok := inner[0].(*banktypes.MsgSend); !ok || send.FromAddress != cosmosTx.AuthzGranter || send.ToAddress != cosmosTx.To {
+		t.Errorf("unexpected inner message: %v", inner[0])
+	}
+	_, _, err = cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Errorf("exec sign bytes failed: %v", err)
+	}
+
+	//代为领取授权方的收益
+	cosmosTx.Action = TxActionWithdraw
+	cosmosTx.Validators = []string{"cosmosvaloper1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u2lcnj0"}
+	msgs, _ = cosmosTx.getMsgs()
+	inner, _ = msgs[0].(*authz.MsgExec).GetMessages()
+	if withdraw, ok := inner[0].(*distrtypes.MsgWithdrawDelegatorReward); !ok || withdraw.DelegatorAddress != cosmosTx.AuthzGranter {
+		t.Errorf("unexpected inner message: %v", inner[0])
+	}
+
+	cosmosTx.SignMode = SignModeAminoJSON
+	_, _, err = cosmosTx.getUnsignedTxAndHash()
+	if err == nil {
+		t.Errorf("authz exec should not be supported in amino_json mode")
+	}
+}
+
+func Test_denomTransaction(t *testing.T) {
+	usdc := "ibc/CDC4587874B85BEA4FCEC3CEA5A1195139799A1FEE711A07D972537E18FDA39D"
+	cosmosTx := CosmosTx{
+		From:      "cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9",
+		To:        "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:     usdc,
+		FeeDenom:  "uatom",
+		ChainID:   "cosmoshub-4",
+		PublicKey: "025b8ed615288ce216206af060838d5df5c2d14af2651dd231c199ab2567dbb0a3",
+		Amount:    convertFromDenomAmount("25.5", 6),
+		Fee:       2500,
+		AccNum:    173110,
+		AccSeq:    5,
+		GasLimit:  200000,
+	}
+
+	//转出代币，手续费使用主币支付
+	msgs, err := cosmosTx.getMsgs()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("denom transfer create failed: %v", err)
+	}
+	send, ok := msgs[0].(*banktypes.MsgSend)
+	if !ok || send.Amount.AmountOf(usdc).Int64() != 25500000 || send.Amount.AmountOf("uatom").Int64() != 0 {
+		t.Fatalf("unexpected send message: %v", msgs[0])
+	}
+	if _, _, err = cosmosTx.getUnsignedTxAndHash(); err != nil {
+		t.Errorf("denom transfer sign bytes failed: %v", err)
+	}
+	pkg, err := newSigningPackage(mustUnsignedTx(t, &cosmosTx))
+	if err != nil || pkg.Fee.Denom != "uatom" {
+		t.Errorf("unexpected fee of denom transfer: %+v %v", pkg, err)
+	}
+
+	//按合约精度换算数量，18位精度的数量超过uint64
+	weth, _ := new(big.Int).SetString("1500000000000000000000", 10)
+	if amount := convertToDenomAmount(weth, 18); amount != "1500" {
+		t.Errorf("unexpected amount: %s", amount)
+	}
+	if amount := convertFromDenomAmount("1500", 18); amount.Cmp(weth) != 0 {
+		t.Errorf("unexpected amount: %s", amount)
+	}
+	if amount := convertFromDenomAmount("1.0000000000000000009", 18); amount.String() != "1000000000000000000" {
+		t.Errorf("amount below the smallest unit should be truncated: %s", amount)
+	}
+
+	cosmosTx.Denom = "weth-wei"
+	cosmosTx.Amount = weth
+	msgs, err = cosmosTx.getMsgs()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("weth transfer create failed: %v", err)
+	}
+	if send, ok = msgs[0].(*banktypes.MsgSend); !ok || send.Amount.AmountOf("weth-wei").BigInt().Cmp(weth) != 0 {
+		t.Errorf("unexpected send message: %v", msgs[0])
+	}
+}
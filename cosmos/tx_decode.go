@@ -24,9 +24,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/blocktree/go-owcdrivers/owkeychain"
 	ow "github.com/blocktree/openwallet/v2/common"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
 )
 
 type TransactionDecoder struct {
@@ -65,21 +68,27 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		return nil, fmt.Errorf("transaction is not completed validation")
 	}
 
-	txid, err := decoder.wm.SendRawTransaction(rawTx.RawHex)
+	mode := decoder.wm.Config.BroadcastMode
+	if broadcastMode := rawTx.GetExtParam().Get("broadcast_mode"); broadcastMode.Exists() {
+		mode = broadcastMode.String()
+	}
+	if !isValidBroadcastMode(mode) {
+		return nil, fmt.Errorf("unsupported broadcast mode: %s", mode)
+	}
+
+	txid, err := decoder.broadcastTransaction(wrapper, rawTx, mode)
 	if err != nil {
 		fmt.Println("Tx to send: ", rawTx.RawHex)
-		return nil, err
-	} else {
-		addr_seq := strings.Split(rawTx.RawHex, ":")[1]
-		data := strings.Split(addr_seq, "@")
-		sequence, _  := strconv.Atoi(data[1])
-		wrapper.SetAddressExtParam(data[0], decoder.wm.FullName(), sequence + 1)
+		return nil, convertBroadcastError(err)
 	}
 
 	rawTx.TxID = txid
 	rawTx.IsSubmit = true
 
 	decimals := int32(8)
+	if rawTx.Coin.IsContract {
+		decimals = int32(rawTx.Coin.Contract.Decimals)
+	}
 
 	tx := openwallet.Transaction{
 		From:       rawTx.TxFrom,
@@ -91,6 +100,18 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		AccountID:  rawTx.Account.AccountID,
 		Fees:       rawTx.Fees,
 		SubmitTime: time.Now().Unix(),
+		TxAction:   rawTx.GetExtParam().Get("action").String(),
+	}
+
+	if mode == BroadcastModeConfirm {
+		decoder.confirmTransaction(&tx)
+		if tx.TxAction == TxActionIBC && tx.Status == openwallet.TxStatusSuccess {
+			decoder.trackIBCPacket(&tx)
+		}
+	}
+	//所有广播模式下都在后台继续等待数据包被确认或超时
+	if tx.TxAction == TxActionIBC && tx.Status != openwallet.TxStatusFail {
+		go decoder.watchIBCPacket(tx.TxID)
 	}
 
 	tx.WxID = openwallet.GenTransactionWxID(&tx)
@@ -98,6 +119,59 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 	return &tx, nil
 }
 
+//trackIBCPacket 记录已上链的IBC转账发出的数据包和当前状态，之后可通过GetIBCPacket查询是否已确认或超时
+func (decoder *TransactionDecoder) trackIBCPacket(tx *openwallet.Transaction) {
+	packet, err := decoder.wm.GetIBCPacket(tx.TxID)
+	if err != nil {
+		decoder.wm.Log.Warningf("get ibc packet of transaction: %s failed, %v", tx.TxID, err)
+		return
+	}
+	tx.SetExtParam("ibcPacketSequence", packet.Sequence)
+	tx.SetExtParam("ibcPacketSrcPort", packet.SourcePort)
+	tx.SetExtParam("ibcPacketSrcChannel", packet.SourceChannel)
+	tx.SetExtParam("ibcPacketDstChannel", packet.DestChannel)
+	tx.SetExtParam("ibcPacketStatus", packet.Status)
+	tx.SetExtParam("ibcPacketReason", packet.Reason)
+}
+
+//watchIBCPacket 等待IBC转账的数据包被确认或超时，并通知设置的回调
+func (decoder *TransactionDecoder) watchIBCPacket(txid string) {
+	packet, err := decoder.wm.WaitIBCPacket(txid, decoder.wm.Config.IBCPacketTimeout)
+	if err != nil {
+		decoder.wm.Log.Warningf("wait ibc packet of transaction: %s failed, %v", txid, err)
+		return
+	}
+	decoder.wm.Log.Infof("ibc packet of transaction: %s, sequence: %d, status: %s", txid, packet.Sequence, packet.Status)
+	decoder.wm.notifyIBCPacket(packet)
+}
+
+//confirmTransaction 等待交易上链，按执行结果设置交易的区块、状态和回执，超时未上链时不设置状态
+func (decoder *TransactionDecoder) confirmTransaction(tx *openwallet.Transaction) {
+	result, err := decoder.wm.WaitForTransaction(tx.TxID, decoder.wm.Config.ConfirmTimeout)
+	if err != nil {
+		decoder.wm.Log.Warningf("%v", err)
+		return
+	}
+
+	tx.BlockHeight = result.Height
+	if blockHash, err := decoder.wm.RestClient.getBlockHash(result.Height); err == nil {
+		tx.BlockHash = blockHash
+	}
+	if confirmTime, err := time.Parse(time.RFC3339, result.Timestamp); err == nil {
+		tx.ConfirmTime = confirmTime.Unix()
+	}
+	tx.Status = openwallet.TxStatusSuccess
+	if result.Code != 0 {
+		tx.Status = openwallet.TxStatusFail
+		tx.Reason = result.RawLog
+	}
+	tx.SetExtParam("code", result.Code)
+	tx.SetExtParam("codespace", result.Codespace)
+	tx.SetExtParam("gasWanted", result.GasWanted)
+	tx.SetExtParam("gasUsed", result.GasUsed)
+	tx.SetExtParam("rawLog", result.RawLog)
+}
+
 func (decoder *TransactionDecoder) CreateATOMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
 	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
@@ -110,14 +184,36 @@ func (decoder *TransactionDecoder) CreateATOMRawTransaction(wrapper openwallet.W
 		return openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", rawTx.Account.AccountID)
 	}
 
+	//合约资产为bank模块的其他denom，数量按合约精度换算，手续费使用主币支付
+	denom, decimals, err := decoder.wm.getCoinDenom(rawTx.Coin)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
+	}
+	isToken := denom != decoder.wm.Config.Denom
+	//数量按denom的精度换算，18位精度的数量可能超过uint64
+	toAmount := func(amount *big.Int) string {
+		return convertToDenomAmount(amount, decimals)
+	}
+	fromAmount := func(amountStr string) *big.Int {
+		return convertFromDenomAmount(amountStr, decimals)
+	}
+
 	addressesBalanceList := make([]AddrBalance, 0, len(addresses))
 
 	for i, addr := range addresses {
-		balance, err := decoder.wm.RestClient.getBalance(addr.Address, decoder.wm.Config.Denom)
+		balance, err := decoder.wm.RestClient.getBalance(addr.Address, denom)
 
 		if err != nil {
 			return err
 		}
+		balance.feeBalance = balance.Balance
+		if isToken {
+			mainBalance, err := decoder.wm.RestClient.getBalance(addr.Address, decoder.wm.Config.Denom)
+			if err != nil {
+				return err
+			}
+			balance.feeBalance = mainBalance.Balance
+		}
 		balance.PublicKey = addr.PublicKey
 		balance.index = i
 		addressesBalanceList = append(addressesBalanceList, *balance)
@@ -129,7 +225,14 @@ func (decoder *TransactionDecoder) CreateATOMRawTransaction(wrapper openwallet.W
 
 	fee := uint64(0)
 	gas := decoder.wm.Config.StdGas
-	if len(rawTx.FeeRate) > 0 {
+	gasPrice := decoder.getGasPrice()
+	payFee := decoder.wm.Config.PayFee
+	if len(rawTx.FeeRate) > 0 && decoder.wm.Config.IsSimulate {
+		//模拟交易时，FeeRate为每单位gas的价格，先按固定手续费选择发送地址
+		gasPrice = convertGasPriceFromAmount(rawTx.FeeRate)
+		payFee = true
+		fee = decoder.wm.Config.MinFee
+	} else if len(rawTx.FeeRate) > 0 {
 		fee = convertFromAmount(rawTx.FeeRate)
 	} else {
 		if decoder.wm.Config.PayFee {
@@ -146,32 +249,174 @@ func (decoder *TransactionDecoder) CreateATOMRawTransaction(wrapper openwallet.W
 	}
 	// keySignList := make([]*openwallet.KeySignature, 1, 1)
 
-	amount := big.NewInt(int64(convertFromAmount(amountStr)))
-	amount = amount.Add(amount, big.NewInt(int64(fee)))
+	action := rawTx.GetExtParam().Get("action").String()
+
+	//多个接收地址时批量转账，gas和手续费按消息数量累加
+	outputs := make([]CosmosOutput, 0)
+	if len(rawTx.To) > 1 {
+		if action != "" && action != TxActionSend {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "action: %s does not support multiple receivers", action)
+		}
+		total := big.NewInt(0)
+		for k, v := range rawTx.To {
+			value := fromAmount(v)
+			if value.Sign() <= 0 {
+				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s of receiver: %s", v, k)
+			}
+			outputs = append(outputs, CosmosOutput{To: k, Amount: value})
+			total.Add(total, value)
+		}
+		sort.Slice(outputs, func(i, j int) bool {
+			return outputs[i].To < outputs[j].To
+		})
+		to = ""
+		amountStr = toAmount(total)
+		gas = gas * uint64(len(outputs))
+		if len(rawTx.FeeRate) == 0 && decoder.wm.Config.PayFee {
+			fee = decoder.wm.Config.MinFee * uint64(len(outputs))
+		}
+	}
+	signMode := rawTx.GetExtParam().Get("sign_mode").String()
+	if signMode == "" {
+		signMode = decoder.wm.Config.SignMode
+	}
+	feeGranter, feePayer := decoder.getFeeDelegation(rawTx.GetExtParam())
+	authzGranter := rawTx.GetExtParam().Get("authz_granter").String()
+	if !isValidSignMode(signMode) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "unsupported sign mode: %s", signMode)
+	}
+	validator := rawTx.GetExtParam().Get("validator").String()
+	dstValidator := rawTx.GetExtParam().Get("dst_validator").String()
+	if isToken && action != "" && action != TxActionSend && action != TxActionIBC {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "action: %s does not support denom: %s", action, denom)
+	}
+	switch action {
+	case "", TxActionSend:
+	case TxActionDelegate, TxActionUndelegate, TxActionRedelegate:
+		//质押交易的目标为验证人，未指定时使用To的地址
+		if validator == "" {
+			validator = to
+		}
+		if validator == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "validator address is empty")
+		}
+		if action == TxActionRedelegate && dstValidator == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "destination validator address is empty")
+		}
+		to = validator
+	case TxActionWithdraw:
+		//领取收益必须指定委托人地址，代为执行时委托人为授权方
+		if rawTx.GetExtParam().Get("from").String() == "" && authzGranter == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "delegator address is empty")
+		}
+		amountStr = "0"
+	case TxActionVote:
+		//投票必须指定投票人地址，代为执行时投票人为授权方
+		if rawTx.GetExtParam().Get("from").String() == "" && authzGranter == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "voter address is empty")
+		}
+		if rawTx.GetExtParam().Get("proposal_id").Uint() == 0 {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "proposal id is empty")
+		}
+		if rawTx.GetExtParam().Get("option").String() == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote option is empty")
+		}
+		amountStr = "0"
+	case TxActionIBC:
+		if rawTx.GetExtParam().Get("source_channel").String() == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "ibc source channel is empty")
+		}
+	case TxActionGrantFee, TxActionRevokeFee:
+		//授权和撤销授权的对象为To的地址，授权额度取自To中的数量
+		if to == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "grantee address is empty")
+		}
+		if action == TxActionRevokeFee {
+			amountStr = "0"
+		}
+	case TxActionGrantAuthz, TxActionRevokeAuthz:
+		//授权和撤销授权的对象为To的地址，send授权的额度取自To中的数量
+		if to == "" {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "grantee address is empty")
+		}
+		if action == TxActionRevokeAuthz || rawTx.GetExtParam().Get("authorization").String() == AuthzTypeGeneric {
+			amountStr = "0"
+		}
+	default:
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "unsupported transaction action: %s", action)
+	}
+
+	amount := fromAmount(amountStr)
+	if action == TxActionUndelegate || action == TxActionRedelegate || action == TxActionWithdraw || action == TxActionVote ||
+		action == TxActionGrantFee || action == TxActionRevokeFee || action == TxActionGrantAuthz || action == TxActionRevokeAuthz {
+		//解除质押、转质押、领取收益、投票、手续费授权和授权不消耗可用余额，只需支付手续费
+		amount = big.NewInt(0)
+	}
+	if authzGranter != "" {
+		//代为执行时从授权方扣除数量，被授权方只需支付手续费
+		err = decoder.checkGranterBalance(authzGranter, denom, amount)
+		if err != nil {
+			return err
+		}
+		amount = big.NewInt(0)
+	}
+	//手续费由授权方或支付方支付时，发送地址不需要预留手续费
+	delegated := len(feeGranter) > 0 || len(feePayer) > 0
+	if !delegated && !isToken {
+		amount = amount.Add(amount, big.NewInt(int64(fee)))
+	}
 	from := ""
 	fromPub := ""
+	fromBalance := big.NewInt(0)
+	fromFeeBalance := big.NewInt(0)
+	feeShortage := ""
 	count := big.NewInt(0)
-	countList := []uint64{}
+	countList := []*big.Int{}
+	specifiedFrom := rawTx.GetExtParam().Get("from").String()
 	for _, a := range addressesBalanceList {
+		if specifiedFrom != "" {
+			//指定了发送地址，只检查该地址
+			if a.Address != specifiedFrom {
+				continue
+			}
+			if a.Balance.Cmp(amount) < 0 {
+				return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "the balance of address: %s is not enough", specifiedFrom)
+			}
+		}
 		if a.Balance.Cmp(amount) < 0 {
 			count.Add(count, a.Balance)
 			if count.Cmp(amount) >= 0 {
-				countList = append(countList, a.Balance.Sub(a.Balance, count.Sub(count, amount)).Uint64())
-				log.Error("The ATOM of the account is enough,"+
-					" but cannot be sent in just one transaction!\n"+
+				countList = append(countList, a.Balance.Sub(a.Balance, count.Sub(count, amount)))
+				return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "the ATOM of the account is enough,"+
+					" but cannot be sent in just one transaction, "+
 					"the amount can be sent in "+fmt.Sprint(len(countList))+
-					"times with amounts :\n"+strings.Replace(strings.Trim(fmt.Sprint(countList), "[]"), " ", ",", -1), err)
-				return err
+					" times with amounts: "+strings.Replace(strings.Trim(fmt.Sprint(countList), "[]"), " ", ",", -1)+
+					", use CreateSplitRawTransactionWithError instead")
 			} else {
-				countList = append(countList, a.Balance.Uint64())
+				countList = append(countList, a.Balance)
 			}
 			continue
 		}
+		if isToken && !delegated && a.feeBalance.Cmp(big.NewInt(int64(fee))) < 0 {
+			//代币余额足够，但主币余额不足以支付手续费
+			feeShortage = a.Address
+			continue
+		}
 		from = a.Address
 		fromPub = a.PublicKey
+		fromBalance = a.Balance
+		fromFeeBalance = a.feeBalance
 		break
 	}
 
+	if from == "" && feeShortage != "" {
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "the balance of address: %s is not enough to pay the fee: %s", feeShortage, convertToAmount(fee))
+	}
+
+	if specifiedFrom != "" && from == "" {
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "the address: %s is not in account", specifiedFrom)
+	}
+
 	if from == "" {
 		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough", amountStr)
 	}
@@ -180,169 +425,1181 @@ func (decoder *TransactionDecoder) CreateATOMRawTransaction(wrapper openwallet.W
 	rawTx.TxTo = []string{to}
 	rawTx.TxAmount = amountStr
 	rawTx.Fees = convertToAmount(fee)
-	rawTx.FeeRate = convertToAmount(fee)
+	if len(outputs) > 0 {
+		rawTx.TxTo = make([]string, 0, len(outputs))
+		for _, o := range outputs {
+			rawTx.TxTo = append(rawTx.TxTo, o.To+":"+toAmount(o.Amount))
+		}
+	}
 
-	denom := decoder.wm.Config.Denom
 	chainID := decoder.wm.Config.ChainID
-	var sequence uint64
+	memo := rawTx.GetExtParam().Get("memo").String()
+
+	var validators []string
+	commissionValidator := rawTx.GetExtParam().Get("commission_validator").String()
+	//领取收益和投票的委托人，代为执行时为授权方
+	delegator := from
+	if authzGranter != "" {
+		delegator = authzGranter
+	}
+	if action == TxActionWithdraw {
+		validators = getExtParamList(rawTx.GetExtParam().Get("validators"))
+		if len(validators) == 0 {
+			//未指定验证人时，领取所有委托的收益
+			validators, err = decoder.wm.RestClient.getDelegatorValidators(delegator)
+			if err != nil {
+				return err
+			}
+		}
+		msgCount := len(validators)
+		if commissionValidator != "" {
+			if _, err := getCommissionValidator(delegator, commissionValidator); err != nil {
+				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid commission_validator: %v", err)
+			}
+			msgCount++
+		}
+		if msgCount == 0 {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "address: %s has no rewards to withdraw", delegator)
+		}
+		gas = gas * uint64(msgCount)
+		to = delegator
+		rawTx.TxTo = []string{delegator}
+	}
+	if action == TxActionVote {
+		to = delegator
+		rawTx.TxTo = []string{delegator}
+	}
+
+	var (
+		sourcePort       string
+		sourceChannel    string
+		timeoutHeight    string
+		timeoutTimestamp uint64
+	)
+	if action == TxActionIBC {
+		sourcePort = rawTx.GetExtParam().Get("source_port").String()
+		if sourcePort == "" {
+			sourcePort = "transfer"
+		}
+		sourceChannel = rawTx.GetExtParam().Get("source_channel").String()
+		timeoutHeight = rawTx.GetExtParam().Get("timeout_height").String()
+		timeoutSeconds := rawTx.GetExtParam().Get("timeout_seconds").Int()
+		if timeoutSeconds > 0 {
+			timeoutTimestamp = uint64(time.Now().Add(time.Duration(timeoutSeconds) * time.Second).UnixNano())
+		} else if timeoutHeight == "" {
+			timeoutTimestamp = uint64(time.Now().Add(defaultIBCTimeout).UnixNano())
+		}
+	}
+
+	timeout, err := decoder.getTimeoutHeight(rawTx.GetExtParam())
+	if err != nil {
+		return err
+	}
+
+	cosmosTx := CosmosTx{
+		From:                from,
+		To:                  to,
+		Denom:               denom,
+		FeeDenom:            decoder.wm.Config.Denom,
+		Memo:                memo,
+		ChainID:             chainID,
+		PublicKey:           fromPub,
+		Amount:              fromAmount(amountStr),
+		Fee:                 int64(fee),
+		GasLimit:            gas,
+		Timeout:             timeout,
+		Action:              action,
+		Validator:           validator,
+		DstValidator:        dstValidator,
+		Validators:          validators,
+		CommissionValidator: commissionValidator,
+		ProposalID:          rawTx.GetExtParam().Get("proposal_id").Uint(),
+		VoteOption:          rawTx.GetExtParam().Get("option").String(),
+		SourcePort:          sourcePort,
+		SourceChannel:       sourceChannel,
+		TimeoutHeight:       timeoutHeight,
+		TimeoutTimestamp:    timeoutTimestamp,
+		Outputs:             outputs,
+		MultiSend:           rawTx.GetExtParam().Get("batch_mode").String() == "multisend",
+		SignMode:            signMode,
+		AuthzGranter:        authzGranter,
+	}
+
+	if action == TxActionGrantFee {
+		err = decoder.setFeeAllowance(&cosmosTx, rawTx.GetExtParam())
+		if err != nil {
+			return err
+		}
+	}
+	if action == TxActionGrantAuthz || action == TxActionRevokeAuthz {
+		err = decoder.setAuthorization(&cosmosTx, rawTx.GetExtParam())
+		if err != nil {
+			return err
+		}
+	}
+
+	addr, err := wrapper.GetAddress(from)
+	if err != nil {
+		return err
+	}
+
+	payerAddr, err := decoder.setFeeDelegation(wrapper, &cosmosTx, feeGranter, feePayer)
+	if err != nil {
+		return err
+	}
+
+	//多签账户的成员公钥由各拥有者的账户公钥按地址路径派生
+	if len(rawTx.Account.OwnerKeys) > 1 {
+		pubs, err := getMultisigPublicKeys(rawTx.Account, addr)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "derive multisig public keys failed, unexpected error: %v", err)
+		}
+		cosmosTx.MultisigPubKeys = pubs
+		cosmosTx.Threshold = uint32(rawTx.Account.Required)
+		rawTx.Required = rawTx.Account.Required
+	}
+
+	//预留发送地址和手续费支付方的序号，交易单创建失败时释放，模拟交易也需要正确的序号
+	err = decoder.reserveSequences(wrapper, &cosmosTx)
+	if err != nil {
+		return err
+	}
+
+	//模拟交易估算gas，并按gas价格重新计算手续费，模拟失败时使用配置的固定值
+	if decoder.wm.Config.IsSimulate {
+		simulatedGas, err := decoder.simulateGas(cosmosTx)
+		if err != nil {
+			log.Warningf("simulate transaction failed, use the static gas and fee instead, unexpected error: %v", err)
+		} else {
+			cosmosTx.GasLimit = simulatedGas
+			if payFee {
+				simulatedFee := calculateFee(simulatedGas, gasPrice)
+				required := new(big.Int).Sub(amount, big.NewInt(int64(fee)))
+				required.Add(required, big.NewInt(int64(simulatedFee)))
+				balance := fromBalance
+				if isToken {
+					required = big.NewInt(int64(simulatedFee))
+					balance = fromFeeBalance
+				}
+				if !delegated && balance.Cmp(required) < 0 {
+					decoder.releaseSequences(&cosmosTx)
+					return openwallet.Errorf(openwallet.ErrInsufficientFees, "the balance of address: %s is not enough to pay the fee: %s", from, convertToAmount(simulatedFee))
+				}
+				fee = simulatedFee
+				cosmosTx.Fee = int64(fee)
+				rawTx.Fees = convertToAmount(fee)
+			}
+		}
+	}
+
+	emptyTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		decoder.releaseSequences(&cosmosTx)
+		return err
+	}
+	rawTx.RawHex = emptyTrans
+
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+
+	keySigs := make([]*openwallet.KeySignature, 0)
+
+	if cosmosTx.isMultisig() {
+		//多签交易每个成员一个待签名，成员签名后合并
+		for _, pub := range cosmosTx.MultisigPubKeys {
+			memberAddr := *addr
+			memberAddr.PublicKey = pub
+			keySigs = append(keySigs, &openwallet.KeySignature{
+				EccType: decoder.wm.Config.CurveType,
+				Nonce:   "",
+				Address: &memberAddr,
+				Message: hash,
+			})
+		}
+	} else {
+		signature := openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: addr,
+			Message: hash,
+		}
+
+		keySigs = append(keySigs, &signature)
+	}
+
+	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+
+	err = decoder.addFeePayerSignature(rawTx, &cosmosTx, payerAddr)
+	if err != nil {
+		decoder.releaseSequences(&cosmosTx)
+		return err
+	}
+
+	//FeeRate只表示费率，手续费总额为Fees
+	rawTx.FeeRate = decoder.getFeeRate(fee, gasPrice)
+
+	rawTx.IsBuilt = true
+
+	return nil
+}
+
+//splitPart 拆分转账中一个发送地址转出的数量和预留的手续费
+type splitPart struct {
+	from   string
+	amount *big.Int
+	fee    *big.Int
+}
+
+//planSplitParts 按余额从多到少分配转账数量，每个地址预留该笔交易的手续费，返回分配结果和未能分配的数量。
+//feeFunc返回地址转出指定数量时的手续费，先按余额估算，再按扣除手续费后的数量重新估算，取较大的值
+func planSplitParts(balances []AddrBalance, total *big.Int, feeFunc func(from string, amount *big.Int) *big.Int) ([]splitPart, *big.Int) {
+	minInt := func(a, b *big.Int) *big.Int {
+		if a.Cmp(b) < 0 {
+			return new(big.Int).Set(a)
+		}
+		return new(big.Int).Set(b)
+	}
+
+	remaining := new(big.Int).Set(total)
+	parts := make([]splitPart, 0)
+	for _, a := range balances {
+		if remaining.Sign() <= 0 {
+			break
+		}
+		fee := feeFunc(a.Address, minInt(remaining, a.Balance))
+		amount := minInt(remaining, new(big.Int).Sub(a.Balance, fee))
+		if amount.Sign() <= 0 {
+			continue
+		}
+		if actual := feeFunc(a.Address, amount); actual.Cmp(fee) > 0 {
+			fee = actual
+			amount = minInt(remaining, new(big.Int).Sub(a.Balance, fee))
+			if amount.Sign() <= 0 {
+				continue
+			}
+		}
+		parts = append(parts, splitPart{from: a.Address, amount: amount, fee: fee})
+		remaining.Sub(remaining, amount)
+	}
+	return parts, remaining
+}
+
+//estimateSplitFee 估算拆分转账中一笔交易的手续费，与CreateATOMRawTransaction的计算方式相同。
+//模拟交易时取模拟结果和固定手续费中较大的，使创建交易单时的余额检查和模拟后的手续费检查都能通过，模拟失败时使用固定手续费
+func (decoder *TransactionDecoder) estimateSplitFee(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, addr *openwallet.Address, to string, amount *big.Int) uint64 {
+	if feeGranter, feePayer := decoder.getFeeDelegation(rawTx.GetExtParam()); len(feeGranter) > 0 || len(feePayer) > 0 {
+		//手续费由授权方或支付方支付
+		return 0
+	}
+	if len(rawTx.FeeRate) > 0 && !decoder.wm.Config.IsSimulate {
+		return convertFromAmount(rawTx.FeeRate)
+	}
+	if len(rawTx.FeeRate) == 0 && !decoder.wm.Config.PayFee {
+		return 0
+	}
+	fee := decoder.wm.Config.MinFee
+	if !decoder.wm.Config.IsSimulate || addr == nil {
+		return fee
+	}
+
+	gasPrice := decoder.getGasPrice()
+	if len(rawTx.FeeRate) > 0 {
+		gasPrice = convertGasPriceFromAmount(rawTx.FeeRate)
+	}
+	signMode := rawTx.GetExtParam().Get("sign_mode").String()
+	if signMode == "" {
+		signMode = decoder.wm.Config.SignMode
+	}
+	timeout, err := decoder.getTimeoutHeight(rawTx.GetExtParam())
+	if err != nil {
+		log.Warningf("estimate fee of address: %s failed, use the static fee instead, unexpected error: %v", addr.Address, err)
+		return fee
+	}
+	cosmosTx := CosmosTx{
+		From:      addr.Address,
+		To:        to,
+		Denom:     decoder.wm.Config.Denom,
+		FeeDenom:  decoder.wm.Config.Denom,
+		Memo:      rawTx.GetExtParam().Get("memo").String(),
+		ChainID:   decoder.wm.Config.ChainID,
+		PublicKey: addr.PublicKey,
+		Amount:    amount,
+		Fee:       int64(fee),
+		GasLimit:  decoder.wm.Config.StdGas,
+		Timeout:   timeout,
+		SignMode:  signMode,
+	}
+	if len(rawTx.Account.OwnerKeys) > 1 {
+		pubs, err := getMultisigPublicKeys(rawTx.Account, addr)
+		if err != nil {
+			log.Warningf("estimate fee of address: %s failed, use the static fee instead, unexpected error: %v", addr.Address, err)
+			return fee
+		}
+		cosmosTx.MultisigPubKeys = pubs
+		cosmosTx.Threshold = uint32(rawTx.Account.Required)
+	}
+
+	//模拟交易需要正确的序号，估算后释放，创建交易单时重新预留
+	cosmosTx.AccNum, cosmosTx.AccSeq, err = decoder.reserveSequence(wrapper, addr.Address)
+	if err != nil {
+		log.Warningf("estimate fee of address: %s failed, use the static fee instead, unexpected error: %v", addr.Address, err)
+		return fee
+	}
+	defer decoder.wm.SequenceManager.Release(addr.Address, cosmosTx.AccSeq)
+
+	simulatedGas, err := decoder.simulateGas(cosmosTx)
+	if err != nil {
+		log.Warningf("simulate transaction of address: %s failed, use the static fee instead, unexpected error: %v", addr.Address, err)
+		return fee
+	}
+	if simulatedFee := calculateFee(simulatedGas, gasPrice); simulatedFee > fee {
+		return simulatedFee
+	}
+	return fee
+}
+
+//CreateSplitRawTransactionWithError 没有单个地址的余额足够支付时，从多个地址分别创建交易单，合计数量等于转账数量
+func (decoder *TransactionDecoder) CreateSplitRawTransactionWithError(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
+	action := rawTx.GetExtParam().Get("action").String()
+	if action != "" && action != TxActionSend {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "action: %s does not support split sending", action)
+	}
+
+	if rawTx.Coin.IsContract && !decoder.wm.isMainDenom(rawTx.Coin.Contract.Address) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "denom: %s does not support split sending", rawTx.Coin.Contract.Address)
+	}
+
+	if len(rawTx.To) != 1 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "split sending only supports one receiver")
+	}
+
+	var amountStr, to string
+	for k, v := range rawTx.To {
+		to = k
+		amountStr = v
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", rawTx.Account.AccountID)
+	}
+
+	addressesBalanceList := make([]AddrBalance, 0, len(addresses))
+	for _, addr := range addresses {
+		balance, err := decoder.wm.RestClient.getBalance(addr.Address, decoder.wm.Config.Denom)
+		if err != nil {
+			return nil, err
+		}
+		addressesBalanceList = append(addressesBalanceList, *balance)
+	}
+
+	sort.Slice(addressesBalanceList, func(i int, j int) bool {
+		return addressesBalanceList[i].Balance.Cmp(addressesBalanceList[j].Balance) >= 0
+	})
+
+	remaining := big.NewInt(int64(convertFromAmount(amountStr)))
+	if remaining.Sign() <= 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s", amountStr)
+	}
+
+	//每笔交易都需要支付手续费，优先使用余额多的地址，减少交易笔数
+	addressMap := make(map[string]*openwallet.Address, len(addresses))
+	for _, addr := range addresses {
+		addressMap[addr.Address] = addr
+	}
+	feeFunc := func(from string, amount *big.Int) *big.Int {
+		return big.NewInt(int64(decoder.estimateSplitFee(wrapper, rawTx, addressMap[from], to, amount)))
+	}
+	parts, remaining := planSplitParts(addressesBalanceList, remaining, feeFunc)
+
+	if remaining.Sign() > 0 {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough", amountStr)
+	}
+
+	rawTxWithErr := make([]*openwallet.RawTransactionWithError, 0, len(parts))
+	for _, part := range parts {
+		//每个发送地址创建一笔交易单，通过from指定发送地址，序号由各自地址获取
+		partRawTx := &openwallet.RawTransaction{
+			Coin:     rawTx.Coin,
+			Account:  rawTx.Account,
+			To:       map[string]string{to: convertToAmount(part.amount.Uint64())},
+			FeeRate:  rawTx.FeeRate,
+			ExtParam: rawTx.ExtParam,
+			Required: 1,
+		}
+		partRawTx.SetExtParam("from", part.from)
+
+		createErr := decoder.CreateATOMRawTransaction(wrapper, partRawTx)
+		rawTxWithErr = append(rawTxWithErr, &openwallet.RawTransactionWithError{
+			RawTx: partRawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+	}
+
+	return rawTxWithErr, nil
+}
+
+func (decoder *TransactionDecoder) SignATOMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	key, err := wrapper.HDKey()
+	if err != nil {
+		return nil
+	}
+
+	//多签成员和手续费支付方的待签名可能来自多个账户，只签名属于当前钱包的部分
+	for accountID, keySignatures := range rawTx.Signatures {
+		for _, keySignature := range keySignatures {
+			if keySignature.Address == nil {
+				continue
+			}
+
+			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
+			if err != nil {
+				return err
+			}
+			if !decoder.isSigningKey(rawTx, accountID, keySignature.Address, childKey.GetPublicKeyBytes()) {
+				continue
+			}
+			keyBytes, err := childKey.GetPrivateKeyBytes()
+			if err != nil {
+				return err
+			}
+
+			//签名交易
+			/////////交易单哈希签名
+			sig, err := signTransactionHash(keySignature.Message, keyBytes)
+			if err != nil {
+				return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
+			} else {
+
+				//for i, s := range sigPub {
+				//	log.Info("第", i+1, "个签名结果")
+				//	log.Info()
+				//	log.Info("对应的公钥为")
+				//	log.Info(hex.EncodeToString(s.Pubkey))
+				//}
+
+				// txHash.Normal.SigPub = *sigPub
+			}
+
+			keySignature.Signature = sig
+		}
+	}
+
+	log.Info("transaction hash sign success")
+
+	return nil
+}
+
+//isSigningKey 待签名是否属于当前钱包派生的密钥：指定了公钥时按公钥匹配，
+//否则属于交易单的账户，或地址与派生的公钥一致
+func (decoder *TransactionDecoder) isSigningKey(rawTx *openwallet.RawTransaction, accountID string, addr *openwallet.Address, pub []byte) bool {
+	if len(addr.PublicKey) > 0 {
+		return addr.PublicKey == hex.EncodeToString(pub)
+	}
+	if rawTx.Account != nil && accountID == rawTx.Account.AccountID {
+		return true
+	}
+	if len(addr.Address) == 0 {
+		return false
+	}
+	address, err := decoder.wm.Decoder.PublicKeyToAddress(pub, false)
+	return err == nil && address == addr.Address
+}
+
+// 验证交易单签名失败的错误码，细分openwallet.ErrVerifyRawTransactionFailed
+const (
+	ErrVerifySignBytesMismatch = 200701 //待签名数据与交易单不一致
+	ErrVerifyPublicKeyMismatch = 200702 //公钥无效或与签名地址不一致
+	ErrVerifySignatureInvalid  = 200703 //签名无效
+)
+
+//getVerifyErrorCode 签名校验失败的错误码，未细分的错误为ErrVerifyRawTransactionFailed
+func getVerifyErrorCode(err error) uint64 {
+	if e, ok := err.(*signatureError); ok {
+		return e.code
+	}
+	return openwallet.ErrVerifyRawTransactionFailed
+}
+
+func (decoder *TransactionDecoder) VerifyATOMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		emptyTrans = rawTx.RawHex
+
+		signature         = ""
+		feePayerSignature = ""
+	)
+
+	cosmosTx, err := decodeUnsignedTx(emptyTrans)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction decode failed, unexpected error: %v", err)
+	}
+
+	//按交易单重新生成待签名数据，校验每个签名
+	signBytes, err := cosmosTx.getSignBytes()
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction sign bytes create failed, unexpected error: %v", err)
+	}
+
+	//多签成员的签名可能来自多个账户，按成员公钥汇总
+	signatures := make(map[string]string)
+	for accountID, keySignatures := range rawTx.Signatures {
+		log.Debug("accountID Signatures:", accountID)
+		for _, keySignature := range keySignatures {
+
+			if len(keySignature.Signature) == 0 {
+				continue
+			}
+			if keySignature.Address == nil {
+				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "address of signature is empty")
+			}
+
+			log.Debug("Signature:", keySignature.Signature)
+			log.Debug("PublicKey:", keySignature.Address.PublicKey)
+
+			//手续费支付方按自己的账户编号和序号签名
+			if cosmosTx.hasFeePayer() && keySignature.Address.Address == cosmosTx.FeePayer {
+				payerSignBytes, err := cosmosTx.getFeePayerSignBytes()
+				if err == nil {
+					err = cosmosTx.verifyFeePayerSignature(payerSignBytes, keySignature.Message, keySignature.Address.PublicKey, keySignature.Signature)
+				}
+				if err != nil {
+					rawTx.IsCompleted = false
+					return openwallet.Errorf(getVerifyErrorCode(err), "transaction verify failed, fee payer: %s, %v", keySignature.Address.Address, err)
+				}
+				feePayerSignature = keySignature.Signature
+				continue
+			}
+
+			err = cosmosTx.verifySignature(signBytes, keySignature.Message, keySignature.Address.PublicKey, keySignature.Signature)
+			if err != nil {
+				log.Debug("transaction verify failed")
+				rawTx.IsCompleted = false
+				return openwallet.Errorf(getVerifyErrorCode(err), "transaction verify failed, address: %s, %v", keySignature.Address.Address, err)
+			}
+			signature = keySignature.Signature
+			signatures[keySignature.Address.PublicKey] = keySignature.Signature
+		}
+	}
+
+	if cosmosTx.isMultisig() {
+		count := uint32(0)
+		for _, pub := range cosmosTx.MultisigPubKeys {
+			if _, ok := signatures[pub]; ok {
+				count++
+			}
+		}
+		if count < cosmosTx.Threshold {
+			//签名数量未达到必要签名数，等待其他成员签名
+			log.Debugf("multisig transaction has %d of %d required signatures", count, cosmosTx.Threshold)
+			rawTx.IsCompleted = false
+			return nil
+		}
+		signedTrans, txid, err := getMultisigBroadcastBytes(emptyTrans, signatures)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction compose signatures failed, unexpected error: %v", err)
+		}
+		log.Debug("transaction verify passed")
+		rawTx.IsCompleted = true
+		rawTx.RawHex = signedTrans
+		rawTx.TxID = txid
+		return nil
+	}
+
+	if len(signature) == 0 {
+		rawTx.IsCompleted = false
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "signature of address: %s is empty", cosmosTx.From)
+	}
+	if cosmosTx.hasFeePayer() && len(feePayerSignature) == 0 {
+		rawTx.IsCompleted = false
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "signature of fee payer: %s is empty", cosmosTx.FeePayer)
+	}
+
+	signedTrans, txid, err := getFeePayerBroadcastBytes(emptyTrans, signature, feePayerSignature)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction compose signatures failed, unexpected error: %v", err)
+	}
+
+	log.Debug("transaction verify passed")
+	rawTx.IsCompleted = true
+	rawTx.RawHex = signedTrans
+	rawTx.TxID = txid
+
+	return nil
+}
+
+func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
+	if !decoder.wm.Config.PayFee {
+		return convertToAmount(0), "TX", nil
+	}
+	if decoder.wm.Config.IsSimulate {
+		return convertGasPriceToAmount(decoder.getGasPrice()), "gas", nil
+	}
+	return convertToAmount(decoder.wm.Config.MinFee), "TX", nil
+}
+
+//getGasPrice 获取每单位gas的价格（最小单位），未配置时按minFee和stdGas折算
+func (decoder *TransactionDecoder) getGasPrice() decimal.Decimal {
+	if decoder.wm.Config.GasPrice.GreaterThan(decimal.Zero) {
+		return decoder.wm.Config.GasPrice
+	}
+	if decoder.wm.Config.StdGas == 0 {
+		return decimal.Zero
+	}
+	return decimal.NewFromInt(int64(decoder.wm.Config.MinFee)).Div(decimal.NewFromInt(int64(decoder.wm.Config.StdGas)))
+}
+
+//simulateGas 通过节点模拟交易，返回乘以调整系数后的gas
+func (decoder *TransactionDecoder) simulateGas(cosmosTx CosmosTx) (uint64, error) {
+	txBytes, err := cosmosTx.getSimulateTxBytes()
+	if err != nil {
+		return 0, err
+	}
+	gasUsed, err := decoder.wm.RestClient.simulateTransaction(txBytes)
+	if err != nil {
+		return 0, err
+	}
+	adjustment := decoder.wm.Config.GasAdjustment
+	if adjustment.LessThanOrEqual(decimal.Zero) {
+		adjustment = decimal.NewFromInt(1)
+	}
+	return uint64(decimal.NewFromInt(int64(gasUsed)).Mul(adjustment).Ceil().IntPart()), nil
+}
+
+//getFeeRate 交易单的费率，开启模拟交易时为每单位gas的价格（模拟失败也是），否则为固定的手续费，与GetRawTransactionFeeRate一致
+func (decoder *TransactionDecoder) getFeeRate(fee uint64, gasPrice decimal.Decimal) string {
+	if decoder.wm.Config.IsSimulate {
+		return convertGasPriceToAmount(gasPrice)
+	}
+	return convertToAmount(fee)
+}
+
+//calculateFee 按gas价格计算手续费，不足最小单位的部分向上取整
+func calculateFee(gas uint64, gasPrice decimal.Decimal) uint64 {
+	return uint64(decimal.NewFromInt(int64(gas)).Mul(gasPrice).Ceil().IntPart())
+}
+
+//convertGasPriceToAmount gas价格从最小单位转为主币单位
+func convertGasPriceToAmount(gasPrice decimal.Decimal) string {
+	return gasPrice.Div(decimal.NewFromInt(1000000)).String()
+}
+
+//convertGasPriceFromAmount gas价格从主币单位转为最小单位
+func convertGasPriceFromAmount(gasPrice string) decimal.Decimal {
+	d, _ := decimal.NewFromString(gasPrice)
+	return d.Mul(decimal.NewFromInt(1000000))
+}
+
+//reserveSequence 通过序号管理器预留发送地址的序号，本地数据库记录已广播的下一个序号
+func (decoder *TransactionDecoder) reserveSequence(wrapper openwallet.WalletDAI, from string) (uint64, uint64, error) {
+	var local uint64
 	sequence_db, err := wrapper.GetAddressExtParam(from, decoder.wm.FullName())
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
-	if sequence_db == nil {
-		sequence = 0
-	} else {
-		sequence = ow.NewString(sequence_db).UInt64()
+	if sequence_db != nil {
+		local = ow.NewString(sequence_db).UInt64()
 	}
-	accountNumber, sequenceChain, err := decoder.wm.RestClient.getAccountNumberAndSequence(from)
+	return decoder.wm.SequenceManager.Reserve(from, local)
+}
+
+//reserveSequences 预留发送地址和手续费支付方的序号
+func (decoder *TransactionDecoder) reserveSequences(wrapper openwallet.WalletDAI, cosmosTx *CosmosTx) error {
+	var err error
+	cosmosTx.AccNum, cosmosTx.AccSeq, err = decoder.reserveSequence(wrapper, cosmosTx.From)
 	if err != nil {
 		return err
 	}
-	if sequenceChain > int(sequence) {
-		sequence = uint64(sequenceChain)
+	if cosmosTx.hasFeePayer() {
+		cosmosTx.FeePayerAccNum, cosmosTx.FeePayerAccSeq, err = decoder.reserveSequence(wrapper, cosmosTx.FeePayer)
+		if err != nil {
+			decoder.wm.SequenceManager.Release(cosmosTx.From, cosmosTx.AccSeq)
+			return err
+		}
 	}
-	memo := rawTx.GetExtParam().Get("memo").String()
+	return nil
+}
 
-	cosmosTx := CosmosTx{
-		From:      from,
-		To:        to,
-		Denom:     denom,
-		FeeDenom:  denom,
-		Memo:      memo,
-		ChainID:   chainID,
-		PublicKey: fromPub,
-		Amount:    int64(convertFromAmount(amountStr)),
-		Fee:       int64(fee),
-		AccNum:    uint64(accountNumber),
-		AccSeq:    uint64(sequence),
-		GasLimit:  gas,
-		Timeout:   0,
+//releaseSequences 交易单创建失败时释放发送地址和手续费支付方的序号
+func (decoder *TransactionDecoder) releaseSequences(cosmosTx *CosmosTx) {
+	decoder.wm.SequenceManager.Release(cosmosTx.From, cosmosTx.AccSeq)
+	if cosmosTx.hasFeePayer() {
+		decoder.wm.SequenceManager.Release(cosmosTx.FeePayer, cosmosTx.FeePayerAccSeq)
 	}
+}
 
-	emptyTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
-	if err != nil {
-		return err
+//getFeeDelegation 获取手续费授权方和支付方，扩展参数fee_granter和fee_payer优先于配置
+func (decoder *TransactionDecoder) getFeeDelegation(ext gjson.Result) (string, string) {
+	feeGranter := decoder.wm.Config.FeeGranter
+	if granter := ext.Get("fee_granter"); granter.Exists() {
+		feeGranter = granter.String()
 	}
-	rawTx.RawHex = emptyTrans
-
-	if rawTx.Signatures == nil {
-		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	feePayer := decoder.wm.Config.FeePayer
+	if payer := ext.Get("fee_payer"); payer.Exists() {
+		feePayer = payer.String()
 	}
+	return feeGranter, feePayer
+}
 
-	keySigs := make([]*openwallet.KeySignature, 0)
+//setFeeDelegation 设置交易的手续费授权方和支付方，支付方必须是钱包内的地址，返回支付方的地址信息
+func (decoder *TransactionDecoder) setFeeDelegation(wrapper openwallet.WalletDAI, cosmosTx *CosmosTx, feeGranter, feePayer string) (*openwallet.Address, error) {
+	cosmosTx.FeeGranter = feeGranter
+	cosmosTx.FeePayer = feePayer
+	if !cosmosTx.hasFeePayer() {
+		cosmosTx.FeePayer = ""
+		return nil, nil
+	}
+	payerAddr, err := wrapper.GetAddress(feePayer)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "fee payer: %s is not an address of the wallet", feePayer)
+	}
+	cosmosTx.FeePayerPublicKey = payerAddr.PublicKey
+	return payerAddr, nil
+}
 
-	addr, err := wrapper.GetAddress(from)
+//addFeePayerSignature 为手续费支付方添加待签名，支付方可能属于其他账户
+func (decoder *TransactionDecoder) addFeePayerSignature(rawTx *openwallet.RawTransaction, cosmosTx *CosmosTx, payerAddr *openwallet.Address) error {
+	if payerAddr == nil {
+		return nil
+	}
+	hash, err := cosmosTx.getFeePayerHash()
 	if err != nil {
 		return err
 	}
-	signature := openwallet.KeySignature{
+	rawTx.Signatures[payerAddr.AccountID] = append(rawTx.Signatures[payerAddr.AccountID], &openwallet.KeySignature{
 		EccType: decoder.wm.Config.CurveType,
 		Nonce:   "",
-		Address: addr,
+		Address: payerAddr,
 		Message: hash,
-	}
-
-	keySigs = append(keySigs, &signature)
-
-	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	})
+	return nil
+}
 
-	rawTx.FeeRate = big.NewInt(int64(fee)).String()
+//setFeeAllowance 从扩展参数设置手续费授权的过期时间和周期
+func (decoder *TransactionDecoder) setFeeAllowance(cosmosTx *CosmosTx, ext gjson.Result) error {
+	cosmosTx.AllowanceExpiration = ext.Get("expiration").Int()
+	cosmosTx.AllowancePeriod = ext.Get("period").Int()
+	if cosmosTx.AllowancePeriod > 0 {
+		periodLimit := ext.Get("period_spend_limit").String()
+		if convertFromAmount(periodLimit) == 0 {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "period spend limit is empty")
+		}
+		cosmosTx.AllowancePeriodLimit = int64(convertFromAmount(periodLimit))
+		cosmosTx.AllowancePeriodReset = time.Now().Unix() + cosmosTx.AllowancePeriod
+	}
+	_, err := cosmosTx.getFeeAllowance()
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid fee allowance, unexpected error: %v", err)
+	}
+	return nil
+}
 
-	rawTx.IsBuilt = true
+//getTimeoutHeight 按扩展参数timeout_blocks或配置timeoutBlocks计算交易的超时高度，0为不超时
+func (decoder *TransactionDecoder) getTimeoutHeight(ext gjson.Result) (uint64, error) {
+	timeoutBlocks := decoder.wm.Config.TimeoutBlocks
+	if blocks := ext.Get("timeout_blocks"); blocks.Exists() {
+		timeoutBlocks = blocks.Uint()
+	}
+	if timeoutBlocks == 0 {
+		return 0, nil
+	}
+	height, err := decoder.wm.RestClient.getBlockHeight()
+	if err != nil {
+		return 0, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "get block height failed, unexpected error: %v", err)
+	}
+	return height + timeoutBlocks, nil
+}
 
+//setAuthorization 从扩展参数设置授权的类型、消息类型和过期时间，未指定过期时间时默认一年
+func (decoder *TransactionDecoder) setAuthorization(cosmosTx *CosmosTx, ext gjson.Result) error {
+	cosmosTx.AuthzType = ext.Get("authorization").String()
+	cosmosTx.AuthzMsgTypeURL = ext.Get("msg_type_url").String()
+	if cosmosTx.Action == TxActionRevokeAuthz {
+		//撤销授权只需要消息类型，send授权的消息类型为MsgSend，generic授权必须指定消息类型
+		if cosmosTx.AuthzMsgTypeURL == "" {
+			if cosmosTx.AuthzType == AuthzTypeGeneric {
+				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "msg_type_url is required to revoke generic authorization")
+			}
+			cosmosTx.AuthzMsgTypeURL = MsgSendTypeURL
+		}
+		return nil
+	}
+	cosmosTx.AuthzExpiration = ext.Get("expiration").Int()
+	if cosmosTx.AuthzExpiration == 0 {
+		cosmosTx.AuthzExpiration = time.Now().AddDate(1, 0, 0).Unix()
+	}
+	_, err := cosmosTx.getAuthorization()
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid authorization, unexpected error: %v", err)
+	}
 	return nil
 }
 
-func (decoder *TransactionDecoder) SignATOMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	key, err := wrapper.HDKey()
-	if err != nil {
+//checkGranterBalance 代为执行时检查授权方denom的余额是否足够
+func (decoder *TransactionDecoder) checkGranterBalance(granter, denom string, amount *big.Int) error {
+	if amount.Sign() == 0 {
 		return nil
 	}
+	balance, err := decoder.wm.RestClient.getBalance(granter, denom)
+	if err != nil {
+		return err
+	}
+	if balance.Balance.Cmp(amount) < 0 {
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "the balance of granter: %s is not enough", granter)
+	}
+	return nil
+}
 
-	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
+//isSequenceMismatch 节点是否报告序号不匹配
+func isSequenceMismatch(err error) bool {
+	if bErr := toBroadcastError(err); bErr != nil {
+		return bErr.IsSequenceMismatch()
+	}
+	return err != nil && strings.Contains(err.Error(), "account sequence mismatch")
+}
 
-	if keySignatures != nil {
-		for _, keySignature := range keySignatures {
+//broadcastTransaction 广播交易，节点报告序号不匹配且开启了重试时，按节点期望的序号重新签名后再次广播
+func (decoder *TransactionDecoder) broadcastTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, mode string) (string, error) {
+	retry := decoder.wm.Config.SequenceRetry
+	if sequenceRetry := rawTx.GetExtParam().Get("sequence_retry"); sequenceRetry.Exists() {
+		retry = int(sequenceRetry.Int())
+	}
 
-			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
-			keyBytes, err := childKey.GetPrivateKeyBytes()
-			if err != nil {
-				return err
-			}
+	for i := 0; ; i++ {
+		from, sequence, err := parseBroadcastSender(rawTx.RawHex)
+		if err != nil {
+			return "", err
+		}
 
-			//签名交易
-			/////////交易单哈希签名
-			sig, err := signTransactionHash(keySignature.Message, keyBytes)
-			if err != nil {
-				return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
-			} else {
+		txid, err := decoder.wm.BroadcastRawTransaction(rawTx.RawHex, mode)
+		if err != nil {
+			//节点已收到相同的交易，或交易已上链，视为广播成功，避免超时后重复广播
+			if knownTxID, ok := decoder.isKnownTransaction(rawTx.RawHex, err); ok {
+				decoder.wm.Log.Infof("transaction: %s is already known by node", knownTxID)
+				txid, err = knownTxID, nil
+			}
+		}
+		payer, payerSequence, hasPayer := parseBroadcastFeePayer(rawTx.RawHex)
+		if err == nil {
+			if len(txid) == 0 {
+				txid, _ = getBroadcastTxHash(rawTx.RawHex)
+			}
+			decoder.wm.SequenceManager.Commit(from, sequence)
+			wrapper.SetAddressExtParam(from, decoder.wm.FullName(), sequence+1)
+			//超时后重建的交易广播成功，使用相同序号的原交易不再记录
+			if replaceErr := decoder.wm.SequenceManager.Replace(wrapper, from, sequence, txid); replaceErr != nil {
+				decoder.wm.Log.Warningf("remove replaced transactions of address: %s failed, unexpected error: %v", from, replaceErr)
+			}
+			if hasPayer {
+				if replaceErr := decoder.wm.SequenceManager.Replace(wrapper, payer, payerSequence, txid); replaceErr != nil {
+					decoder.wm.Log.Warningf("remove replaced transactions of address: %s failed, unexpected error: %v", payer, replaceErr)
+				}
+			}
+			//记录有超时高度的交易，超时未上链时可用相同的序号重建
+			if timeoutHeight := parseBroadcastTimeoutHeight(rawTx.RawHex); timeoutHeight > 0 {
+				submitted := &SubmittedTx{
+					TxID:          txid,
+					Address:       from,
+					Sequence:      sequence,
+					TimeoutHeight: timeoutHeight,
+					AccountID:     rawTx.Account.AccountID,
+					RawHex:        rawTx.RawHex,
+					SubmitTime:    time.Now().Unix(),
+				}
+				if hasPayer {
+					submitted.FeePayer = payer
+					submitted.FeePayerSequence = payerSequence
+				}
+				if trackErr := decoder.wm.SequenceManager.Track(wrapper, submitted); trackErr != nil {
+					decoder.wm.Log.Warningf("save submitted transaction: %s failed, unexpected error: %v", txid, trackErr)
+				}
+			}
+			if hasPayer {
+				decoder.wm.SequenceManager.Commit(payer, payerSequence)
+				wrapper.SetAddressExtParam(payer, decoder.wm.FullName(), payerSequence+1)
+			}
+			return txid, nil
+		}
 
-				//for i, s := range sigPub {
-				//	log.Info("第", i+1, "个签名结果")
-				//	log.Info()
-				//	log.Info("对应的公钥为")
-				//	log.Info(hex.EncodeToString(s.Pubkey))
-				//}
+		//广播失败释放序号
+		decoder.wm.SequenceManager.Release(from, sequence)
+		if hasPayer {
+			decoder.wm.SequenceManager.Release(payer, payerSequence)
+		}
+		if !isSequenceMismatch(err) {
+			return "", err
+		}
 
-				// txHash.Normal.SigPub = *sigPub
+		expected, ok := uint64(0), false
+		if bErr := toBroadcastError(err); bErr != nil {
+			expected, ok = bErr.ExpectedSequence()
+		}
+		//有手续费支付方的交易需要两方签名，不重新签名
+		var resignErr error
+		if ok && i < retry && !hasPayer {
+			resignErr = decoder.checkResignable(rawTx.RawHex, sequence, expected)
+			if resignErr == nil {
+				resignErr = decoder.resignTransaction(wrapper, rawTx, from, expected)
+			}
+			if resignErr == nil {
+				continue
 			}
+			decoder.wm.Log.Errorf("re-sign transaction with sequence %d failed, unexpected error: %v", expected, resignErr)
+		}
 
-			keySignature.Signature = sig
+		//不再重试时从链上重新同步序号
+		chainSequence, resyncErr := decoder.wm.SequenceManager.Resync(from)
+		if resyncErr == nil {
+			wrapper.SetAddressExtParam(from, decoder.wm.FullName(), chainSequence)
+		}
+		if hasPayer {
+			payerChainSequence, resyncErr := decoder.wm.SequenceManager.Resync(payer)
+			if resyncErr == nil {
+				wrapper.SetAddressExtParam(payer, decoder.wm.FullName(), payerChainSequence)
+			}
 		}
+		//重新签名失败时返回失败的原因，如无法取得钱包私钥
+		if resignErr != nil {
+			return "", fmt.Errorf("re-sign transaction with sequence %d failed, %v", expected, resignErr)
+		}
+		return "", err
 	}
+}
 
-	log.Info("transaction hash sign success")
+//GetExpiredTransactions 查找已超过超时高度仍未上链的交易，并将发送地址和手续费支付方的序号回退到最小的超时交易，
+//调用方可按返回的顺序用相同的序号重建交易；已上链的交易不再记录，超时的交易在重建的交易广播成功后不再记录
+func (decoder *TransactionDecoder) GetExpiredTransactions(wrapper openwallet.WalletDAI) ([]*SubmittedTx, error) {
+	height, err := decoder.wm.RestClient.getBlockHeight()
+	if err != nil {
+		return nil, err
+	}
 
-	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
+	//重启后从钱包数据恢复已广播的交易
+	err = decoder.wm.SequenceManager.Load(wrapper)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	expired := make([]*SubmittedTx, 0)
+	rewind := make(map[string]uint64)
+	for _, tx := range decoder.wm.SequenceManager.Submitted() {
+		//超时高度之后的区块拒绝交易，最新高度达到超时高度仍未上链的交易不会再上链
+		if height < tx.TimeoutHeight {
+			continue
+		}
+		result, err := decoder.wm.RestClient.getTxResult(tx.TxID)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil && result.Height > 0 {
+			//已上链的交易不再记录
+			err = decoder.wm.SequenceManager.Untrack(wrapper, tx.TxID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		//超时的交易继续记录，重建的交易广播成功后才不再记录，重建失败或重启后仍会返回
+		expired = append(expired, tx)
+		if seq, ok := rewind[tx.Address]; !ok || tx.Sequence < seq {
+			rewind[tx.Address] = tx.Sequence
+		}
+		//手续费支付方的序号同样未被使用
+		if len(tx.FeePayer) > 0 {
+			if seq, ok := rewind[tx.FeePayer]; !ok || tx.FeePayerSequence < seq {
+				rewind[tx.FeePayer] = tx.FeePayerSequence
+			}
+		}
+	}
+
+	for address, seq := range rewind {
+		decoder.wm.SequenceManager.Rewind(address, seq)
+		wrapper.SetAddressExtParam(address, decoder.wm.FullName(), seq)
+	}
+
+	return expired, nil
 }
 
-func (decoder *TransactionDecoder) VerifyATOMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+//isKnownTransaction 广播失败时检查交易是否已在交易池中或已上链，返回本地计算的交易哈希
+func (decoder *TransactionDecoder) isKnownTransaction(signedTrans string, err error) (string, bool) {
+	txid, hashErr := getBroadcastTxHash(signedTrans)
+	if hashErr != nil {
+		return "", false
+	}
 
-	var (
-		emptyTrans = rawTx.RawHex
+	bErr := toBroadcastError(err)
+	if bErr != nil && bErr.IsTxInMempool() {
+		return txid, true
+	}
 
-		signature = ""
-		pubkey    = []byte{}
-	)
+	//序号不匹配或请求超时，交易可能已上链，或者之前的广播已进入交易池
+	if bErr == nil || bErr.IsSequenceMismatch() {
+		result, queryErr := decoder.wm.RestClient.getTxResult(txid)
+		if queryErr == nil && result != nil && result.Height > 0 {
+			return txid, true
+		}
+		if inMempool, _ := decoder.findInMempool(txid); inMempool {
+			return txid, true
+		}
+	}
+	return "", false
+}
 
-	for accountID, keySignatures := range rawTx.Signatures {
-		log.Debug("accountID Signatures:", accountID)
-		for _, keySignature := range keySignatures {
+//findInMempool 查询交易是否在节点的交易池中，未配置节点接口、查询失败或交易池的交易超过单次查询的数量时无法确定，返回错误
+func (decoder *TransactionDecoder) findInMempool(txid string) (bool, error) {
+	if decoder.wm.NodeClient == nil {
+		return false, fmt.Errorf("node api is not configured")
+	}
+	hashes, complete, err := decoder.wm.NodeClient.getUnconfirmedTxHashes()
+	if err != nil {
+		return false, err
+	}
+	if hashes[txid] {
+		return true, nil
+	}
+	if !complete {
+		return false, fmt.Errorf("mempool has more than %d transactions", unconfirmedTxsLimit)
+	}
+	return false, nil
+}
 
-			signature = keySignature.Signature
-			pubkey, _ = hex.DecodeString(keySignature.Address.PublicKey)
+//checkResignable 节点期望的序号大于交易的序号时，交易的序号已被使用，可能是这笔交易仍在交易池中（如广播请求超时后重试），
+//确认交易不在交易池中才能按新的序号重新签名，否则会重复转账
+func (decoder *TransactionDecoder) checkResignable(signedTrans string, sequence, expected uint64) error {
+	if expected <= sequence {
+		return nil
+	}
+	txid, err := getBroadcastTxHash(signedTrans)
+	if err != nil {
+		return err
+	}
+	inMempool, err := decoder.findInMempool(txid)
+	if err != nil {
+		return fmt.Errorf("can not confirm that transaction: %s is not in mempool, %v", txid, err)
+	}
+	if inMempool {
+		return fmt.Errorf("transaction: %s is already in mempool", txid)
+	}
+	return nil
+}
 
-			log.Debug("Signature:", signature)
-			log.Debug("PublicKey:", hex.EncodeToString(pubkey))
+//resignTransaction 按节点期望的序号重新签名单签交易，更新交易单的广播数据和签名
+func (decoder *TransactionDecoder) resignTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, from string, expected uint64) error {
+	var keySignature *openwallet.KeySignature
+	for _, keySignatures := range rawTx.Signatures {
+		for _, ks := range keySignatures {
+			if ks.Address == nil || ks.Address.Address != from {
+				continue
+			}
+			if keySignature != nil {
+				return fmt.Errorf("multisig transaction can not be re-signed")
+			}
+			keySignature = ks
 		}
 	}
+	if keySignature == nil {
+		return fmt.Errorf("signature of address: %s not found", from)
+	}
+
+	key, err := wrapper.HDKey()
+	if err != nil {
+		return err
+	}
+	childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := childKey.GetPrivateKeyBytes()
+	if err != nil {
+		return err
+	}
 
-	signedTrans, err := getBroadcastBytes(emptyTrans, signature)
-	pass := true
+	//广播失败时已释放原来的序号，只预留期望的序号，不影响其他交易预留的序号
+	sequence := expected
+	accountNumber, err := decoder.wm.SequenceManager.ReserveAt(from, sequence)
 	if err != nil {
-		return fmt.Errorf("transaction compose signatures failed")
+		return err
 	}
 
-	if pass {
-		log.Debug("transaction verify passed")
-		rawTx.IsCompleted = true
-		rawTx.RawHex = signedTrans
-	} else {
-		log.Debug("transaction verify failed")
-		rawTx.IsCompleted = false
+	signedTrans, message, signature, err := resignBroadcastTx(rawTx.RawHex, decoder.wm.Config.ChainID, accountNumber, sequence, keyBytes)
+	if err != nil {
+		decoder.wm.SequenceManager.Release(from, sequence)
+		return err
+	}
+
+	txid, err := getBroadcastTxHash(signedTrans)
+	if err != nil {
+		decoder.wm.SequenceManager.Release(from, sequence)
+		return err
 	}
 
+	keySignature.Message = message
+	keySignature.Signature = signature
+	rawTx.RawHex = signedTrans
+	rawTx.TxID = txid
 	return nil
 }
 
-func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
-	if decoder.wm.Config.PayFee {
-		return convertToAmount(decoder.wm.Config.MinFee), "TX", nil
-	} else {
-		return convertToAmount(0), "TX", nil
+//getMultisigPublicKeys 按地址的派生路径，从多签账户各拥有者的账户公钥派生成员公钥
+func getMultisigPublicKeys(account *openwallet.AssetsAccount, addr *openwallet.Address) ([]string, error) {
+	paths := strings.Split(addr.HDPath, "/")
+	if len(paths) < 2 {
+		return nil, fmt.Errorf("invalid hd path: %s", addr.HDPath)
+	}
+	change, err := strconv.ParseUint(paths[len(paths)-2], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	index, err := strconv.ParseUint(paths[len(paths)-1], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	pubs := make([]string, 0, len(account.OwnerKeys))
+	for _, ownerKey := range account.OwnerKeys {
+		if len(ownerKey) == 0 {
+			continue
+		}
+		key, err := owkeychain.OWDecode(ownerKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err = key.GenPublicChild(uint32(change))
+		if err != nil {
+			return nil, err
+		}
+		key, err = key.GenPublicChild(uint32(index))
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, hex.EncodeToString(key.GetPublicKeyBytes()))
+	}
+	return pubs, nil
+}
+
+//getExtParamList 读取列表类型的扩展参数，支持数组或逗号分隔的字符串
+func getExtParamList(param gjson.Result) []string {
+	list := make([]string, 0)
+	if param.IsArray() {
+		for _, v := range param.Array() {
+			if v.String() != "" {
+				list = append(list, v.String())
+			}
+		}
+		return list
+	}
+	for _, v := range strings.Split(param.String(), ",") {
+		if strings.TrimSpace(v) != "" {
+			list = append(list, strings.TrimSpace(v))
+		}
 	}
+	return list
 }
 
 //CreateSummaryRawTransaction 创建汇总交易，返回原始交易单数组
@@ -388,6 +1645,10 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 		return nil, err
 	}
 
+	//手续费由授权方或支付方支付时，汇总地址的余额可以全部转出
+	feeGranter, feePayer := decoder.getFeeDelegation(gjson.Parse(sumRawTx.ExtParam))
+	delegated := len(feeGranter) > 0 || len(feePayer) > 0
+
 	for _, addrBalance := range addrBalanceArray {
 
 		//检查余额是否超过最低转账
@@ -403,7 +1664,7 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 		//this.wm.Log.Debug("sumAmount:", sumAmount)
 		//计算手续费
 		fee := big.NewInt(0) //(int64(decoder.wm.Config.FeeCharge))
-		if len(sumRawTx.FeeRate) > 0 {
+		if len(sumRawTx.FeeRate) > 0 && !decoder.wm.Config.IsSimulate {
 			fee = big.NewInt(int64(convertFromAmount(sumRawTx.FeeRate)))
 		} else {
 			if decoder.wm.Config.PayFee {
@@ -412,7 +1673,9 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 		}
 
 		//减去手续费
-		sumAmount_BI.Sub(sumAmount_BI, fee)
+		if !delegated {
+			sumAmount_BI.Sub(sumAmount_BI, fee)
+		}
 		if sumAmount_BI.Cmp(big.NewInt(0)) <= 0 {
 			continue
 		}
@@ -431,7 +1694,9 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 			To: map[string]string{
 				sumRawTx.SummaryAddress: sumAmount,
 			},
+			FeeRate:  sumRawTx.FeeRate,
 			Required: 1,
+			ExtParam: sumRawTx.ExtParam,
 		}
 
 		createErr := decoder.createRawTransaction(
@@ -452,8 +1717,17 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, addrBalance *openwallet.Balance) error {
 
 	gas := decoder.wm.Config.StdGas
+	gasPrice := decoder.getGasPrice()
+	payFee := decoder.wm.Config.PayFee
 	fee := uint64(0) //decoder.wm.Config.FeeCharge
-	if decoder.wm.Config.PayFee {
+	if len(rawTx.FeeRate) > 0 && decoder.wm.Config.IsSimulate {
+		//模拟交易时，FeeRate为每单位gas的价格
+		gasPrice = convertGasPriceFromAmount(rawTx.FeeRate)
+		payFee = true
+		fee = decoder.wm.Config.MinFee
+	} else if len(rawTx.FeeRate) > 0 {
+		fee = convertFromAmount(rawTx.FeeRate)
+	} else if decoder.wm.Config.PayFee {
 		fee = decoder.wm.Config.MinFee
 	}
 
@@ -477,28 +1751,15 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 	rawTx.TxTo = []string{to}
 	rawTx.TxAmount = amountStr
 	rawTx.Fees = convertToAmount(fee)
-	rawTx.FeeRate = convertToAmount(fee)
 
 	denom := decoder.wm.Config.Denom
 	chainID := decoder.wm.Config.ChainID
-	var sequence uint64
-	sequence_db, err := wrapper.GetAddressExtParam(from, decoder.wm.FullName())
-	if err != nil {
-		return err
-	}
-	if sequence_db == nil {
-		sequence = 0
-	} else {
-		sequence = ow.NewString(sequence_db).UInt64()
-	}
-	accountNumber, sequenceChain, err := decoder.wm.RestClient.getAccountNumberAndSequence(from)
+	memo := ""
+
+	timeout, err := decoder.getTimeoutHeight(rawTx.GetExtParam())
 	if err != nil {
 		return err
 	}
-	if sequenceChain > int(sequence) {
-		sequence = uint64(sequenceChain)
-	}
-	memo := ""
 
 	cosmosTx := CosmosTx{
 		From:      from,
@@ -508,16 +1769,56 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 		Memo:      memo,
 		ChainID:   chainID,
 		PublicKey: fromPubkey,
-		Amount:    int64(convertFromAmount(amountStr)),
+		Amount:    convertFromDenomAmount(amountStr, defaultDenomDecimals),
 		Fee:       int64(fee),
-		AccNum:    uint64(accountNumber),
-		AccSeq:    uint64(sequence),
 		GasLimit:  gas,
-		Timeout:   0,
+		Timeout:   timeout,
+		SignMode:  decoder.wm.Config.SignMode,
+	}
+
+	feeGranter, feePayer := decoder.getFeeDelegation(rawTx.GetExtParam())
+	delegated := len(feeGranter) > 0 || len(feePayer) > 0
+	payerAddr, err := decoder.setFeeDelegation(wrapper, &cosmosTx, feeGranter, feePayer)
+	if err != nil {
+		return err
+	}
+
+	//预留发送地址和手续费支付方的序号，交易单创建失败时释放
+	err = decoder.reserveSequences(wrapper, &cosmosTx)
+	if err != nil {
+		return err
+	}
+
+	//模拟交易估算gas，手续费的变化从汇总数量中扣除
+	if decoder.wm.Config.IsSimulate {
+		simulatedGas, err := decoder.simulateGas(cosmosTx)
+		if err != nil {
+			log.Warningf("simulate transaction failed, use the static gas and fee instead, unexpected error: %v", err)
+		} else {
+			cosmosTx.GasLimit = simulatedGas
+			if payFee {
+				simulatedFee := calculateFee(simulatedGas, gasPrice)
+				if !delegated {
+					cosmosTx.Amount.Add(cosmosTx.Amount, big.NewInt(int64(fee)))
+					cosmosTx.Amount.Sub(cosmosTx.Amount, big.NewInt(int64(simulatedFee)))
+				}
+				if cosmosTx.Amount.Sign() <= 0 {
+					decoder.releaseSequences(&cosmosTx)
+					return openwallet.Errorf(openwallet.ErrInsufficientFees, "the balance of address: %s is not enough to pay the fee: %s", from, convertToAmount(simulatedFee))
+				}
+				fee = simulatedFee
+				cosmosTx.Fee = int64(fee)
+				amountStr = convertToDenomAmount(cosmosTx.Amount, defaultDenomDecimals)
+				rawTx.To = map[string]string{to: amountStr}
+				rawTx.TxAmount = amountStr
+				rawTx.Fees = convertToAmount(fee)
+			}
+		}
 	}
 
 	emptyTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
 	if err != nil {
+		decoder.releaseSequences(&cosmosTx)
 		return err
 	}
 	rawTx.RawHex = emptyTrans
@@ -539,7 +1840,13 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 
 	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
 
-	rawTx.FeeRate = big.NewInt(int64(fee)).String()
+	err = decoder.addFeePayerSignature(rawTx, &cosmosTx, payerAddr)
+	if err != nil {
+		decoder.releaseSequences(&cosmosTx)
+		return err
+	}
+
+	rawTx.FeeRate = decoder.getFeeRate(fee, gasPrice)
 
 	rawTx.IsBuilt = true
 
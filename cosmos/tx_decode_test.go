@@ -0,0 +1,1114 @@
+package cosmos
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-owcdrivers/addressEncoder"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	xauthsigning "github.com/cosmos/cosmos-sdk/x/auth/signing"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/tidwall/gjson"
+)
+
+func testSignedRawTransaction(t *testing.T, prikey string, options ...func(*CosmosTx)) (*openwallet.RawTransaction, *openwallet.KeySignature) {
+	key, _ := hex.DecodeString(prikey)
+	pub := (&secp256k1.PrivKey{Key: key}).PubKey()
+
+	cosmosTx := CosmosTx{
+		From:      addressEncoder.AddressEncode(pub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress),
+		To:        "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:     "uatom",
+		FeeDenom:  "uatom",
+		ChainID:   "cosmoshub-4",
+		PublicKey: hex.EncodeToString(pub.Bytes()),
+		Amount:    big.NewInt(500000),
+		Fee:       2500,
+		AccNum:    173110,
+		AccSeq:    5,
+		GasLimit:  200000,
+	}
+	for _, option := range options {
+		option(&cosmosTx)
+	}
+
+	unsignedTrans, hash, err := cosmosTx.getUnsignedTxAndHash()
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	signature, err := signTransactionHash(hash, key)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	keySignature := &openwallet.KeySignature{
+		EccType: CurveType,
+		Address: &openwallet.Address{
+			Address:   cosmosTx.From,
+			PublicKey: cosmosTx.PublicKey,
+		},
+		Message:   hash,
+		Signature: signature,
+	}
+	rawTx := &openwallet.RawTransaction{
+		RawHex: unsignedTrans,
+		Signatures: map[string][]*openwallet.KeySignature{
+			"account": {keySignature},
+		},
+	}
+	return rawTx, keySignature
+}
+
+//memoryWalletDAI 测试用的钱包数据，地址扩展参数保存在内存中
+type memoryWalletDAI struct {
+	openwallet.WalletDAIBase
+	addresses []*openwallet.Address
+	ext       map[string]interface{}
+}
+
+//newMemoryWalletDAI 按私钥生成钱包地址
+func newMemoryWalletDAI(prikeys ...string) *memoryWalletDAI {
+	wrapper := &memoryWalletDAI{ext: make(map[string]interface{})}
+	for _, prikey := range prikeys {
+		key, _ := hex.DecodeString(prikey)
+		pub := (&secp256k1.PrivKey{Key: key}).PubKey()
+		wrapper.addresses = append(wrapper.addresses, &openwallet.Address{
+			AccountID: "account",
+			Address:   addressEncoder.AddressEncode(pub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress),
+			PublicKey: hex.EncodeToString(pub.Bytes()),
+		})
+	}
+	return wrapper
+}
+
+func (wrapper *memoryWalletDAI) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	return wrapper.addresses, nil
+}
+
+func (wrapper *memoryWalletDAI) GetAddress(address string) (*openwallet.Address, error) {
+	for _, addr := range wrapper.addresses {
+		if addr.Address == address {
+			return addr, nil
+		}
+	}
+	return nil, fmt.Errorf("address: %s not found", address)
+}
+
+func (wrapper *memoryWalletDAI) SetAddressExtParam(address string, key string, val interface{}) error {
+	wrapper.ext[address+":"+key] = val
+	return nil
+}
+
+func (wrapper *memoryWalletDAI) GetAddressExtParam(address string, key string) (interface{}, error) {
+	return wrapper.ext[address+":"+key], nil
+}
+
+//hdWalletDAI 测试用的HD钱包，按种子派生签名的密钥
+type hdWalletDAI struct {
+	memoryWalletDAI
+	key *hdkeystore.HDKey
+}
+
+func (wrapper *hdWalletDAI) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return wrapper.key, nil
+}
+
+func Test_SignATOMRawTransaction(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	key, err := hdkeystore.NewHDKey(seed, "test", "m/44'/118'")
+	if err != nil {
+		t.Fatalf("create hd key failed: %v", err)
+	}
+	wrapper := &hdWalletDAI{key: key}
+	wm := NewWalletManager()
+	decoder := NewTransactionDecoder(wm)
+
+	path := "m/44'/118'/0'/0/1"
+	childKey, err := key.DerivedKeyWithPath(path, wm.Config.CurveType)
+	if err != nil {
+		t.Fatalf("derive key failed: %v", err)
+	}
+	pub := hex.EncodeToString(childKey.GetPublicKeyBytes())
+	address, _ := wm.Decoder.PublicKeyToAddress(childKey.GetPublicKeyBytes(), false)
+	otherPub := hex.EncodeToString((&secp256k1.PrivKey{Key: seed}).PubKey().Bytes())
+	message := hex.EncodeToString(owcrypt.Hash([]byte("sign bytes"), 0, owcrypt.HASH_ALG_SHA256))
+
+	newKeySignature := func(addr openwallet.Address) *openwallet.KeySignature {
+		addr.HDPath = path
+		return &openwallet.KeySignature{EccType: wm.Config.CurveType, Address: &addr, Message: message}
+	}
+	own := newKeySignature(openwallet.Address{AccountID: "account"})
+	matchedPub := newKeySignature(openwallet.Address{AccountID: "member", PublicKey: pub})
+	matchedAddress := newKeySignature(openwallet.Address{AccountID: "payer", Address: address})
+	otherPubKey := newKeySignature(openwallet.Address{AccountID: "account", PublicKey: otherPub})
+	otherAddress := newKeySignature(openwallet.Address{AccountID: "member", Address: "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n"})
+	unknown := newKeySignature(openwallet.Address{AccountID: "member"})
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		Signatures: map[string][]*openwallet.KeySignature{
+			"account": {own, otherPubKey},
+			"member":  {matchedPub, otherAddress, unknown},
+			"payer":   {matchedAddress},
+		},
+	}
+
+	if err = decoder.SignATOMRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	//交易单的账户、公钥或地址与派生的密钥一致的待签名才签名
+	for name, keySignature := range map[string]*openwallet.KeySignature{"own account": own, "matched public key": matchedPub, "matched address": matchedAddress} {
+		if len(keySignature.Signature) == 0 {
+			t.Errorf("%s should be signed", name)
+		}
+	}
+	for name, keySignature := range map[string]*openwallet.KeySignature{"other public key": otherPubKey, "other address": otherAddress, "unknown key": unknown} {
+		if len(keySignature.Signature) != 0 {
+			t.Errorf("%s should not be signed", name)
+		}
+	}
+}
+
+func Test_planSplitParts(t *testing.T) {
+	staticFee := func(fee int64) func(string, *big.Int) *big.Int {
+		return func(string, *big.Int) *big.Int {
+			return big.NewInt(fee)
+		}
+	}
+	cases := []struct {
+		name      string
+		balances  []int64
+		total     int64
+		feeFunc   func(string, *big.Int) *big.Int
+		amounts   []int64
+		remaining int64
+	}{
+		{"static fee", []int64{1000, 600, 300}, 1400, staticFee(10), []int64{990, 410}, 0},
+		//模拟的手续费大于固定手续费，每笔按模拟的手续费预留
+		{"simulated fee", []int64{1000, 600, 300}, 1400, staticFee(30), []int64{970, 430}, 0},
+		//扣除手续费后的数量重新估算的手续费更高
+		{"re-estimate fee", []int64{1000, 600}, 1400, func(from string, amount *big.Int) *big.Int {
+			if amount.Int64() >= 990 {
+				return big.NewInt(20)
+			}
+			return big.NewInt(25)
+		}, []int64{975, 425}, 0},
+		{"skip address without enough fee", []int64{1000, 10, 500}, 1200, staticFee(10), []int64{990, 210}, 0},
+		{"insufficient balance", []int64{100, 50}, 200, staticFee(10), []int64{90, 40}, 70},
+		{"fee delegated", []int64{1000, 600}, 1600, staticFee(0), []int64{1000, 600}, 0},
+	}
+
+	for _, c := range cases {
+		balances := make([]AddrBalance, 0, len(c.balances))
+		for i, b := range c.balances {
+			balances = append(balances, AddrBalance{Address: fmt.Sprintf("address%d", i), Balance: big.NewInt(b)})
+		}
+		parts, remaining := planSplitParts(balances, big.NewInt(c.total), c.feeFunc)
+		if remaining.Int64() != c.remaining || len(parts) != len(c.amounts) {
+			t.Errorf("%s: unexpected plan: %+v, remaining: %s", c.name, parts, remaining)
+			continue
+		}
+		for i, part := range parts {
+			if part.amount.Int64() != c.amounts[i] {
+				t.Errorf("%s: unexpected amount of part %d: %s", c.name, i, part.amount)
+			}
+			for _, b := range balances {
+				if b.Address == part.from && new(big.Int).Add(part.amount, part.fee).Cmp(b.Balance) > 0 {
+					t.Errorf("%s: part %d exceeds the balance: %+v", c.name, i, part)
+				}
+			}
+		}
+	}
+}
+
+func Test_CreateSplitRawTransactionWithError(t *testing.T) {
+	wrapper := newMemoryWalletDAI(
+		"1234567812345678123456781234567812345678123456781234567812345678",
+		"8765432187654321876543218765432187654321876543218765432187654321")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bank/balances/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":[{"denom":"uatom","amount":"20000"}]}`)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173110","sequence":"5"}}}`)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/simulate", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"gas_info":{"gas_wanted":"0","gas_used":"200000"}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.Config.Denom = "uatom"
+	wm.Config.ChainID = "cosmoshub-4"
+	wm.Config.PayFee = true
+	wm.Config.MinFee = 2500
+	wm.Config.StdGas = 200000
+	wm.Config.IsSimulate = true
+	decoder := NewTransactionDecoder(wm)
+
+	//模拟的手续费为3250，按固定手续费2500拆分时第一笔的余额不足以支付模拟的手续费
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: "ATOM"},
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n": "0.03"},
+	}
+	parts, err := decoder.CreateSplitRawTransactionWithError(wrapper, rawTx)
+	if err != nil || len(parts) != 2 {
+		t.Fatalf("split failed: %v", err)
+	}
+	for i, amount := range []string{"0.01675", "0.01325"} {
+		part := parts[i]
+		if part.Error != nil {
+			t.Errorf("part %d create failed: %v", i, part.Error)
+			continue
+		}
+		if part.RawTx.TxAmount != amount || part.RawTx.Fees != "0.00325" {
+			t.Errorf("unexpected part %d: amount %s, fee %s", i, part.RawTx.TxAmount, part.RawTx.Fees)
+		}
+	}
+
+	//合计余额不足以支付转账数量和每笔的手续费
+	rawTx.To = map[string]string{"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n": "0.034"}
+	_, err = decoder.CreateSplitRawTransactionWithError(wrapper, rawTx)
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrInsufficientBalanceOfAccount {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_CreateATOMRawTransaction_simulate(t *testing.T) {
+	wrapper := newMemoryWalletDAI("1234567812345678123456781234567812345678123456781234567812345678")
+	simulateFailed := false
+	sequences := make([]uint64, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bank/balances/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":[{"denom":"uatom","amount":"10000000"}]}`)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173110","sequence":"5"}}}`)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/simulate", func(w http.ResponseWriter, r *http.Request) {
+		//记录模拟交易使用的序号
+		body, _ := ioutil.ReadAll(r.Body)
+		var req struct {
+			TxBytes []byte `json:"tx_bytes"`
+		}
+		json.Unmarshal(body, &req)
+		tx, err := newEncodingConfig().TxConfig.TxDecoder()(req.TxBytes)
+		if err != nil {
+			t.Errorf("simulate tx decode failed: %v", err)
+		} else {
+			sigs, _ := tx.(xauthsigning.SigVerifiableTx).GetSignaturesV2()
+			sequences = append(sequences, sigs[0].Sequence)
+		}
+		if simulateFailed {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"code":13,"message":"insufficient fee"}`)
+			return
+		}
+		fmt.Fprint(w, `{"gas_info":{"gas_wanted":"0","gas_used":"100000"}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.Config.Denom = "uatom"
+	wm.Config.ChainID = "cosmoshub-4"
+	wm.Config.PayFee = true
+	wm.Config.MinFee = 2500
+	wm.Config.StdGas = 200000
+	wm.Config.IsSimulate = true
+	decoder := NewTransactionDecoder(wm)
+	newRawTx := func() *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Coin:    openwallet.Coin{Symbol: "ATOM"},
+			Account: &openwallet.AssetsAccount{AccountID: "account"},
+			To:      map[string]string{"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n": "0.5"},
+		}
+	}
+
+	//先预留序号再模拟，连续创建的交易单按预留的序号模拟
+	for i := 0; i < 2; i++ {
+		rawTx := newRawTx()
+		if err := decoder.CreateATOMRawTransaction(wrapper, rawTx); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		if rawTx.Fees != "0.001625" || rawTx.FeeRate != "0.0000000125" {
+			t.Errorf("unexpected simulated fee: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+		}
+	}
+	if len(sequences) != 2 || sequences[0] != 5 || sequences[1] != 6 {
+		t.Errorf("unexpected simulate sequences: %v", sequences)
+	}
+
+	//模拟失败时使用固定的gas和手续费
+	simulateFailed = true
+	rawTx := newRawTx()
+	if err := decoder.CreateATOMRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if rawTx.Fees != "0.0025" || rawTx.FeeRate != "0.0000000125" {
+		t.Errorf("unexpected static fee: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+	}
+	if len(sequences) != 3 || sequences[2] != 7 {
+		t.Errorf("unexpected simulate sequences: %v", sequences)
+	}
+
+	//指定的FeeRate为每单位gas的价格，模拟失败时手续费为固定值，FeeRate仍为gas价格
+	rawTx = newRawTx()
+	rawTx.FeeRate = "0.00000002"
+	if err := decoder.CreateATOMRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if rawTx.Fees != "0.0025" || rawTx.FeeRate != "0.00000002" {
+		t.Errorf("unexpected static fee: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+	}
+	simulateFailed = false
+	rawTx = newRawTx()
+	rawTx.FeeRate = "0.00000002"
+	if err := decoder.CreateATOMRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if rawTx.Fees != "0.0026" || rawTx.FeeRate != "0.00000002" {
+		t.Errorf("unexpected simulated fee: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+	}
+
+	//不模拟交易时，FeeRate为固定的手续费
+	wm.Config.IsSimulate = false
+	rawTx = newRawTx()
+	rawTx.FeeRate = "0.003"
+	if err := decoder.CreateATOMRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if rawTx.Fees != "0.003" || rawTx.FeeRate != "0.003" {
+		t.Errorf("unexpected fixed fee: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+	}
+}
+
+func Test_CreateATOMRawTransaction_largeAmount(t *testing.T) {
+	wrapper := newMemoryWalletDAI("1234567812345678123456781234567812345678123456781234567812345678")
+	weth := "ibc/EA1D43981D5C9A1C4AAEA9C23BB1D4FA126BA9BC7020A25E0AE4AA841EA25DC5"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bank/balances/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"result":[{"denom":"%s","amount":"1500000000000000000000"},{"denom":"uatom","amount":"10000"}]}`, weth)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173110","sequence":"5"}}}`)
+	})
+	mux.HandleFunc("/ibc/apps/transfer/v1/denom_traces/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"denom_trace":{"path":"transfer/channel-2","base_denom":"weth-wei"}}`)
+	})
+	mux.HandleFunc("/cosmos/bank/v1beta1/denoms_metadata/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"code":5,"message":"client metadata for denom %s"}`, weth)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.Config.Denom = "uatom"
+	wm.Config.ChainID = "cosmoshub-4"
+	wm.Config.PayFee = true
+	wm.Config.MinFee = 2500
+	wm.Config.StdGas = 200000
+	decoder := NewTransactionDecoder(wm)
+
+	//没有denom元数据也没有登记精度时，无法换算数量
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "ATOM", IsContract: true, Contract: openwallet.SmartContract{
+			Address: weth,
+		}},
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n": "1.5"},
+	}
+	err := decoder.CreateATOMRawTransaction(wrapper, rawTx)
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrCreateRawTransactionFailed {
+		t.Errorf("unexpected error of unknown decimals: %v", err)
+	}
+
+	//18位精度的代币，数量超过uint64
+	rawTx.Coin.Contract.Decimals = 18
+	rawTx.To = map[string]string{"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n": "1500"}
+	if err := decoder.CreateATOMRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	var cosmosTx CosmosTx
+	txBytes, _ := hex.DecodeString(rawTx.RawHex)
+	if err := json.Unmarshal(txBytes, &cosmosTx); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	msgs, err := cosmosTx.getMsgs()
+	if err != nil {
+		t.Fatalf("create msgs failed: %v", err)
+	}
+	send, ok := msgs[0].(*banktypes.MsgSend)
+	if !ok || send.Amount.AmountOf(weth).String() != "1500000000000000000000" || rawTx.TxAmount != "1500" {
+		t.Errorf("unexpected send message: %v", msgs[0])
+	}
+
+	//超过余额
+	rawTx.To = map[string]string{"cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n": "1500.000000000000000001"}
+	err = decoder.CreateATOMRawTransaction(wrapper, rawTx)
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrInsufficientBalanceOfAccount {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_VerifyATOMRawTransaction(t *testing.T) {
+	decoder := &TransactionDecoder{}
+	prikey := "1234567812345678123456781234567812345678123456781234567812345678"
+
+	rawTx, _ := testSignedRawTransaction(t, prikey)
+	err := decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err != nil || !rawTx.IsCompleted {
+		t.Errorf("verify failed: %v", err)
+	}
+	//交易哈希为编码后交易的SHA256
+	txBytes, _ := hex.DecodeString(strings.Split(rawTx.RawHex, ":")[0])
+	if rawTx.TxID != strings.ToUpper(hex.EncodeToString(owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256))) {
+		t.Errorf("unexpected txid: %s", rawTx.TxID)
+	}
+
+	//被签消息与交易单不一致
+	rawTx, keySignature := testSignedRawTransaction(t, prikey)
+	keySignature.Message = "00" + keySignature.Message[2:]
+	err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err == nil || rawTx.IsCompleted {
+		t.Errorf("verify should fail with wrong message")
+	}
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != ErrVerifySignBytesMismatch {
+		t.Errorf("unexpected error type: %v", err)
+	}
+
+	//签名与公钥不一致
+	otherKey := "2234567812345678123456781234567812345678123456781234567812345678"
+	rawTx, keySignature = testSignedRawTransaction(t, prikey)
+	other, _ := testSignedRawTransaction(t, otherKey)
+	keySignature.Address.PublicKey = other.Signatures["account"][0].Address.PublicKey
+	err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err == nil || rawTx.IsCompleted {
+		t.Errorf("verify should fail with wrong public key")
+	}
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != ErrVerifySignatureInvalid {
+		t.Errorf("unexpected error type: %v", err)
+	}
+
+	//签名有效，但公钥不属于发送地址
+	keyBytes, _ := hex.DecodeString(otherKey)
+	keySignature.Signature, _ = signTransactionHash(keySignature.Message, keyBytes)
+	err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err == nil || rawTx.IsCompleted {
+		t.Errorf("verify should fail with public key of other address")
+	}
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != ErrVerifyPublicKeyMismatch {
+		t.Errorf("unexpected error type: %v", err)
+	}
+
+	//缺少签名
+	rawTx, keySignature = testSignedRawTransaction(t, prikey)
+	keySignature.Signature = ""
+	err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err == nil || rawTx.IsCompleted {
+		t.Errorf("verify should fail without signature")
+	}
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrVerifyRawTransactionFailed {
+		t.Errorf("unexpected error type: %v", err)
+	}
+}
+
+func Test_SubmitRawTransaction_confirm(t *testing.T) {
+	txhash := "A1B2C3"
+	queries := 0
+	broadcastMode := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		broadcastMode = gjson.GetBytes(body, "mode").String()
+		fmt.Fprintf(w, `{"tx_response":{"code":0,"txhash":"%s"}}`, txhash)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs/"+txhash, func(w http.ResponseWriter, r *http.Request) {
+		//第一次查询时交易还未上链
+		queries++
+		if queries == 1 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"code":5,"message":"tx not found: %s"}`, txhash)
+			return
+		}
+		fmt.Fprintf(w, `{"tx_response":{"height":"1024","txhash":"%s","codespace":"sdk","code":11,"raw_log":"out of gas","gas_wanted":"200000","gas_used":"200512","timestamp":"2022-10-01T08:00:00Z"}}`, txhash)
+	})
+	mux.HandleFunc("/blocks/1024", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_id":{"hash":"BLOCKHASH"}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.Config.ConfirmInterval = time.Millisecond * 10
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		RawHex:      "0a00:cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9@5",
+		IsCompleted: true,
+		Account:     &openwallet.AssetsAccount{AccountID: "account"},
+		ExtParam:    `{"broadcast_mode":"confirm"}`,
+	}
+	tx, err := decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	if broadcastMode != "BROADCAST_MODE_SYNC" {
+		t.Errorf("unexpected broadcast mode: %s", broadcastMode)
+	}
+	if tx.TxID != txhash || tx.BlockHeight != 1024 || tx.Status != openwallet.TxStatusFail || tx.Reason != "out of gas" {
+		t.Errorf("unexpected transaction: %+v", tx)
+	}
+	ext := gjson.Parse(tx.ExtParam)
+	if ext.Get("gasUsed").Uint() != 200512 || ext.Get("code").Uint() != 11 {
+		t.Errorf("unexpected transaction receipt: %s", tx.ExtParam)
+	}
+
+	//async模式直接返回，不查询执行结果
+	rawTx.ExtParam = `{"broadcast_mode":"async"}`
+	tx, err = decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil || broadcastMode != "BROADCAST_MODE_ASYNC" || tx.Status != "" {
+		t.Errorf("unexpected async submit: %+v %v", tx, err)
+	}
+}
+
+func Test_SubmitRawTransaction_ibc(t *testing.T) {
+	txhash := "A1B2C3"
+	var (
+		mu       sync.Mutex
+		acked    bool
+		notFound int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			fmt.Fprintf(w, `{"tx_response":{"code":0,"txhash":"%s"}}`, txhash)
+			return
+		}
+		//按源端口、通道和序号查询确认或超时
+		events := strings.Join(r.URL.Query()["events"], ",")
+		if !strings.Contains(events, "packet_src_port='transfer'") || !strings.Contains(events, "packet_src_channel='channel-141'") {
+			t.Errorf("unexpected packet query: %s", events)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if acked && strings.HasPrefix(events, "acknowledge_packet") {
+			fmt.Fprint(w, `{"tx_responses":[{"txhash":"ACK","logs":[{"events":[{"type":"fungible_token_packet","attributes":[{"key":"success","value":"\u0001"}]}]}]}]}`)
+			return
+		}
+		//还未收到确认或超时
+		fmt.Fprint(w, `{"txs":[],"tx_responses":[],"pagination":null}`)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs/"+txhash, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		//交易还未被索引
+		if notFound > 0 {
+			notFound--
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"code":5,"message":"tx not found: %s"}`, txhash)
+			return
+		}
+		fmt.Fprintf(w, `{"tx_response":{"height":"1024","txhash":"%s","code":0,"timestamp":"2022-10-01T08:00:00Z",`+
+			`"logs":[{"msg_index":0,"events":[{"type":"send_packet","attributes":[{"key":"packet_sequence","value":"7"},`+
+			`{"key":"packet_src_port","value":"transfer"},{"key":"packet_src_channel","value":"channel-141"},`+
+			`{"key":"packet_dst_port","value":"transfer"},{"key":"packet_dst_channel","value":"channel-0"}]}]}]}}`, txhash)
+	})
+	mux.HandleFunc("/blocks/1024", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_id":{"hash":"BLOCKHASH"}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.Config.ConfirmInterval = time.Millisecond * 10
+	wm.Config.IBCPacketInterval = time.Millisecond * 10
+	wm.Config.IBCPacketTimeout = time.Millisecond * 200
+	decoder := NewTransactionDecoder(wm)
+	packets := make(chan *IBCPacket, 4)
+	wm.SetIBCPacketHandler(func(packet *IBCPacket) {
+		packets <- packet
+	})
+
+	//确认上链后记录发出的数据包
+	rawTx := &openwallet.RawTransaction{
+		RawHex:      "0a00:cosmos1djhe9ury7c05gu5ptjefv0uj9gp48a90vxq3u9@5",
+		IsCompleted: true,
+		Account:     &openwallet.AssetsAccount{AccountID: "account"},
+		ExtParam:    `{"broadcast_mode":"confirm","action":"ibc_transfer"}`,
+	}
+	tx, err := decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil || tx.Status != openwallet.TxStatusSuccess {
+		t.Fatalf("submit failed: %+v %v", tx, err)
+	}
+	ext := gjson.Parse(tx.ExtParam)
+	if ext.Get("ibcPacketSequence").Uint() != 7 || ext.Get("ibcPacketSrcPort").String() != "transfer" || ext.Get("ibcPacketSrcChannel").String() != "channel-141" ||
+		ext.Get("ibcPacketDstChannel").String() != "channel-0" || ext.Get("ibcPacketStatus").String() != IBCPacketPending {
+		t.Errorf("unexpected ibc packet: %s", tx.ExtParam)
+	}
+
+	//提交后在后台继续查询，确认后通知
+	mu.Lock()
+	acked = true
+	mu.Unlock()
+	select {
+	case packet := <-packets:
+		if packet.TxID != txhash || packet.Status != IBCPacketAcknowledged {
+			t.Errorf("unexpected ibc packet: %+v", packet)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ibc packet is not tracked after submit")
+	}
+
+	//未确认上链时不查询数据包，交易还未被索引时后台重试
+	mu.Lock()
+	notFound = 3
+	mu.Unlock()
+	rawTx.ExtParam = `{"broadcast_mode":"sync","action":"ibc_transfer"}`
+	tx, err = decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil || gjson.Parse(tx.ExtParam).Get("ibcPacketSequence").Exists() {
+		t.Errorf("unexpected sync submit: %+v %v", tx, err)
+	}
+	select {
+	case packet := <-packets:
+		if packet.Status != IBCPacketAcknowledged {
+			t.Errorf("unexpected ibc packet: %+v", packet)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ibc packet is not tracked after the transaction is indexed")
+	}
+}
+
+func Test_WaitIBCPacket_failed(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"tx_response":{"height":"1024","txhash":"A1B2C3","code":11,"codespace":"sdk","raw_log":"out of gas","logs":[]}}`)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.Config.IBCPacketInterval = time.Millisecond * 10
+
+	//执行失败的交易没有发出数据包，不再重试
+	packet, err := wm.WaitIBCPacket("A1B2C3", time.Second)
+	if err == nil || packet != nil || calls != 1 {
+		t.Errorf("unexpected packet of failed transaction: %+v %v, calls: %d", packet, err, calls)
+	}
+}
+
+func Test_SubmitRawTransaction_known(t *testing.T) {
+	decoder := &TransactionDecoder{}
+	rawTx, _ := testSignedRawTransaction(t, "1234567812345678123456781234567812345678123456781234567812345678")
+	err := decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	rawTx.Account = &openwallet.AssetsAccount{AccountID: "account"}
+	txid := rawTx.TxID
+
+	broadcastResponse := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, broadcastResponse)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs/"+txid, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tx_response":{"height":"1024","txhash":"%s","code":0}}`, txid)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173110","sequence":"6"}}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	decoder = NewTransactionDecoder(wm)
+
+	//交易已在交易池中
+	broadcastResponse = `{"tx_response":{"code":19,"codespace":"sdk","raw_log":"tx already exists in cache","txhash":""}}`
+	tx, err := decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil || tx.TxID != txid {
+		t.Errorf("tx in mempool should be submitted: %v", err)
+	}
+
+	//超时后重复广播，交易已上链
+	broadcastResponse = `{"tx_response":{"code":32,"codespace":"sdk","raw_log":"account sequence mismatch, expected 6, got 5: incorrect account sequence","txhash":""}}`
+	tx, err = decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil || tx.TxID != txid {
+		t.Errorf("tx on chain should be submitted: %v", err)
+	}
+
+	//其他错误仍然返回失败
+	broadcastResponse = `{"tx_response":{"code":13,"codespace":"sdk","raw_log":"insufficient fee","txhash":""}}`
+	_, err = decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrInsufficientFees {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_SubmitRawTransaction_resign(t *testing.T) {
+	decoder := &TransactionDecoder{}
+	rawTx, _ := testSignedRawTransaction(t, "1234567812345678123456781234567812345678123456781234567812345678")
+	if err := decoder.VerifyATOMRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	rawTx.Account = &openwallet.AssetsAccount{AccountID: "account"}
+	rawTx.SetExtParam("sequence_retry", 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tx_response":{"code":32,"codespace":"sdk","raw_log":"account sequence mismatch, expected 6, got 5: incorrect account sequence","txhash":""}}`)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code":5,"message":"tx not found"}`)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173110","sequence":"6"}}}`)
+	})
+	mempool := make([]string, 0)
+	mempoolTotal := 0
+	mux.HandleFunc("/unconfirmed_txs", func(w http.ResponseWriter, r *http.Request) {
+		txs, _ := json.Marshal(mempool)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":-1,"result":{"n_txs":"%d","total":"%d","txs":%s}}`, len(mempool), mempoolTotal, txs)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	wm.NodeClient = NewClient(server.URL, false)
+	decoder = NewTransactionDecoder(wm)
+
+	//交易不在交易池中，无法取得钱包私钥时返回重新签名失败的原因
+	_, err := decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err == nil || !strings.Contains(err.Error(), "re-sign transaction with sequence 6 failed") || !strings.Contains(err.Error(), "HDKey") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	//交易池的交易超过单次查询的数量，无法确认交易不在交易池中，不重新签名
+	mempoolTotal = 1000
+	_, err = decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err == nil || !strings.Contains(err.Error(), "not in mempool") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	//请求超时后重试，之前的广播已在交易池中，视为广播成功
+	txBytes, _ := hex.DecodeString(strings.Split(rawTx.RawHex, ":")[0])
+	mempool = append(mempool, base64.StdEncoding.EncodeToString(txBytes))
+	mempoolTotal = 1
+	tx, err := decoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	if err != nil || tx.TxID != rawTx.TxID {
+		t.Errorf("tx in mempool should be submitted: %v", err)
+	}
+}
+
+func Test_setAuthorization(t *testing.T) {
+	decoder := NewTransactionDecoder(NewWalletManager())
+	cases := []struct {
+		ext        string
+		msgTypeURL string
+		fail       bool
+	}{
+		{`{}`, MsgSendTypeURL, false},
+		{`{"authorization":"send"}`, MsgSendTypeURL, false},
+		{`{"authorization":"generic","msg_type_url":"/cosmos.gov.v1beta1.MsgVote"}`, "/cosmos.gov.v1beta1.MsgVote", false},
+		//撤销generic授权必须指定消息类型
+		{`{"authorization":"generic"}`, "", true},
+	}
+	for _, c := range cases {
+		cosmosTx := CosmosTx{Action: TxActionRevokeAuthz}
+		err := decoder.setAuthorization(&cosmosTx, gjson.Parse(c.ext))
+		if c.fail != (err != nil) || cosmosTx.AuthzMsgTypeURL != c.msgTypeURL {
+			t.Errorf("unexpected revoke of %s: %s, %v", c.ext, cosmosTx.AuthzMsgTypeURL, err)
+		}
+	}
+}
+
+func Test_GetExpiredTransactions(t *testing.T) {
+	decoder := &TransactionDecoder{}
+	rawTx, _ := testSignedRawTransaction(t, "1234567812345678123456781234567812345678123456781234567812345678", func(cosmosTx *CosmosTx) {
+		cosmosTx.Timeout = 100
+	})
+	err := decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if timeout := parseBroadcastTimeoutHeight(rawTx.RawHex); timeout != 100 {
+		t.Fatalf("unexpected timeout height: %d", timeout)
+	}
+	rawTx.Account = &openwallet.AssetsAccount{AccountID: "account"}
+	from, _, _ := parseBroadcastSender(rawTx.RawHex)
+
+	height := 80
+	broadcastHash := rawTx.TxID
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tx_response":{"code":0,"txhash":"%s"}}`, broadcastHash)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"code":5,"message":"tx not found: %s"}`, r.URL.Path)
+	})
+	mux.HandleFunc("/blocks/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"block":{"header":{"height":"%d"}}}`, height)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173110","sequence":"5"}}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	decoder = NewTransactionDecoder(wm)
+	wrapper := newMemoryWalletDAI("1234567812345678123456781234567812345678123456781234567812345678")
+
+	//超时高度为当前高度加上区块数
+	timeout, err := decoder.getTimeoutHeight(gjson.Parse(`{"timeout_blocks":20}`))
+	if err != nil || timeout != 100 {
+		t.Errorf("unexpected timeout height: %d %v", timeout, err)
+	}
+
+	_, err = decoder.SubmitRawTransaction(wrapper, rawTx)
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	_, reserved, _ := wm.SequenceManager.Reserve(from, 0)
+	if reserved != 6 {
+		t.Fatalf("unexpected sequence after submit: %d", reserved)
+	}
+
+	//达到超时高度前不处理
+	height = 99
+	expired, err := decoder.GetExpiredTransactions(wrapper)
+	if err != nil || len(expired) != 0 {
+		t.Errorf("unexpected expired transactions: %v %v", expired, err)
+	}
+
+	//超时未上链，回退序号后重建可使用相同的序号，其他交易预留的序号不会重复分配
+	height = 100
+	expired, err = decoder.GetExpiredTransactions(wrapper)
+	if err != nil || len(expired) != 1 || expired[0].TxID != rawTx.TxID || expired[0].Sequence != 5 {
+		t.Fatalf("unexpected expired transactions: %v %v", expired, err)
+	}
+	if _, seq, _ := wm.SequenceManager.Reserve(from, 0); seq != 5 {
+		t.Errorf("expired sequence should be reused: %d", seq)
+	}
+	if _, seq, _ := wm.SequenceManager.Reserve(from, 0); seq == reserved {
+		t.Errorf("reserved sequence should not be handed out again: %d", seq)
+	}
+	//重建前超时的交易仍然记录，再次查询时继续返回
+	if len(wm.SequenceManager.Submitted()) != 1 {
+		t.Errorf("expired transaction should be tracked until it is replaced")
+	}
+	expired, err = decoder.GetExpiredTransactions(wrapper)
+	if err != nil || len(expired) != 1 || expired[0].TxID != rawTx.TxID {
+		t.Fatalf("expired transaction should be returned again: %v %v", expired, err)
+	}
+
+	//重启后从钱包数据恢复已广播的交易
+	height = 80
+	_, err = decoder.SubmitRawTransaction(wrapper, rawTx)
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	restarted := NewWalletManager()
+	restarted.RestClient = NewClient(server.URL, false)
+	height = 100
+	expired, err = NewTransactionDecoder(restarted).GetExpiredTransactions(wrapper)
+	if err != nil || len(expired) != 1 || expired[0].TxID != rawTx.TxID {
+		t.Fatalf("submitted transaction should be restored: %v %v", expired, err)
+	}
+	if sequence := wrapper.ext[from+":"+wm.FullName()]; sequence != uint64(5) {
+		t.Errorf("local sequence should be rewound: %v", sequence)
+	}
+
+	//用相同的序号重建的交易广播成功后，超时的交易不再记录
+	replacement, _ := testSignedRawTransaction(t, "1234567812345678123456781234567812345678123456781234567812345678", func(cosmosTx *CosmosTx) {
+		cosmosTx.Timeout = 200
+	})
+	if err = decoder.VerifyATOMRawTransaction(nil, replacement); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	replacement.Account = &openwallet.AssetsAccount{AccountID: "account"}
+	broadcastHash = replacement.TxID
+	if _, err = decoder.SubmitRawTransaction(wrapper, replacement); err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	if submitted := wm.SequenceManager.Submitted(); len(submitted) != 1 || submitted[0].TxID != replacement.TxID {
+		t.Errorf("replaced transaction should not be tracked: %+v", submitted)
+	}
+	restarted = NewWalletManager()
+	restarted.RestClient = NewClient(server.URL, false)
+	expired, err = NewTransactionDecoder(restarted).GetExpiredTransactions(wrapper)
+	if err != nil || len(expired) != 0 {
+		t.Errorf("replaced transaction should not be restored: %v %v", expired, err)
+	}
+}
+
+func Test_GetExpiredTransactions_feePayer(t *testing.T) {
+	var cosmosTx CosmosTx
+	payerKey, _ := hex.DecodeString("2234567812345678123456781234567812345678123456781234567812345678")
+	payerPub := (&secp256k1.PrivKey{Key: payerKey}).PubKey()
+	rawTx, _ := testSignedRawTransaction(t, "1234567812345678123456781234567812345678123456781234567812345678", func(tx *CosmosTx) {
+		tx.Timeout = 100
+		tx.FeePayer = addressEncoder.AddressEncode(payerPub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress)
+		tx.FeePayerPublicKey = hex.EncodeToString(payerPub.Bytes())
+		tx.FeePayerAccNum = 173111
+		tx.FeePayerAccSeq = 9
+		cosmosTx = *tx
+	})
+	payerHash, _ := cosmosTx.getFeePayerHash()
+	payerSignature, _ := signTransactionHash(payerHash, payerKey)
+	rawTx.Signatures["treasury"] = []*openwallet.KeySignature{{
+		EccType:   CurveType,
+		Address:   &openwallet.Address{Address: cosmosTx.FeePayer, PublicKey: cosmosTx.FeePayerPublicKey},
+		Message:   payerHash,
+		Signature: payerSignature,
+	}}
+	decoder := &TransactionDecoder{}
+	err := decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	rawTx.Account = &openwallet.AssetsAccount{AccountID: "account"}
+
+	height := 80
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tx_response":{"code":0,"txhash":"%s"}}`, rawTx.TxID)
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs/"+rawTx.TxID, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"code":5,"message":"tx not found: %s"}`, rawTx.TxID)
+	})
+	mux.HandleFunc("/blocks/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"block":{"header":{"height":"%d"}}}`, height)
+	})
+	mux.HandleFunc("/auth/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{"value":{"account_number":"173111","sequence":"9"}}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.RestClient = NewClient(server.URL, false)
+	decoder = NewTransactionDecoder(wm)
+	wrapper := newMemoryWalletDAI("1234567812345678123456781234567812345678123456781234567812345678")
+
+	_, err = decoder.SubmitRawTransaction(wrapper, rawTx)
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	if _, seq, _ := wm.SequenceManager.Reserve(cosmosTx.FeePayer, 0); seq != 10 {
+		t.Fatalf("unexpected fee payer sequence after submit: %d", seq)
+	}
+	wm.SequenceManager.Release(cosmosTx.FeePayer, 10)
+
+	//超时未上链，手续费支付方的序号同样回退
+	height = 100
+	expired, err := decoder.GetExpiredTransactions(wrapper)
+	if err != nil || len(expired) != 1 || expired[0].FeePayer != cosmosTx.FeePayer || expired[0].FeePayerSequence != 9 {
+		t.Fatalf("unexpected expired transactions: %v %v", expired, err)
+	}
+	if _, seq, _ := wm.SequenceManager.Reserve(cosmosTx.FeePayer, 0); seq != 9 {
+		t.Errorf("expired fee payer sequence should be reused: %d", seq)
+	}
+	if sequence := wrapper.ext[cosmosTx.FeePayer+":"+wm.FullName()]; sequence != uint64(9) {
+		t.Errorf("local fee payer sequence should be rewound: %v", sequence)
+	}
+}
+
+func Test_VerifyATOMRawTransaction_feePayer(t *testing.T) {
+	decoder := &TransactionDecoder{}
+	fromKey, _ := hex.DecodeString("1234567812345678123456781234567812345678123456781234567812345678")
+	payerKey, _ := hex.DecodeString("2234567812345678123456781234567812345678123456781234567812345678")
+	fromPub := (&secp256k1.PrivKey{Key: fromKey}).PubKey()
+	payerPub := (&secp256k1.PrivKey{Key: payerKey}).PubKey()
+
+	cosmosTx := CosmosTx{
+		From:              addressEncoder.AddressEncode(fromPub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress),
+		To:                "cosmos1rc0ya7shas5wkq8ua0g3zhg6dpzu8l9hj3x72n",
+		Denom:             "uatom",
+		FeeDenom:          "uatom",
+		ChainID:           "cosmoshub-4",
+		PublicKey:         hex.EncodeToString(fromPub.Bytes()),
+		Amount:            big.NewInt(500000),
+		Fee:               2500,
+		AccNum:            173110,
+		AccSeq:            5,
+		GasLimit:          200000,
+		FeePayer:          addressEncoder.AddressEncode(payerPub.Address().Bytes(), addressEncoder.ATOM_mainnetAddress),
+		FeePayerPublicKey: hex.EncodeToString(payerPub.Bytes()),
+		FeePayerAccNum:    173111,
+		FeePayerAccSeq:    9,
+	}
+	unsignedTrans, hash, _ := cosmosTx.getUnsignedTxAndHash()
+	payerHash, _ := cosmosTx.getFeePayerHash()
+
+	signature, _ := signTransactionHash(hash, fromKey)
+	payerSignature := &openwallet.KeySignature{
+		EccType: CurveType,
+		Address: &openwallet.Address{Address: cosmosTx.FeePayer, PublicKey: cosmosTx.FeePayerPublicKey},
+		Message: payerHash,
+	}
+	rawTx := &openwallet.RawTransaction{
+		RawHex: unsignedTrans,
+		Signatures: map[string][]*openwallet.KeySignature{
+			"account": {{
+				EccType:   CurveType,
+				Address:   &openwallet.Address{Address: cosmosTx.From, PublicKey: cosmosTx.PublicKey},
+				Message:   hash,
+				Signature: signature,
+			}},
+			"treasury": {payerSignature},
+		},
+	}
+
+	//支付方未签名
+	err := decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err == nil || rawTx.IsCompleted {
+		t.Errorf("verify should fail without fee payer signature")
+	}
+
+	//支付方用发送地址的待签名数据签名
+	payerSignature.Signature, _ = signTransactionHash(hash, payerKey)
+	payerSignature.Message = hash
+	err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err == nil || rawTx.IsCompleted {
+		t.Errorf("verify should fail with wrong fee payer message")
+	}
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != ErrVerifySignBytesMismatch {
+		t.Errorf("unexpected error type: %v", err)
+	}
+
+	payerSignature.Message = payerHash
+	payerSignature.Signature, _ = signTransactionHash(payerHash, payerKey)
+	err = decoder.VerifyATOMRawTransaction(nil, rawTx)
+	if err != nil || !rawTx.IsCompleted {
+		t.Errorf("verify failed: %v", err)
+	}
+}